@@ -0,0 +1,117 @@
+// Command backfill-msisdn normalises the phone numbers already stored
+// on customers and appointments to E.164, the format the API has
+// stored them in since it started validating them. Numbers that are
+// not valid are reported and left as they are
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/hackstock/rubixcore/pkg/phone"
+	"github.com/kelseyhightower/envconfig"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var env = struct {
+	ServiceDSN     string `envconfig:"SERVICE_DSN" required:"true"`
+	DefaultCountry string `envconfig:"DEFAULT_COUNTRY" default:"GH"`
+}{}
+
+// summary counts what happened to the rows of a table
+type summary struct {
+	scanned, updated, invalid int
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report the changes without saving them")
+	batchSize := flag.Int("batch", 500, "number of rows read at a time")
+	flag.Parse()
+
+	err := envconfig.Process("", &env)
+	failOnError("failed loading configurations", err)
+
+	if !phone.ValidRegion(env.DefaultCountry) {
+		failOnError("failed loading configurations", fmt.Errorf("unknown DEFAULT_COUNTRY %q", env.DefaultCountry))
+	}
+
+	dbConn, err := db.Open(env.ServiceDSN)
+	failOnError("failed connecting to database", err)
+	defer dbConn.Close()
+
+	err = dbConn.Ping()
+	failOnError("failed pinging database", err)
+
+	for _, table := range []string{db.CustomersTable, db.AppointmentsTable} {
+		repo, err := db.NewMsisdnsRepo(dbConn, table)
+		failOnError("failed preparing backfill", err)
+
+		s, err := backfill(context.Background(), repo, table, *batchSize, *dryRun)
+		failOnError(fmt.Sprintf("failed backfilling %s", table), err)
+
+		log.Printf("%s: %d scanned, %d normalised, %d invalid", table, s.scanned, s.updated, s.invalid)
+	}
+
+	if *dryRun {
+		log.Printf("dry run, no changes were saved")
+	}
+}
+
+// backfill normalises the phone numbers of a table in batches of
+// increasing ids, so it can be stopped and run again safely
+func backfill(ctx context.Context, repo *db.MsisdnsRepo, table string, batchSize int, dryRun bool) (summary, error) {
+	var s summary
+	var lastID int64
+	for {
+		records, err := repo.Next(ctx, lastID, batchSize)
+		if err != nil {
+			return s, err
+		}
+
+		if len(records) == 0 {
+			return s, nil
+		}
+
+		for _, rec := range records {
+			lastID = rec.ID
+			s.scanned++
+
+			if rec.Msisdn == "" {
+				continue
+			}
+
+			normalized, err := phone.Normalize(rec.Msisdn, env.DefaultCountry)
+			if err != nil {
+				s.invalid++
+				log.Printf("%s %d: %q is %v", table, rec.ID, rec.Msisdn, err)
+				continue
+			}
+
+			if normalized == rec.Msisdn {
+				continue
+			}
+
+			s.updated++
+			if dryRun {
+				log.Printf("%s %d: %q would become %q", table, rec.ID, rec.Msisdn, normalized)
+				continue
+			}
+
+			err = repo.Update(ctx, rec.ID, normalized)
+			if err != nil {
+				return s, err
+			}
+		}
+	}
+}
+
+func failOnError(msg string, err error) {
+	if err != nil {
+		log.Fatalf("%s : %v", msg, err)
+	}
+}
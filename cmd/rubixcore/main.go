@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
 	"time"
 
@@ -17,8 +18,11 @@ import (
 	"github.com/hackstock/rubixcore/pkg/api"
 	"github.com/hackstock/rubixcore/pkg/app"
 	"github.com/hackstock/rubixcore/pkg/db"
-	"github.com/jmoiron/sqlx"
+	"github.com/hackstock/rubixcore/pkg/metrics"
+	"github.com/hackstock/rubixcore/pkg/phone"
 	"github.com/kelseyhightower/envconfig"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/streadway/amqp"
 	"go.uber.org/zap"
 )
@@ -29,26 +33,35 @@ const (
 )
 
 var env = struct {
-	Port              int    `envconfig:"PORT" required:"true"`
-	Environment       string `envconfig:"ENVIRONMENT" default:"development"`
-	TicketsResetTime  string `envconfig:"TICKETS_RESET_TIME" required:"true"`
-	ServiceDSN        string `envconfig:"SERVICE_DSN" required:"true"`
-	RabbitMQURL       string `envconfig:"RABBITMQ_URL" required:"true"`
-	JWTIssuer         string `envconfig:"JWT_ISSUER" required:"true"`
-	JWTSecret         string `envconfig:"JWT_SECRET" required:"true"`
-	Company           string `envconfig:"COMPANY"`
-	SMSSenderID       string `envconfig:"SMS_SENDER_ID"`
-	SMSSenderUsername string `envconfig:"SMS_SENDER_USERNAME"`
-	SMSSenderPassword string `envconfig:"SMS_SENDER_PASSWORD"`
+	Port                 int           `envconfig:"PORT" required:"true"`
+	Environment          string        `envconfig:"ENVIRONMENT" default:"development"`
+	TicketsResetTime     string        `envconfig:"TICKETS_RESET_TIME" required:"true"`
+	ServiceDSN           string        `envconfig:"SERVICE_DSN" required:"true"`
+	AutoMigrate          bool          `envconfig:"AUTO_MIGRATE" default:"false"`
+	MigrationLockTimeout time.Duration `envconfig:"MIGRATION_LOCK_TIMEOUT" default:"1m"`
+	RabbitMQURL          string        `envconfig:"RABBITMQ_URL" required:"true"`
+	JWTIssuer            string        `envconfig:"JWT_ISSUER" required:"true"`
+	JWTSecret            string        `envconfig:"JWT_SECRET" required:"true"`
+	NotifyClosedQueue    bool          `envconfig:"NOTIFY_CLOSED_QUEUE" default:"false"`
+	RequireDeviceKey     bool          `envconfig:"REQUIRE_DEVICE_KEY" default:"false"`
+	TicketStatusURL      string        `envconfig:"TICKET_STATUS_URL"`
+	TicketWidth          int           `envconfig:"TICKET_WIDTH" default:"42"`
+	DefaultCountry       string        `envconfig:"DEFAULT_COUNTRY" default:"GH"`
+	IdempotencyRetention time.Duration `envconfig:"IDEMPOTENCY_RETENTION" default:"24h"`
+	QueryTimeout         time.Duration `envconfig:"QUERY_TIMEOUT" default:"10s"`
+	MaxTicketsPerQueue   int           `envconfig:"MAX_TICKETS_PER_QUEUE" default:"1"`
+	MaxTicketsPerBranch  int           `envconfig:"MAX_TICKETS_PER_BRANCH" default:"0"`
+	RateLimitPerIP       int           `envconfig:"RATE_LIMIT_PER_IP" default:"30"`
+	RateLimitPerDevice   int           `envconfig:"RATE_LIMIT_PER_DEVICE" default:"120"`
+	RateLimitPerMsisdn   int           `envconfig:"RATE_LIMIT_PER_MSISDN" default:"3"`
+	EventStreamDuration  time.Duration `envconfig:"EVENT_STREAM_DURATION" default:"25s"`
+	TrustedProxies       []string      `envconfig:"TRUSTED_PROXIES"`
+	Company              string        `envconfig:"COMPANY"`
+	SMSSenderID          string        `envconfig:"SMS_SENDER_ID"`
+	SMSSenderUsername    string        `envconfig:"SMS_SENDER_USERNAME"`
+	SMSSenderPassword    string        `envconfig:"SMS_SENDER_PASSWORD"`
 }{}
 
-func init() {
-	err := envconfig.Process("", &env)
-	if err != nil {
-		failOnError("failed loading configurations", err)
-	}
-}
-
 func initLogger(environment string) (*zap.Logger, error) {
 	if environment == production {
 		return zap.NewProduction()
@@ -58,46 +71,137 @@ func initLogger(environment string) (*zap.Logger, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	err := envconfig.Process("", &env)
+	failOnError("failed loading configurations", err)
+
 	logger, err := initLogger(env.Environment)
 	failOnError("failed initializing logger", err)
 
+	if !phone.ValidRegion(env.DefaultCountry) {
+		failOnError("failed loading configurations", fmt.Errorf("unknown DEFAULT_COUNTRY %q", env.DefaultCountry))
+	}
+
 	if env.Environment == development {
 		logger.Info("configurations loaded successfully", zap.Any("configs", env))
 	}
 
+	db.QueryTimeout = env.QueryTimeout
+
+	// ctx is cancelled on shutdown, stopping the background
+	// jobs and the requests still running once the server
+	// has stopped waiting for them
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	brokerConn, err := amqp.Dial(env.RabbitMQURL)
 	failOnError("failed connecting to rabbitmq", err)
 	defer brokerConn.Close()
 
 	logger.Info("connected to rabbitmq successfully")
 
-	dbConn, err := sqlx.Open("mysql", env.ServiceDSN)
-	failOnError("failed connecting to mysql", err)
+	dbConn, err := db.Open(env.ServiceDSN)
+	failOnError("failed connecting to database", err)
 	defer dbConn.Close()
 
-	err = dbConn.Ping()
-	failOnError("failed pinging mysql", err)
+	err = dbConn.PingContext(ctx)
+	failOnError("failed pinging database", err)
+
+	logger.Info("connected to database successfully", zap.String("driver", dbConn.DriverName()))
+
+	if env.AutoMigrate {
+		migrator, err := newMigrator(dbConn, env.MigrationLockTimeout)
+		failOnError("failed loading migrations", err)
 
-	logger.Info("connected to mysql successfully")
+		applied, err := migrator.Up(ctx)
+		failOnError("failed applying migrations", err)
+
+		for _, m := range applied {
+			logger.Info("applied migration", zap.Int("version", m.Version), zap.String("name", m.Name))
+		}
+	}
 
 	dbConn.SetConnMaxLifetime(time.Second * 14400)
 	dbConn.SetMaxIdleConns(50)
 	dbConn.SetMaxOpenConns(100)
 
-	queuesRepo := db.NewQueuesRepo(dbConn)
-	queues, err := queuesRepo.GetAll()
+	publisher := app.NewSMSPublisher(brokerConn)
+	rubix := app.NewRubix(publisher, logger)
+
+	// instances sharing the database number tickets and call
+	// customers through it, so several can run side by side
+	rubix.SetCoordinator(db.NewCoordinator(dbConn))
+
+	branches, err := db.NewBranchesRepo(dbConn).GetAll(ctx)
+	failOnError("failed fetching branches", err)
+
+	for _, branch := range branches {
+		resetTime := env.TicketsResetTime
+		if branch.TicketsResetTime != nil {
+			resetTime = *branch.TicketsResetTime
+		}
+
+		location, err := time.LoadLocation(branch.Timezone)
+		failOnError(fmt.Sprintf("failed loading timezone of branch %d", branch.ID), err)
+
+		err = rubix.AddBranch(branch.ID, resetTime, location)
+		failOnError(fmt.Sprintf("failed registering branch %d", branch.ID), err)
+	}
+
+	stores := db.NewStores(dbConn)
+	queues, err := stores.Queues.GetAll(ctx)
 	failOnError("failed fetching active queues", err)
 
-	waitLists := map[int64]*app.WaitList{}
 	for _, queue := range queues {
-		waitLists[queue.ID] = app.NewWaitList()
+		if queue.Status == app.QueueArchived {
+			err = rubix.ArchiveQueue(queue.ID)
+		} else {
+			err = rubix.SetQueueStatus(queue.ID, queue.BranchID, queue.Status)
+			rubix.SetQueueActive(queue.ID, queue.IsActive)
+		}
+		failOnError(fmt.Sprintf("failed registering queue %d", queue.ID), err)
 	}
-
-	publisher := app.NewSMSPublisher(brokerConn)
-	rubix := app.NewRubix(waitLists, publisher, logger)
 	config := app.NewSmsGatewayConfig(env.SMSSenderID, env.SMSSenderUsername, env.SMSSenderPassword)
 	rubix.RegisterSMSWorker(app.NewNandiSMSWorker(brokerConn, config, logger))
 
+	unserved, err := stores.Customers.GetUnserved(ctx)
+	failOnError("failed fetching unserved customers", err)
+	rubix.Rehydrate(waitingCustomers(rubix, unserved, time.Now()))
+
+	err = rubix.ResumeTickets(ctx)
+	failOnError("failed resuming ticket sequences", err)
+
+	// changes from here on are shared with the other instances,
+	// which each registered the same branches and queues
+	fanout := app.NewEventFanout(brokerConn, logger)
+	rubix.SetBroadcaster(fanout)
+	fanout.Run(rubix, func() error {
+		at := time.Now()
+		unserved, err := stores.Customers.GetUnserved(ctx)
+		if err != nil {
+			return err
+		}
+
+		rubix.Resync(waitingCustomers(rubix, unserved, at), at)
+		return nil
+	})
+
+	// queues left draining with nobody waiting are closed now,
+	// as no call will come to archive them
+	err = api.ArchiveDrainedQueues(ctx, rubix, stores.Queues)
+	failOnError("failed archiving drained queues", err)
+
+	go rubix.RunResetScheduler(ctx, time.Minute)
+	go archiveDrainedQueues(ctx, rubix, stores.Queues, time.Minute, logger)
+	go purgeIdempotencyKeys(ctx, db.NewIdempotencyRepo(dbConn), time.Hour, logger)
+
+	err = metrics.Register(rubix, dbConn.DB)
+	failOnError("failed registering metrics", err)
+
 	listener, err := net.Listen("tcp4", fmt.Sprintf(":%d", env.Port))
 	if err != nil {
 		logger.Fatal("failed binding to port", zap.Int("port", env.Port))
@@ -107,11 +211,32 @@ func main() {
 	url := fmt.Sprintf("http://%s", listener.Addr())
 	logger.Info("server listening on ", zap.String("url", url))
 
+	trustedProxies, err := api.ParseTrustedProxies(env.TrustedProxies)
+	failOnError("failed parsing trusted proxies", err)
+
 	router := api.InitRoutes(
 		rubix,
 		brokerConn,
 		dbConn,
 		&websocket.Upgrader{},
+		api.Config{
+			JWTIssuer:            env.JWTIssuer,
+			JWTSecret:            env.JWTSecret,
+			TicketsResetTime:     env.TicketsResetTime,
+			NotifyClosedQueue:    env.NotifyClosedQueue,
+			RequireDeviceKey:     env.RequireDeviceKey,
+			TicketStatusURL:      env.TicketStatusURL,
+			TicketWidth:          env.TicketWidth,
+			DefaultCountry:       env.DefaultCountry,
+			IdempotencyRetention: env.IdempotencyRetention,
+			MaxTicketsPerQueue:   env.MaxTicketsPerQueue,
+			MaxTicketsPerBranch:  env.MaxTicketsPerBranch,
+			RateLimitPerIP:       env.RateLimitPerIP,
+			RateLimitPerDevice:   env.RateLimitPerDevice,
+			RateLimitPerMsisdn:   env.RateLimitPerMsisdn,
+			EventStreamDuration:  env.EventStreamDuration,
+			TrustedProxies:       trustedProxies,
+		},
 		logger,
 	)
 
@@ -119,9 +244,14 @@ func main() {
 		ReadHeaderTimeout: 30 * time.Second,
 		ReadTimeout:       30 * time.Second,
 		WriteTimeout:      30 * time.Second,
-		Handler:           handlers.CORS(handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}), handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "OPTIONS"}), handlers.AllowedOrigins([]string{"*"}))(router),
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		Handler:           handlers.CORS(handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "Idempotency-Key", "Last-Event-ID"}), handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "OPTIONS"}), handlers.AllowedOrigins([]string{"*"}))(router),
 	}
 
+	// streams of events would otherwise keep the
+	// server from shutting down until they end
+	server.RegisterOnShutdown(rubix.Events().Close)
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
@@ -132,11 +262,12 @@ func main() {
 		recv := <-sigs
 		logger.Info("received signal, shutting down", zap.Any("signal", recv.String))
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := server.Shutdown(ctx); err != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		if err := server.Shutdown(shutdownCtx); err != nil {
 			logger.Warn("error shutting down server", zap.Error(err))
 		}
+		cancel()
 	}()
 
 	if err = server.Serve(listener); err != nil {
@@ -149,6 +280,69 @@ func main() {
 	logger.Info("server shutdown successfully")
 }
 
+// waitingCustomers groups unserved customers by queue in the order
+// in which they joined. Customers who joined before their branch's
+// last reset went home unserved and are left out
+func waitingCustomers(rubix *app.Rubix, customers []*db.Customer, now time.Time) map[int64][]*app.CustomerInfo {
+	sort.Slice(customers, func(i, j int) bool {
+		return customers[i].ID < customers[j].ID
+	})
+
+	waiting := map[int64][]*app.CustomerInfo{}
+	for _, c := range customers {
+		info := &app.CustomerInfo{ID: c.ID, Msisdn: c.Msisdn, Ticket: c.Ticket}
+		if c.CreatedAt != nil {
+			info.JoinedAt = *c.CreatedAt
+		}
+
+		if reset, ok := rubix.LastReset(c.BranchID, now); ok && info.JoinedAt.Before(reset) {
+			continue
+		}
+		waiting[c.QueueID] = append(waiting[c.QueueID], info)
+	}
+
+	return waiting
+}
+
+// purgeIdempotencyKeys deletes expired idempotency keys
+// every interval until ctx is done
+func purgeIdempotencyKeys(ctx context.Context, repo *db.IdempotencyRepo, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := repo.DeleteExpired(ctx, now)
+			if err != nil {
+				logger.Warn("failed purging expired idempotency keys", zap.Error(err))
+				continue
+			}
+			logger.Debug("purged expired idempotency keys", zap.Int64("count", n))
+		}
+	}
+}
+
+// archiveDrainedQueues retries archiving the drained queues that
+// could not be archived when their last customer was called
+func archiveDrainedQueues(ctx context.Context, rubix *app.Rubix, queues db.QueueStore, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := api.ArchiveDrainedQueues(ctx, rubix, queues); err != nil {
+				logger.Warn("failed archiving drained queues", zap.Error(err))
+			}
+		}
+	}
+}
+
 func failOnError(msg string, err error) {
 	if err != nil {
 		log.Fatalf("%s : %v", msg, err)
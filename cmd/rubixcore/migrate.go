@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hackstock/rubixcore/migrations"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/hackstock/rubixcore/pkg/migrate"
+	"github.com/jmoiron/sqlx"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const migrateUsage = `usage: rubixcore migrate <command>
+
+commands:
+  up                 apply every pending migration
+  down [-steps N]    roll back the last N migrations (default 1)
+  status             list migrations and when they were applied
+  baseline VERSION   record migrations up to VERSION as applied
+                     without running them, for databases that
+                     were migrated by hand`
+
+var migrateEnv = struct {
+	ServiceDSN           string        `envconfig:"SERVICE_DSN" required:"true"`
+	MigrationLockTimeout time.Duration `envconfig:"MIGRATION_LOCK_TIMEOUT" default:"1m"`
+}{}
+
+// newMigrator returns a migrator for the migrations embedded
+// in the binary for the driver of dbConn
+func newMigrator(dbConn *sqlx.DB, lockTimeout time.Duration) (*migrate.Migrator, error) {
+	files, err := migrations.For(dbConn.DriverName())
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := migrate.Load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.NewMigrator(dbConn.DB, dbConn.DriverName(), all, lockTimeout), nil
+}
+
+// runMigrate runs the migrate subcommand
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	err := envconfig.Process("", &migrateEnv)
+	failOnError("failed loading configurations", err)
+
+	dbConn, err := db.Open(migrateEnv.ServiceDSN)
+	failOnError("failed connecting to database", err)
+	defer dbConn.Close()
+
+	migrator, err := newMigrator(dbConn, migrateEnv.MigrationLockTimeout)
+	failOnError("failed loading migrations", err)
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		printMigrations("applied", done)
+		failOnError("failed applying migrations", err)
+
+	case "down":
+		flags := flag.NewFlagSet("down", flag.ExitOnError)
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		flags.Parse(args[1:])
+
+		done, err := migrator.Down(ctx, *steps)
+		printMigrations("rolled back", done)
+		failOnError("failed rolling back migrations", err)
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		failOnError("failed fetching migration status", err)
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%02d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		tw.Flush()
+
+	case "baseline":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+
+		version, err := strconv.Atoi(args[1])
+		failOnError("invalid baseline version", err)
+
+		done, err := migrator.Baseline(ctx, version)
+		printMigrations("baselined", done)
+		failOnError("failed baselining migrations", err)
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
+
+func printMigrations(verb string, done []*migrate.Migration) {
+	if len(done) == 0 {
+		fmt.Printf("no migrations %s\n", verb)
+		return
+	}
+
+	for _, m := range done {
+		fmt.Printf("%s %02d_%s\n", verb, m.Version, m.Name)
+	}
+}
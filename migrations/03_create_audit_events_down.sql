@@ -0,0 +1,4 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-audit-events
+DROP TABLE IF EXISTS audit_events;
\ No newline at end of file
@@ -0,0 +1,37 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-audit-events
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    actor_id        INT            NULL,
+    actor           VARCHAR(255)   NOT NULL,
+    action          VARCHAR(255)   NOT NULL,
+    target_type     VARCHAR(255)   NOT NULL,
+    target_id       VARCHAR(255)   NOT NULL,
+    before_state    TEXT           NULL,
+    after_state     TEXT           NULL,
+    ip_address      VARCHAR(45)    NOT NULL,
+    method          VARCHAR(10)    NOT NULL,
+    path            VARCHAR(255)   NOT NULL,
+    status_code     INT            NOT NULL,
+    created_at      DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(id)
+);
+
+-- name: create-audit-events-actor-index
+CREATE INDEX audit_events_actor_index ON audit_events(actor);
+
+-- name: create-audit-events-target-index
+CREATE INDEX audit_events_target_index ON audit_events(target_type, target_id);
+
+-- name: create-audit-events-created-at-index
+CREATE INDEX audit_events_created_at_index ON audit_events(created_at);
+
+-- name: prevent-audit-events-update
+CREATE TRIGGER audit_events_prevent_update BEFORE UPDATE ON audit_events
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+
+-- name: prevent-audit-events-delete
+CREATE TRIGGER audit_events_prevent_delete BEFORE DELETE ON audit_events
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
@@ -0,0 +1,16 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-user-accounts-branch-id
+ALTER TABLE user_accounts DROP FOREIGN KEY fk_user_accounts_branch_id, DROP COLUMN branch_id;
+
+-- name: remove-customers-branch-id
+ALTER TABLE customers DROP FOREIGN KEY fk_customers_branch_id, DROP COLUMN branch_id;
+
+-- name: restore-queues-name-index
+ALTER TABLE queues DROP FOREIGN KEY fk_queues_branch_id, DROP INDEX queues_branch_name_index, ADD UNIQUE INDEX queues_name_index (name);
+
+-- name: remove-queues-branch-id
+ALTER TABLE queues DROP COLUMN branch_id;
+
+-- name: remove-branches
+DROP TABLE IF EXISTS branches;
@@ -0,0 +1,40 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-branches
+CREATE TABLE IF NOT EXISTS branches
+(
+    id                  INT            NOT NULL     AUTO_INCREMENT,
+    name                VARCHAR(255)   NOT NULL,
+    tickets_reset_time  VARCHAR(5)     NULL,
+    timezone            VARCHAR(64)    NOT NULL     DEFAULT 'UTC',
+    created_at          DATETIME       DEFAULT NOW(),
+    updated_at          TIMESTAMP      NULL,
+    PRIMARY KEY(id)
+);
+
+-- name: create-branches-name-index
+CREATE UNIQUE INDEX branches_name_index ON branches(name);
+
+-- name: create-default-branch
+INSERT INTO branches (id, name) VALUES (1, 'Main Branch');
+
+-- name: add-queues-branch-id
+ALTER TABLE queues ADD COLUMN branch_id INT NOT NULL DEFAULT 1 AFTER id;
+
+-- name: add-queues-branch-id-foreign-key
+ALTER TABLE queues ADD CONSTRAINT fk_queues_branch_id FOREIGN KEY (branch_id) REFERENCES branches(id);
+
+-- name: replace-queues-name-index
+ALTER TABLE queues DROP INDEX queues_name_index, ADD UNIQUE INDEX queues_branch_name_index (branch_id, name);
+
+-- name: add-customers-branch-id
+ALTER TABLE customers ADD COLUMN branch_id INT NOT NULL DEFAULT 1 AFTER id;
+
+-- name: add-customers-branch-id-foreign-key
+ALTER TABLE customers ADD CONSTRAINT fk_customers_branch_id FOREIGN KEY (branch_id) REFERENCES branches(id);
+
+-- name: add-user-accounts-branch-id
+ALTER TABLE user_accounts ADD COLUMN branch_id INT NULL AFTER id;
+
+-- name: add-user-accounts-branch-id-foreign-key
+ALTER TABLE user_accounts ADD CONSTRAINT fk_user_accounts_branch_id FOREIGN KEY (branch_id) REFERENCES branches(id);
@@ -0,0 +1,7 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-appointments
+DROP TABLE IF EXISTS appointments;
+
+-- name: remove-appointment-slots
+DROP TABLE IF EXISTS appointment_slots;
@@ -0,0 +1,7 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-queue-closures
+DROP TABLE IF EXISTS queue_closures;
+
+-- name: remove-queue-hours
+DROP TABLE IF EXISTS queue_hours;
@@ -0,0 +1,33 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-queue-hours
+CREATE TABLE IF NOT EXISTS queue_hours
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    queue_id        INT            NOT NULL,
+    weekday         TINYINT        NOT NULL,
+    opens_at        VARCHAR(5)     NOT NULL,
+    closes_at       VARCHAR(5)     NOT NULL,
+    last_admission  VARCHAR(5)     NULL,
+    PRIMARY KEY(id),
+    CONSTRAINT fk_queue_hours_queue_id  FOREIGN KEY  (queue_id)     REFERENCES queues(id)
+);
+
+-- name: create-queue-hours-queue-weekday-index
+CREATE UNIQUE INDEX queue_hours_queue_weekday_index ON queue_hours(queue_id, weekday);
+
+-- name: create-queue-closures
+CREATE TABLE IF NOT EXISTS queue_closures
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    queue_id        INT            NOT NULL,
+    starts_on       DATE           NOT NULL,
+    ends_on         DATE           NOT NULL,
+    reason          VARCHAR(255)   NOT NULL     DEFAULT '',
+    created_at      DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(id),
+    CONSTRAINT fk_queue_closures_queue_id  FOREIGN KEY  (queue_id)     REFERENCES queues(id)
+);
+
+-- name: create-queue-closures-queue-index
+CREATE INDEX queue_closures_queue_index ON queue_closures(queue_id, ends_on);
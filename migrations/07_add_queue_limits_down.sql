@@ -0,0 +1,11 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-customers-redirected-from-queue-id
+ALTER TABLE customers DROP FOREIGN KEY fk_customers_redirected_from_queue_id, DROP COLUMN redirected_from_queue_id;
+
+-- name: remove-queues-limits
+ALTER TABLE queues
+    DROP FOREIGN KEY fk_queues_overflow_queue_id,
+    DROP COLUMN overflow_queue_id,
+    DROP COLUMN max_wait_minutes,
+    DROP COLUMN max_length;
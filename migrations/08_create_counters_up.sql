@@ -0,0 +1,30 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-counters
+CREATE TABLE IF NOT EXISTS counters
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    branch_id       INT            NOT NULL,
+    name            VARCHAR(255)   NOT NULL,
+    strategy        VARCHAR(32)    NOT NULL     DEFAULT 'longest_wait',
+    is_active       BOOLEAN        DEFAULT TRUE,
+    created_at      DATETIME       DEFAULT NOW(),
+    updated_at      TIMESTAMP      NULL,
+    PRIMARY KEY(id),
+    CONSTRAINT fk_counters_branch_id  FOREIGN KEY  (branch_id)    REFERENCES branches(id)
+);
+
+-- name: create-counters-branch-name-index
+CREATE UNIQUE INDEX counters_branch_name_index ON counters(branch_id, name);
+
+-- name: create-counter-queues
+CREATE TABLE IF NOT EXISTS counter_queues
+(
+    counter_id      INT            NOT NULL,
+    queue_id        INT            NOT NULL,
+    weight          INT            NOT NULL     DEFAULT 1,
+    priority        INT            NOT NULL     DEFAULT 0,
+    PRIMARY KEY(counter_id, queue_id),
+    CONSTRAINT fk_counter_queues_counter_id  FOREIGN KEY  (counter_id)   REFERENCES counters(id) ON DELETE CASCADE,
+    CONSTRAINT fk_counter_queues_queue_id    FOREIGN KEY  (queue_id)     REFERENCES queues(id)
+);
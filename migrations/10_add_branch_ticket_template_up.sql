@@ -0,0 +1,4 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: add-branches-ticket-template
+ALTER TABLE branches ADD COLUMN ticket_template TEXT NULL AFTER timezone;
@@ -0,0 +1,6 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: add-queues-status
+ALTER TABLE queues
+    ADD COLUMN status        VARCHAR(16)   NOT NULL  DEFAULT 'open'  AFTER is_active,
+    ADD COLUMN archived_at   DATETIME      NULL                      AFTER updated_at;
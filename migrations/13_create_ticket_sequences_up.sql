@@ -0,0 +1,11 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-ticket-sequences
+CREATE TABLE IF NOT EXISTS ticket_sequences
+(
+    branch_id           INT            NOT NULL,
+    next_number         INT            NOT NULL     DEFAULT 1,
+    reset_at            DATETIME       NULL,
+    PRIMARY KEY(branch_id),
+    CONSTRAINT fk_ticket_sequences_branch_id FOREIGN KEY (branch_id) REFERENCES branches(id)
+);
@@ -0,0 +1,37 @@
+// Package migrations embeds the SQL migrations of the database
+// schema so they ship inside the binary. Files are named
+// NN_description_up.sql and NN_description_down.sql, and each
+// statement in them is introduced by a '-- name:' comment.
+//
+// MySQL migrations live at the root and their Postgres versions,
+// under the same names, in postgres/. SQLite databases start from
+// the schema in sqlite/, which matches the MySQL schema as of
+// migration 11; later changes need a migration in all three places.
+// The SQLite bundled with the driver cannot drop columns, so SQLite
+// migrations that add columns have no down file
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+// Files holds every migration file
+//
+//go:embed *.sql postgres/*.sql sqlite/*.sql
+var Files embed.FS
+
+// For returns the migrations for databases opened with a driver
+func For(driver string) (fs.FS, error) {
+	switch driver {
+	case "mysql":
+		return Files, nil
+	case "postgres":
+		return fs.Sub(Files, "postgres")
+	case "sqlite3":
+		return fs.Sub(Files, "sqlite")
+	}
+
+	return nil, fmt.Errorf("no migrations for driver %q", driver)
+}
@@ -0,0 +1,16 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-user-accounts
+CREATE TABLE IF NOT EXISTS user_accounts
+(
+    id              SERIAL         PRIMARY KEY,
+    username        VARCHAR(255)   NOT NULL,
+    password        VARCHAR(255)   NOT NULL,
+    is_admin        BOOLEAN        DEFAULT TRUE,
+    created_at      TIMESTAMP      DEFAULT CURRENT_TIMESTAMP,
+    last_login_at   TIMESTAMP      NULL,
+    updated_at      TIMESTAMP      NULL
+);
+
+-- name: create-username-index
+CREATE UNIQUE INDEX user_accounts_username_index ON user_accounts(username);
@@ -0,0 +1,4 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-queues
+DROP TABLE IF EXISTS queues;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-queues
+CREATE TABLE IF NOT EXISTS queues
+(
+    id              SERIAL         PRIMARY KEY,
+    name            VARCHAR(255)   NOT NULL,
+    description     VARCHAR(255)   NOT NULL,
+    is_active       BOOLEAN        DEFAULT TRUE,
+    created_at      TIMESTAMP      DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP      NULL
+);
+
+-- name: create-queues-name-index
+CREATE UNIQUE INDEX queues_name_index ON queues(name);
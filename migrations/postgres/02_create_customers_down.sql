@@ -0,0 +1,4 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-customers
+DROP TABLE IF EXISTS customers;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-audit-events
+DROP TABLE IF EXISTS audit_events;
+
+-- name: remove-audit-events-append-only-function
+DROP FUNCTION IF EXISTS audit_events_append_only();
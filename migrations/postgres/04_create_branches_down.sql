@@ -0,0 +1,19 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-user-accounts-branch-id
+ALTER TABLE user_accounts DROP COLUMN branch_id;
+
+-- name: remove-customers-branch-id
+ALTER TABLE customers DROP COLUMN branch_id;
+
+-- name: remove-queues-branch-name-index
+DROP INDEX queues_branch_name_index;
+
+-- name: remove-queues-branch-id
+ALTER TABLE queues DROP COLUMN branch_id;
+
+-- name: restore-queues-name-index
+CREATE UNIQUE INDEX queues_name_index ON queues(name);
+
+-- name: remove-branches
+DROP TABLE IF EXISTS branches;
@@ -0,0 +1,45 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-branches
+CREATE TABLE IF NOT EXISTS branches
+(
+    id                  SERIAL         PRIMARY KEY,
+    name                VARCHAR(255)   NOT NULL,
+    tickets_reset_time  VARCHAR(5)     NULL,
+    timezone            VARCHAR(64)    NOT NULL     DEFAULT 'UTC',
+    created_at          TIMESTAMP      DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP      NULL
+);
+
+-- name: create-branches-name-index
+CREATE UNIQUE INDEX branches_name_index ON branches(name);
+
+-- name: create-default-branch
+INSERT INTO branches (id, name) VALUES (1, 'Main Branch');
+
+-- name: advance-branches-id-sequence
+SELECT setval(pg_get_serial_sequence('branches', 'id'), 1);
+
+-- name: add-queues-branch-id
+ALTER TABLE queues ADD COLUMN branch_id INT NOT NULL DEFAULT 1;
+
+-- name: add-queues-branch-id-foreign-key
+ALTER TABLE queues ADD CONSTRAINT fk_queues_branch_id FOREIGN KEY (branch_id) REFERENCES branches(id);
+
+-- name: drop-queues-name-index
+DROP INDEX queues_name_index;
+
+-- name: create-queues-branch-name-index
+CREATE UNIQUE INDEX queues_branch_name_index ON queues(branch_id, name);
+
+-- name: add-customers-branch-id
+ALTER TABLE customers ADD COLUMN branch_id INT NOT NULL DEFAULT 1;
+
+-- name: add-customers-branch-id-foreign-key
+ALTER TABLE customers ADD CONSTRAINT fk_customers_branch_id FOREIGN KEY (branch_id) REFERENCES branches(id);
+
+-- name: add-user-accounts-branch-id
+ALTER TABLE user_accounts ADD COLUMN branch_id INT NULL;
+
+-- name: add-user-accounts-branch-id-foreign-key
+ALTER TABLE user_accounts ADD CONSTRAINT fk_user_accounts_branch_id FOREIGN KEY (branch_id) REFERENCES branches(id);
@@ -0,0 +1,43 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-appointment-slots
+CREATE TABLE IF NOT EXISTS appointment_slots
+(
+    id              SERIAL         PRIMARY KEY,
+    queue_id        INT            NOT NULL,
+    weekday         SMALLINT       NOT NULL,
+    start_time      VARCHAR(5)     NOT NULL,
+    end_time        VARCHAR(5)     NOT NULL,
+    capacity        INT            NOT NULL,
+    created_at      TIMESTAMP      DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_appointment_slots_queue_id  FOREIGN KEY  (queue_id)     REFERENCES queues(id)
+);
+
+-- name: create-appointment-slots-queue-index
+CREATE INDEX appointment_slots_queue_index ON appointment_slots(queue_id, weekday);
+
+-- name: create-appointments
+CREATE TABLE IF NOT EXISTS appointments
+(
+    id              SERIAL         PRIMARY KEY,
+    branch_id       INT            NOT NULL,
+    queue_id        INT            NOT NULL,
+    slot_id         INT            NOT NULL,
+    msisdn          VARCHAR(255)   NOT NULL,
+    starts_at       TIMESTAMP      NOT NULL,
+    ends_at         TIMESTAMP      NOT NULL,
+    status          VARCHAR(16)    NOT NULL     DEFAULT 'booked',
+    customer_id     INT            NULL,
+    created_at      TIMESTAMP      DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP      NULL,
+    CONSTRAINT fk_appointments_branch_id    FOREIGN KEY  (branch_id)    REFERENCES branches(id),
+    CONSTRAINT fk_appointments_queue_id     FOREIGN KEY  (queue_id)     REFERENCES queues(id),
+    CONSTRAINT fk_appointments_slot_id      FOREIGN KEY  (slot_id)      REFERENCES appointment_slots(id),
+    CONSTRAINT fk_appointments_customer_id  FOREIGN KEY  (customer_id)  REFERENCES customers(id)
+);
+
+-- name: create-appointments-slot-index
+CREATE INDEX appointments_slot_index ON appointments(slot_id, starts_at, status);
+
+-- name: create-appointments-msisdn-index
+CREATE INDEX appointments_msisdn_index ON appointments(msisdn);
@@ -0,0 +1,10 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-customers-redirected-from-queue-id
+ALTER TABLE customers DROP COLUMN redirected_from_queue_id;
+
+-- name: remove-queues-limits
+ALTER TABLE queues
+    DROP COLUMN overflow_queue_id,
+    DROP COLUMN max_wait_minutes,
+    DROP COLUMN max_length;
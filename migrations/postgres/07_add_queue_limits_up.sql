@@ -0,0 +1,16 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: add-queues-limits
+ALTER TABLE queues
+    ADD COLUMN max_length         INT   NULL,
+    ADD COLUMN max_wait_minutes   INT   NULL,
+    ADD COLUMN overflow_queue_id  INT   NULL;
+
+-- name: add-queues-overflow-queue-id-foreign-key
+ALTER TABLE queues ADD CONSTRAINT fk_queues_overflow_queue_id FOREIGN KEY (overflow_queue_id) REFERENCES queues(id);
+
+-- name: add-customers-redirected-from-queue-id
+ALTER TABLE customers ADD COLUMN redirected_from_queue_id INT NULL;
+
+-- name: add-customers-redirected-from-queue-id-foreign-key
+ALTER TABLE customers ADD CONSTRAINT fk_customers_redirected_from_queue_id FOREIGN KEY (redirected_from_queue_id) REFERENCES queues(id);
@@ -0,0 +1,7 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-counter-queues
+DROP TABLE IF EXISTS counter_queues;
+
+-- name: remove-counters
+DROP TABLE IF EXISTS counters;
@@ -0,0 +1,4 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-devices
+DROP TABLE IF EXISTS devices;
@@ -0,0 +1,21 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-devices
+CREATE TABLE IF NOT EXISTS devices
+(
+    id              SERIAL         PRIMARY KEY,
+    branch_id       INT            NOT NULL,
+    name            VARCHAR(255)   NOT NULL,
+    kind            VARCHAR(16)    NOT NULL,
+    key_prefix      VARCHAR(16)    NOT NULL,
+    key_hash        VARCHAR(255)   NOT NULL,
+    is_revoked      BOOLEAN        DEFAULT FALSE,
+    last_seen_at    TIMESTAMP      NULL,
+    last_seen_ip    VARCHAR(64)    NULL,
+    created_at      TIMESTAMP      DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP      NULL,
+    CONSTRAINT fk_devices_branch_id  FOREIGN KEY  (branch_id)    REFERENCES branches(id)
+);
+
+-- name: create-devices-key-prefix-index
+CREATE UNIQUE INDEX devices_key_prefix_index ON devices(key_prefix);
@@ -0,0 +1,4 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-branches-ticket-template
+ALTER TABLE branches DROP COLUMN ticket_template;
@@ -0,0 +1,21 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-idempotency-keys
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    id                  SERIAL         PRIMARY KEY,
+    scope               VARCHAR(64)    NOT NULL,
+    idempotency_key     VARCHAR(255)   NOT NULL,
+    request_hash        CHAR(64)       NOT NULL,
+    status_code         INT            NULL,
+    content_type        VARCHAR(255)   NULL,
+    response_body       BYTEA          NULL,
+    created_at          TIMESTAMP      DEFAULT CURRENT_TIMESTAMP,
+    expires_at          TIMESTAMP      NOT NULL
+);
+
+-- name: create-idempotency-keys-scope-key-index
+CREATE UNIQUE INDEX idempotency_keys_scope_key_index ON idempotency_keys(scope, idempotency_key);
+
+-- name: create-idempotency-keys-expires-at-index
+CREATE INDEX idempotency_keys_expires_at_index ON idempotency_keys(expires_at);
@@ -0,0 +1,6 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-queues-status
+ALTER TABLE queues
+    DROP COLUMN archived_at,
+    DROP COLUMN status;
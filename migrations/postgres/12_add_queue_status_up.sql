@@ -0,0 +1,6 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: add-queues-status
+ALTER TABLE queues
+    ADD COLUMN status        VARCHAR(16)   NOT NULL  DEFAULT 'open',
+    ADD COLUMN archived_at   TIMESTAMP     NULL;
@@ -0,0 +1,9 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-ticket-sequences
+CREATE TABLE IF NOT EXISTS ticket_sequences
+(
+    branch_id           INT            PRIMARY KEY  REFERENCES branches(id),
+    next_number         INT            NOT NULL     DEFAULT 1,
+    reset_at            TIMESTAMP      NULL
+);
@@ -0,0 +1,40 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-idempotency-keys
+DROP TABLE IF EXISTS idempotency_keys;
+
+-- name: remove-devices
+DROP TABLE IF EXISTS devices;
+
+-- name: remove-counter-queues
+DROP TABLE IF EXISTS counter_queues;
+
+-- name: remove-counters
+DROP TABLE IF EXISTS counters;
+
+-- name: remove-queue-closures
+DROP TABLE IF EXISTS queue_closures;
+
+-- name: remove-queue-hours
+DROP TABLE IF EXISTS queue_hours;
+
+-- name: remove-appointments
+DROP TABLE IF EXISTS appointments;
+
+-- name: remove-appointment-slots
+DROP TABLE IF EXISTS appointment_slots;
+
+-- name: remove-audit-events
+DROP TABLE IF EXISTS audit_events;
+
+-- name: remove-customers
+DROP TABLE IF EXISTS customers;
+
+-- name: remove-queues
+DROP TABLE IF EXISTS queues;
+
+-- name: remove-user-accounts
+DROP TABLE IF EXISTS user_accounts;
+
+-- name: remove-branches
+DROP TABLE IF EXISTS branches;
@@ -0,0 +1,237 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-branches
+CREATE TABLE IF NOT EXISTS branches
+(
+    id                  INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    name                VARCHAR(255)   NOT NULL,
+    tickets_reset_time  VARCHAR(5)     NULL,
+    timezone            VARCHAR(64)    NOT NULL     DEFAULT 'UTC',
+    ticket_template     TEXT           NULL,
+    created_at          DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP      NULL
+);
+
+-- name: create-branches-name-index
+CREATE UNIQUE INDEX branches_name_index ON branches(name);
+
+-- name: create-default-branch
+INSERT INTO branches (id, name) VALUES (1, 'Main Branch');
+
+-- name: create-user-accounts
+CREATE TABLE IF NOT EXISTS user_accounts
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    branch_id       INTEGER        NULL         REFERENCES branches(id),
+    username        VARCHAR(255)   NOT NULL,
+    password        VARCHAR(255)   NOT NULL,
+    is_admin        BOOLEAN        DEFAULT TRUE,
+    created_at      DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    last_login_at   DATETIME       NULL,
+    updated_at      DATETIME       NULL
+);
+
+-- name: create-username-index
+CREATE UNIQUE INDEX user_accounts_username_index ON user_accounts(username);
+
+-- name: create-queues
+CREATE TABLE IF NOT EXISTS queues
+(
+    id                  INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    branch_id           INTEGER        NOT NULL     DEFAULT 1   REFERENCES branches(id),
+    name                VARCHAR(255)   NOT NULL,
+    description         VARCHAR(255)   NOT NULL,
+    is_active           BOOLEAN        DEFAULT TRUE,
+    max_length          INTEGER        NULL,
+    max_wait_minutes    INTEGER        NULL,
+    overflow_queue_id   INTEGER        NULL         REFERENCES queues(id),
+    created_at          DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP      NULL
+);
+
+-- name: create-queues-branch-name-index
+CREATE UNIQUE INDEX queues_branch_name_index ON queues(branch_id, name);
+
+-- name: create-customers
+CREATE TABLE IF NOT EXISTS customers
+(
+    id                          INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    branch_id                   INTEGER        NOT NULL     DEFAULT 1   REFERENCES branches(id),
+    msisdn                      VARCHAR(255)   NOT NULL,
+    ticket                      VARCHAR(255)   NOT NULL,
+    queue_id                    INTEGER        NOT NULL     REFERENCES queues(id),
+    redirected_from_queue_id    INTEGER        NULL         REFERENCES queues(id),
+    created_at                  DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    served_at                   DATETIME       NULL
+);
+
+-- name: create-customers-msisdn_index
+CREATE INDEX customers_msisdn_index ON customers(msisdn);
+
+-- name: create-audit-events
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    actor_id        INTEGER        NULL,
+    actor           VARCHAR(255)   NOT NULL,
+    action          VARCHAR(255)   NOT NULL,
+    target_type     VARCHAR(255)   NOT NULL,
+    target_id       VARCHAR(255)   NOT NULL,
+    before_state    TEXT           NULL,
+    after_state     TEXT           NULL,
+    ip_address      VARCHAR(45)    NOT NULL,
+    method          VARCHAR(10)    NOT NULL,
+    path            VARCHAR(255)   NOT NULL,
+    status_code     INTEGER        NOT NULL,
+    created_at      DATETIME       DEFAULT CURRENT_TIMESTAMP
+);
+
+-- name: create-audit-events-actor-index
+CREATE INDEX audit_events_actor_index ON audit_events(actor);
+
+-- name: create-audit-events-target-index
+CREATE INDEX audit_events_target_index ON audit_events(target_type, target_id);
+
+-- name: create-audit-events-created-at-index
+CREATE INDEX audit_events_created_at_index ON audit_events(created_at);
+
+-- name: prevent-audit-events-update
+CREATE TRIGGER audit_events_prevent_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+-- name: prevent-audit-events-delete
+CREATE TRIGGER audit_events_prevent_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+-- name: create-appointment-slots
+CREATE TABLE IF NOT EXISTS appointment_slots
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    queue_id        INTEGER        NOT NULL     REFERENCES queues(id),
+    weekday         TINYINT        NOT NULL,
+    start_time      VARCHAR(5)     NOT NULL,
+    end_time        VARCHAR(5)     NOT NULL,
+    capacity        INTEGER        NOT NULL,
+    created_at      DATETIME       DEFAULT CURRENT_TIMESTAMP
+);
+
+-- name: create-appointment-slots-queue-index
+CREATE INDEX appointment_slots_queue_index ON appointment_slots(queue_id, weekday);
+
+-- name: create-appointments
+CREATE TABLE IF NOT EXISTS appointments
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    branch_id       INTEGER        NOT NULL     REFERENCES branches(id),
+    queue_id        INTEGER        NOT NULL     REFERENCES queues(id),
+    slot_id         INTEGER        NOT NULL     REFERENCES appointment_slots(id),
+    msisdn          VARCHAR(255)   NOT NULL,
+    starts_at       DATETIME       NOT NULL,
+    ends_at         DATETIME       NOT NULL,
+    status          VARCHAR(16)    NOT NULL     DEFAULT 'booked',
+    customer_id     INTEGER        NULL         REFERENCES customers(id),
+    created_at      DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP      NULL
+);
+
+-- name: create-appointments-slot-index
+CREATE INDEX appointments_slot_index ON appointments(slot_id, starts_at, status);
+
+-- name: create-appointments-msisdn-index
+CREATE INDEX appointments_msisdn_index ON appointments(msisdn);
+
+-- name: create-queue-hours
+CREATE TABLE IF NOT EXISTS queue_hours
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    queue_id        INTEGER        NOT NULL     REFERENCES queues(id),
+    weekday         TINYINT        NOT NULL,
+    opens_at        VARCHAR(5)     NOT NULL,
+    closes_at       VARCHAR(5)     NOT NULL,
+    last_admission  VARCHAR(5)     NULL
+);
+
+-- name: create-queue-hours-queue-weekday-index
+CREATE UNIQUE INDEX queue_hours_queue_weekday_index ON queue_hours(queue_id, weekday);
+
+-- name: create-queue-closures
+CREATE TABLE IF NOT EXISTS queue_closures
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    queue_id        INTEGER        NOT NULL     REFERENCES queues(id),
+    starts_on       DATE           NOT NULL,
+    ends_on         DATE           NOT NULL,
+    reason          VARCHAR(255)   NOT NULL     DEFAULT '',
+    created_at      DATETIME       DEFAULT CURRENT_TIMESTAMP
+);
+
+-- name: create-queue-closures-queue-index
+CREATE INDEX queue_closures_queue_index ON queue_closures(queue_id, ends_on);
+
+-- name: create-counters
+CREATE TABLE IF NOT EXISTS counters
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    branch_id       INTEGER        NOT NULL     REFERENCES branches(id),
+    name            VARCHAR(255)   NOT NULL,
+    strategy        VARCHAR(32)    NOT NULL     DEFAULT 'longest_wait',
+    is_active       BOOLEAN        DEFAULT TRUE,
+    created_at      DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP      NULL
+);
+
+-- name: create-counters-branch-name-index
+CREATE UNIQUE INDEX counters_branch_name_index ON counters(branch_id, name);
+
+-- name: create-counter-queues
+CREATE TABLE IF NOT EXISTS counter_queues
+(
+    counter_id      INTEGER        NOT NULL     REFERENCES counters(id) ON DELETE CASCADE,
+    queue_id        INTEGER        NOT NULL     REFERENCES queues(id),
+    weight          INTEGER        NOT NULL     DEFAULT 1,
+    priority        INTEGER        NOT NULL     DEFAULT 0,
+    PRIMARY KEY(counter_id, queue_id)
+);
+
+-- name: create-devices
+CREATE TABLE IF NOT EXISTS devices
+(
+    id              INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    branch_id       INTEGER        NOT NULL     REFERENCES branches(id),
+    name            VARCHAR(255)   NOT NULL,
+    kind            VARCHAR(16)    NOT NULL,
+    key_prefix      VARCHAR(16)    NOT NULL,
+    key_hash        VARCHAR(255)   NOT NULL,
+    is_revoked      BOOLEAN        DEFAULT FALSE,
+    last_seen_at    DATETIME       NULL,
+    last_seen_ip    VARCHAR(64)    NULL,
+    created_at      DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP      NULL
+);
+
+-- name: create-devices-key-prefix-index
+CREATE UNIQUE INDEX devices_key_prefix_index ON devices(key_prefix);
+
+-- name: create-idempotency-keys
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    id                  INTEGER        PRIMARY KEY  AUTOINCREMENT,
+    scope               VARCHAR(64)    NOT NULL,
+    idempotency_key     VARCHAR(255)   NOT NULL,
+    request_hash        CHAR(64)       NOT NULL,
+    status_code         INTEGER        NULL,
+    content_type        VARCHAR(255)   NULL,
+    response_body       BLOB           NULL,
+    created_at          DATETIME       DEFAULT CURRENT_TIMESTAMP,
+    expires_at          DATETIME       NOT NULL
+);
+
+-- name: create-idempotency-keys-scope-key-index
+CREATE UNIQUE INDEX idempotency_keys_scope_key_index ON idempotency_keys(scope, idempotency_key);
+
+-- name: create-idempotency-keys-expires-at-index
+CREATE INDEX idempotency_keys_expires_at_index ON idempotency_keys(expires_at);
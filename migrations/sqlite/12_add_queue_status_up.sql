@@ -0,0 +1,7 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: add-queues-status
+ALTER TABLE queues ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'open';
+
+-- name: add-queues-archived-at
+ALTER TABLE queues ADD COLUMN archived_at DATETIME NULL;
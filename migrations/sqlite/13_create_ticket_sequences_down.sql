@@ -0,0 +1,4 @@
+-- SQL in this section is executed when migration is rolled back.
+
+-- name: remove-ticket-sequences
+DROP TABLE IF EXISTS ticket_sequences;
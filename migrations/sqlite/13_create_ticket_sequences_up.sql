@@ -0,0 +1,9 @@
+-- SQL in this section is executed when migration is applied.
+
+-- name: create-ticket-sequences
+CREATE TABLE IF NOT EXISTS ticket_sequences
+(
+    branch_id           INTEGER        PRIMARY KEY  REFERENCES branches(id),
+    next_number         INTEGER        NOT NULL     DEFAULT 1,
+    reset_at            DATETIME       NULL
+);
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxOverflowHops bounds how far along a chain of overflow
+// queues a customer can be redirected
+const maxOverflowHops = 3
+
+// admission records the decision taken on a customer asking to
+// join a queue. 'Queue' is the queue the customer was placed on,
+// and is nil when the customer was turned away
+type admission struct {
+	Requested *db.Queue `json:"requested"`
+	Queue     *db.Queue `json:"queue"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+func (a *admission) redirected() bool {
+	return a.Queue != nil && a.Queue.ID != a.Requested.ID
+}
+
+// queueLimits returns the capacity limits configured on a queue
+func queueLimits(q *db.Queue) app.QueueLimits {
+	var limits app.QueueLimits
+	if q.MaxLength != nil {
+		limits.MaxLength = *q.MaxLength
+	}
+	if q.MaxWaitMinutes != nil {
+		limits.MaxWait = time.Duration(*q.MaxWaitMinutes) * time.Minute
+	}
+
+	return limits
+}
+
+// admit decides which queue a customer asking to join requested is
+// placed on. A full queue sends customers on to its overflow queue
+// as long as that queue is active, taking customers, open and has
+// room itself
+func admit(ctx context.Context, rubix *app.Rubix, queues db.QueueStore, dbConn *sqlx.DB, requested *db.Queue, location *time.Location, now time.Time) (*admission, error) {
+	decision := &admission{Requested: requested}
+	visited := map[int64]bool{}
+
+	queue := requested
+	for hop := 0; ; hop++ {
+		visited[queue.ID] = true
+
+		ok, reason := rubix.CheckCapacity(queue.ID, queueLimits(queue))
+		if ok {
+			decision.Queue = queue
+			return decision, nil
+		}
+
+		if decision.Reason == "" {
+			decision.Reason = reason
+		}
+
+		if queue.OverflowQueueID == nil || visited[*queue.OverflowQueueID] || hop >= maxOverflowHops {
+			return decision, nil
+		}
+
+		overflow, err := queues.Get(ctx, *queue.OverflowQueueID)
+		if err == sql.ErrNoRows {
+			return decision, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !overflow.IsActive || overflow.Status != app.QueueOpen {
+			return decision, nil
+		}
+
+		schedule, err := loadSchedule(ctx, dbConn, overflow.ID, location)
+		if err != nil {
+			return nil, err
+		}
+
+		if !schedule.Admits(now) {
+			return decision, nil
+		}
+
+		queue = overflow
+	}
+}
+
+// limitsTickets reports whether config caps the unserved
+// tickets msisdn may hold
+func limitsTickets(config Config, msisdn string) bool {
+	return msisdn != "" && (config.MaxTicketsPerQueue > 0 || config.MaxTicketsPerBranch > 0)
+}
+
+// ticketLimitReason returns why a phone number may not take another
+// ticket in a queue, or an empty string if it may. Config sets how
+// many unserved tickets a number may hold per queue and per branch,
+// counting only those issued since the branch last reset its tickets
+func ticketLimitReason(ctx context.Context, customers db.CustomerStore, config Config, msisdn string, queue *db.Queue, since time.Time) (string, error) {
+	if !limitsTickets(config, msisdn) {
+		return "", nil
+	}
+
+	inBranch, inQueue, err := customers.CountUnservedByMsisdn(ctx, msisdn, queue.BranchID, queue.ID, since)
+	if err != nil {
+		return "", err
+	}
+
+	return heldTicketsReason(config, msisdn, queue, inBranch, inQueue), nil
+}
+
+// heldTicketsReason returns why a phone number holding the given
+// unserved tickets may not take another in queue, or an empty
+// string if it may
+func heldTicketsReason(config Config, msisdn string, queue *db.Queue, inBranch, inQueue int) string {
+	if config.MaxTicketsPerQueue > 0 && inQueue >= config.MaxTicketsPerQueue {
+		return fmt.Sprintf("%s already holds %d ticket(s) in %s", msisdn, inQueue, queue.Name)
+	}
+
+	if config.MaxTicketsPerBranch > 0 && inBranch >= config.MaxTicketsPerBranch {
+		return fmt.Sprintf("%s already holds %d ticket(s) in this branch", msisdn, inBranch)
+	}
+
+	return ""
+}
+
+// ticketLimitError is returned when a phone number reached its
+// ticket limit while its customer was being created
+type ticketLimitError struct {
+	reason string
+}
+
+func (e *ticketLimitError) Error() string {
+	return e.reason
+}
+
+// createWithinTicketLimit saves c, counting the tickets its phone number
+// holds in queue again in the same transaction when config caps them,
+// so that joins made at the same time cannot all pass the check made
+// before the ticket was generated
+func createWithinTicketLimit(ctx context.Context, customers db.CustomerStore, config Config, c *db.Customer, queue *db.Queue, since time.Time) (*db.Customer, error) {
+	if !limitsTickets(config, c.Msisdn) {
+		return customers.Create(ctx, c)
+	}
+
+	return customers.CreateWithinLimit(ctx, c, queue.ID, since, func(inBranch, inQueue int) error {
+		if reason := heldTicketsReason(config, c.Msisdn, queue, inBranch, inQueue); reason != "" {
+			return &ticketLimitError{reason: reason}
+		}
+		return nil
+	})
+}
+
+// validateQueueLimits checks the overflow queue of a queue
+// that is being created or updated
+func validateQueueLimits(ctx context.Context, queues db.QueueStore, q *db.Queue) error {
+	if q.OverflowQueueID == nil {
+		return nil
+	}
+
+	if *q.OverflowQueueID == q.ID {
+		return errors.New("a queue cannot overflow into itself")
+	}
+
+	overflow, err := queues.Get(ctx, *q.OverflowQueueID)
+	if err == sql.ErrNoRows {
+		return errors.New("overflow queue does not exist")
+	}
+	if err != nil {
+		return err
+	}
+
+	if overflow.BranchID != q.BranchID {
+		return errors.New("overflow queue must belong to the same branch")
+	}
+
+	return nil
+}
@@ -0,0 +1,713 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// checkInOpensBefore is how long before the start of their slot
+// customers with an appointment may check in
+const checkInOpensBefore = 15 * time.Minute
+
+var errTooEarlyToCheckIn = errors.New("check-in has not opened for this appointment")
+
+// validateSlot checks the weekday, times and capacity of a slot
+func validateSlot(slot *db.AppointmentSlot) error {
+	if slot.Weekday < 0 || slot.Weekday > 6 {
+		return errors.New("weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+
+	start, err := time.Parse("15:04", slot.StartTime)
+	if err != nil {
+		return errors.New("startTime must be formatted as HH:MM")
+	}
+
+	end, err := time.Parse("15:04", slot.EndTime)
+	if err != nil {
+		return errors.New("endTime must be formatted as HH:MM")
+	}
+
+	if !end.After(start) {
+		return errors.New("endTime must be after startTime")
+	}
+
+	if slot.Capacity < 1 {
+		return errors.New("capacity must be at least 1")
+	}
+
+	return nil
+}
+
+// slotWindow returns the start and end of a slot on the given
+// date, formatted as YYYY-MM-DD, in the branch's location
+func slotWindow(slot *db.AppointmentSlot, date string, location *time.Location) (time.Time, time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q", date)
+	}
+
+	if int(day.Weekday()) != slot.Weekday {
+		return time.Time{}, time.Time{}, fmt.Errorf("slot %d is not available on %s", slot.ID, day.Weekday())
+	}
+
+	at := func(hhmm string) time.Time {
+		t, _ := time.Parse("15:04", hhmm)
+		return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, location)
+	}
+
+	return at(slot.StartTime), at(slot.EndTime), nil
+}
+
+// checkInTime returns the time a customer checking in at now for an
+// appointment is considered to have joined the queue. Customers who
+// arrive within their slot window keep their place from the start
+// of the slot, while those who arrive after it join as walk-ins
+func checkInTime(appointment *db.Appointment, now time.Time) (time.Time, error) {
+	if now.Before(appointment.StartsAt.Add(-checkInOpensBefore)) {
+		return time.Time{}, errTooEarlyToCheckIn
+	}
+
+	if now.After(appointment.EndsAt) {
+		return now, nil
+	}
+
+	return appointment.StartsAt, nil
+}
+
+// appointmentContext loads the slot, queue and branch location
+// needed to schedule an appointment
+type appointmentContext struct {
+	slot     *db.AppointmentSlot
+	queue    *db.Queue
+	location *time.Location
+}
+
+func loadAppointmentContext(ctx context.Context, dbConn *sqlx.DB, slotID int64) (*appointmentContext, error) {
+	slot, err := db.NewAppointmentsRepo(dbConn).GetSlot(ctx, slotID)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, location, err := queueLocation(ctx, dbConn, slot.QueueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appointmentContext{slot: slot, queue: queue, location: location}, nil
+}
+
+// queueLocation fetches a queue along with the location of its branch
+func queueLocation(ctx context.Context, dbConn *sqlx.DB, queueID int64) (*db.Queue, *time.Location, error) {
+	queue, err := db.NewQueuesRepo(dbConn).Get(ctx, queueID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	location, err := branchLocation(ctx, dbConn, queue.BranchID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return queue, location, nil
+}
+
+// branchLocation returns the location of a branch's timezone
+func branchLocation(ctx context.Context, dbConn *sqlx.DB, branchID int64) (*time.Location, error) {
+	branch, err := db.NewBranchesRepo(dbConn).Get(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	return time.LoadLocation(branch.Timezone)
+}
+
+func formatAppointmentTime(t time.Time, location *time.Location) string {
+	return t.In(location).Format("Mon 2 Jan 15:04")
+}
+
+// canManageAppointment returns true if the request may change an
+// appointment. Anonymous callers must know the phone number it was
+// booked with; staff and devices must belong to its branch
+func canManageAppointment(r *http.Request, appointment *db.Appointment, msisdn string) bool {
+	if isAnonymous(r) {
+		return msisdn != "" && msisdn == appointment.Msisdn
+	}
+
+	return canAccessBranch(r, appointment.BranchID)
+}
+
+// canBookAppointment returns true if the request may book a slot of
+// a queue in the given branch. Anyone may book for a phone number of
+// their own, which they must give again to manage the booking; staff
+// and devices only book in their branch
+func canBookAppointment(r *http.Request, branchID int64) bool {
+	if isAnonymous(r) {
+		return true
+	}
+
+	return canAccessBranch(r, branchID)
+}
+
+func getSlots(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		queueID, err := strconv.ParseInt(r.URL.Query().Get("queueId"), 10, 64)
+		if err != nil {
+			handleBadRequest(w, "queueId is required", err, logger)
+			return
+		}
+
+		slots, err := db.NewAppointmentsRepo(dbConn).GetSlots(r.Context(), queueID)
+		if err != nil {
+			handleServerError(w, "failed fetching appointment slots", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Data: slots})
+	}
+}
+
+func createSlot(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var slot db.AppointmentSlot
+		if !decodePayload(w, r, &slot, logger) {
+			return
+		}
+
+		if err := validateSlot(&slot); err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		queue, err := db.NewQueuesRepo(dbConn).Get(r.Context(), slot.QueueID)
+		if err == sql.ErrNoRows {
+			handleBadRequest(w, "queue does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		if !canAccessBranch(r, queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		s, err := db.NewAppointmentsRepo(dbConn).CreateSlot(r.Context(), &slot)
+		if err != nil {
+			handleServerError(w, "failed creating appointment slot", err, logger)
+			return
+		}
+
+		auditAction(r, "appointment_slot.create", "appointment_slot", strconv.FormatInt(s.ID, 10))
+		auditAfter(r, s)
+		render.JSON(w, r, Response{Data: s, Info: "appointment slot created successfully"})
+	}
+}
+
+func deleteSlot(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			ID int64 `json:"id" validate:"required"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "appointment_slot.delete", "appointment_slot", strconv.FormatInt(payload.ID, 10))
+
+		ac, err := loadAppointmentContext(r.Context(), dbConn, payload.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "appointment slot does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching appointment slot", err, logger)
+			return
+		}
+		auditBefore(r, ac.slot)
+
+		if !canAccessBranch(r, ac.queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		err = db.NewAppointmentsRepo(dbConn).DeleteSlot(r.Context(), payload.ID)
+		if err != nil {
+			handleServerError(w, "failed deleting appointment slot", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Info: "appointment slot deleted successfully"})
+	}
+}
+
+// SlotAvailability reports how many appointments can still be
+// booked in a slot on a given day
+type SlotAvailability struct {
+	Slot      *db.AppointmentSlot `json:"slot"`
+	StartsAt  time.Time           `json:"startsAt"`
+	EndsAt    time.Time           `json:"endsAt"`
+	Remaining int                 `json:"remaining"`
+}
+
+func getAvailability(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		queueID, err := strconv.ParseInt(query.Get("queueId"), 10, 64)
+		if err != nil {
+			handleBadRequest(w, "queueId is required", err, logger)
+			return
+		}
+
+		_, location, err := queueLocation(r.Context(), dbConn, queueID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "queue does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		date := query.Get("date")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			handleBadRequest(w, fmt.Sprintf("invalid date %q", date), err, logger)
+			return
+		}
+
+		repo := db.NewAppointmentsRepo(dbConn)
+		slots, err := repo.GetSlots(r.Context(), queueID)
+		if err != nil {
+			handleServerError(w, "failed fetching appointment slots", err, logger)
+			return
+		}
+
+		availability := []*SlotAvailability{}
+		for _, slot := range slots {
+			start, end, err := slotWindow(slot, date, location)
+			if err != nil {
+				// the slot does not fall on the requested day
+				continue
+			}
+
+			booked, err := repo.CountBooked(r.Context(), slot.ID, start)
+			if err != nil {
+				handleServerError(w, "failed counting booked appointments", err, logger)
+				return
+			}
+
+			remaining := slot.Capacity - booked
+			if remaining < 0 {
+				remaining = 0
+			}
+
+			availability = append(availability, &SlotAvailability{Slot: slot, StartsAt: start, EndsAt: end, Remaining: remaining})
+		}
+
+		render.JSON(w, r, Response{Data: availability})
+	}
+}
+
+func bookAppointment(rubix *app.Rubix, dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			SlotID int64  `json:"slotId" validate:"required"`
+			Date   string `json:"date" validate:"required"`
+			Msisdn string `json:"msisdn" validate:"required"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		if !normalizeMsisdnField(w, r, &payload.Msisdn, config, logger) {
+			return
+		}
+
+		ac, err := loadAppointmentContext(r.Context(), dbConn, payload.SlotID)
+		if err == sql.ErrNoRows {
+			handleBadRequest(w, "appointment slot does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching appointment slot", err, logger)
+			return
+		}
+
+		if !canBookAppointment(r, ac.queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		start, end, err := slotWindow(ac.slot, payload.Date, ac.location)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		if !start.After(time.Now()) {
+			handleBadRequest(w, "appointments must be booked ahead of the slot", nil, logger)
+			return
+		}
+
+		schedule, err := loadSchedule(r.Context(), dbConn, ac.queue.ID, ac.location)
+		if err != nil {
+			handleServerError(w, "failed fetching queue schedule", err, logger)
+			return
+		}
+
+		if _, closed := schedule.ClosureOn(start); closed {
+			handleConflict(w, fmt.Sprintf("%s is closed on %s", ac.queue.Name, payload.Date), nil, logger)
+			return
+		}
+
+		repo := db.NewAppointmentsRepo(dbConn)
+		a, err := repo.Book(r.Context(), &db.Appointment{
+			BranchID: ac.queue.BranchID,
+			QueueID:  ac.queue.ID,
+			SlotID:   ac.slot.ID,
+			Msisdn:   payload.Msisdn,
+			StartsAt: start,
+			EndsAt:   end,
+		})
+		if err == db.ErrSlotFull {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed booking appointment", err, logger)
+			return
+		}
+
+		auditAction(r, "appointment.book", "appointment", strconv.FormatInt(a.ID, 10))
+		auditAfter(r, a)
+
+		msg := fmt.Sprintf("Your appointment for %s is booked for %s. Reference %d.", ac.queue.Name, formatAppointmentTime(start, ac.location), a.ID)
+		err = rubix.SendSMS(r.Context(), a.Msisdn, msg)
+		if err != nil {
+			logger.Warn("failed sending appointment confirmation", zap.Int64("appointment_id", a.ID), zap.Error(err))
+		}
+
+		render.JSON(w, r, Response{Data: a, Info: "appointment booked successfully"})
+	}
+}
+
+var appointmentSortColumns = map[string]string{
+	"id":       "id",
+	"startsAt": "starts_at",
+}
+
+func getAllAppointments(dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := parsePage(r, appointmentSortColumns)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := db.AppointmentFilter{
+			Status: query.Get("status"),
+			Msisdn: msisdnFilter(query.Get("msisdn"), config),
+		}
+
+		if v := query.Get("queueId"); v != "" {
+			filter.QueueID, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				handleBadRequest(w, fmt.Sprintf("invalid queueId %q", v), err, logger)
+				return
+			}
+		}
+
+		filter.From, err = parseDateParam(query.Get("from"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		filter.To, err = parseEndDateParam(query.Get("to"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		filter.BranchID, err = branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		appointments, hasMore, err := db.NewAppointmentsRepo(dbConn).List(r.Context(), filter, page)
+		if err != nil {
+			handleServerError(w, "failed fetching appointments", err, logger)
+			return
+		}
+
+		var lastID int64
+		if len(appointments) > 0 {
+			lastID = appointments[len(appointments)-1].ID
+		}
+
+		render.JSON(w, r, Response{Data: appointments, Pagination: newPagination(page, hasMore, lastID)})
+	}
+}
+
+func cancelAppointment(rubix *app.Rubix, dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			ID     int64  `json:"id" validate:"required"`
+			Msisdn string `json:"msisdn"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "appointment.cancel", "appointment", strconv.FormatInt(payload.ID, 10))
+
+		repo := db.NewAppointmentsRepo(dbConn)
+		before, err := repo.Get(r.Context(), payload.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "appointment does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching appointment", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canManageAppointment(r, before, msisdnFilter(payload.Msisdn, config)) {
+			handleForbidden(w, "not allowed to change this appointment", nil, logger)
+			return
+		}
+
+		err = repo.Cancel(r.Context(), payload.ID)
+		if err == db.ErrAppointmentNotBooked {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed cancelling appointment", err, logger)
+			return
+		}
+
+		after, err := repo.Get(r.Context(), payload.ID)
+		if err == nil {
+			auditAfter(r, after)
+		}
+
+		msg := fmt.Sprintf("Your appointment %d has been cancelled.", before.ID)
+		err = rubix.SendSMS(r.Context(), before.Msisdn, msg)
+		if err != nil {
+			logger.Warn("failed sending appointment cancellation", zap.Int64("appointment_id", before.ID), zap.Error(err))
+		}
+
+		render.JSON(w, r, Response{Info: "appointment cancelled successfully"})
+	}
+}
+
+func rescheduleAppointment(rubix *app.Rubix, dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			ID     int64  `json:"id" validate:"required"`
+			Msisdn string `json:"msisdn"`
+			SlotID int64  `json:"slotId" validate:"required"`
+			Date   string `json:"date" validate:"required"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "appointment.reschedule", "appointment", strconv.FormatInt(payload.ID, 10))
+
+		repo := db.NewAppointmentsRepo(dbConn)
+		before, err := repo.Get(r.Context(), payload.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "appointment does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching appointment", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canManageAppointment(r, before, msisdnFilter(payload.Msisdn, config)) {
+			handleForbidden(w, "not allowed to change this appointment", nil, logger)
+			return
+		}
+
+		ac, err := loadAppointmentContext(r.Context(), dbConn, payload.SlotID)
+		if err == sql.ErrNoRows {
+			handleBadRequest(w, "appointment slot does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching appointment slot", err, logger)
+			return
+		}
+
+		if ac.queue.ID != before.QueueID {
+			handleBadRequest(w, "appointments can only be moved to a slot of the same queue", nil, logger)
+			return
+		}
+
+		start, end, err := slotWindow(ac.slot, payload.Date, ac.location)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		if !start.After(time.Now()) {
+			handleBadRequest(w, "appointments must be booked ahead of the slot", nil, logger)
+			return
+		}
+
+		schedule, err := loadSchedule(r.Context(), dbConn, ac.queue.ID, ac.location)
+		if err != nil {
+			handleServerError(w, "failed fetching queue schedule", err, logger)
+			return
+		}
+
+		if _, closed := schedule.ClosureOn(start); closed {
+			handleConflict(w, fmt.Sprintf("%s is closed on %s", ac.queue.Name, payload.Date), nil, logger)
+			return
+		}
+
+		updated := *before
+		updated.SlotID = ac.slot.ID
+		updated.StartsAt = start
+		updated.EndsAt = end
+
+		after, err := repo.Reschedule(r.Context(), &updated)
+		if err == db.ErrSlotFull || err == db.ErrAppointmentNotBooked {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed rescheduling appointment", err, logger)
+			return
+		}
+		auditAfter(r, after)
+
+		msg := fmt.Sprintf("Your appointment %d for %s has been moved to %s.", after.ID, ac.queue.Name, formatAppointmentTime(start, ac.location))
+		err = rubix.SendSMS(r.Context(), after.Msisdn, msg)
+		if err != nil {
+			logger.Warn("failed sending appointment reschedule confirmation", zap.Int64("appointment_id", after.ID), zap.Error(err))
+		}
+
+		render.JSON(w, r, Response{Data: after, Info: "appointment rescheduled successfully"})
+	}
+}
+
+func checkInAppointment(rubix *app.Rubix, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			ID int64 `json:"id" validate:"required"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "appointment.check_in", "appointment", strconv.FormatInt(payload.ID, 10))
+
+		repo := db.NewAppointmentsRepo(dbConn)
+		appointment, err := repo.Get(r.Context(), payload.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "appointment does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching appointment", err, logger)
+			return
+		}
+		auditBefore(r, appointment)
+
+		if !canAccessBranch(r, appointment.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		if appointment.Status != db.AppointmentBooked {
+			handleConflict(w, db.ErrAppointmentNotBooked.Error(), db.ErrAppointmentNotBooked, logger)
+			return
+		}
+
+		joinedAt, err := checkInTime(appointment, time.Now())
+		if err != nil {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
+
+		if !rubix.Accepting(appointment.QueueID) {
+			handleConflict(w, app.ErrQueueNotAccepting.Error(), app.ErrQueueNotAccepting, logger)
+			return
+		}
+
+		customer := &db.Customer{BranchID: appointment.BranchID, QueueID: appointment.QueueID, Msisdn: appointment.Msisdn}
+		customer.Ticket, err = rubix.GenerateTicket(r.Context(), appointment.BranchID)
+		if err != nil {
+			handleServerError(w, "failed generating ticket", err, logger)
+			return
+		}
+
+		c, err := repo.CheckIn(r.Context(), appointment.ID, customer)
+		if err == db.ErrAppointmentNotBooked {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed checking in appointment", err, logger)
+			return
+		}
+
+		err = rubix.CheckInCustomer(r.Context(), c.QueueID, c.ID, c.Msisdn, c.Ticket, joinedAt)
+		if err == app.ErrQueueNotAccepting {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed adding customer to queue", err, logger)
+			return
+		}
+
+		after, err := repo.Get(r.Context(), appointment.ID)
+		if err == nil {
+			auditAfter(r, after)
+		}
+
+		render.JSON(w, r, Response{Data: c, Info: "appointment checked in successfully"})
+	}
+}
+
+func appointmentsRoutes(rubix *app.Rubix, dbConn *sqlx.DB, config Config, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/slots", getSlots(dbConn, logger))
+	router.With(requireAdmin).Post("/slots", createSlot(dbConn, logger))
+	router.With(requireAdmin).Delete("/slots", deleteSlot(dbConn, logger))
+	router.Get("/availability", getAvailability(dbConn, logger))
+	router.Post("/", bookAppointment(rubix, dbConn, config, logger))
+	router.With(requireAuth).Get("/", getAllAppointments(dbConn, config, logger))
+	router.Put("/cancel", cancelAppointment(rubix, dbConn, config, logger))
+	router.Put("/reschedule", rescheduleAppointment(rubix, dbConn, config, logger))
+	router.With(requireAuth).Put("/checkin", checkInAppointment(rubix, dbConn, logger))
+
+	return router
+}
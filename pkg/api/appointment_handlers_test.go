@@ -0,0 +1,83 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/db"
+)
+
+func TestSlotWindow(t *testing.T) {
+	accra, _ := time.LoadLocation("Africa/Accra")
+	slot := &db.AppointmentSlot{ID: 1, Weekday: int(time.Monday), StartTime: "09:00", EndTime: "09:30", Capacity: 4}
+
+	start, end, err := slotWindow(slot, "2020-01-06", accra)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if want := time.Date(2020, 1, 6, 9, 0, 0, 0, accra); !start.Equal(want) {
+		t.Errorf("expected slot to start at %v, got %v", want, start)
+	}
+
+	if want := time.Date(2020, 1, 6, 9, 30, 0, 0, accra); !end.Equal(want) {
+		t.Errorf("expected slot to end at %v, got %v", want, end)
+	}
+
+	if _, _, err = slotWindow(slot, "2020-01-07", accra); err == nil {
+		t.Errorf("expected error for a date on another weekday, got nil")
+	}
+
+	if _, _, err = slotWindow(slot, "06/01/2020", accra); err == nil {
+		t.Errorf("expected error for a malformed date, got nil")
+	}
+}
+
+func TestCheckInTime(t *testing.T) {
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	appointment := &db.Appointment{StartsAt: start, EndsAt: start.Add(30 * time.Minute)}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		want    time.Time
+		wantErr error
+	}{
+		{name: "too early", now: start.Add(-20 * time.Minute), wantErr: errTooEarlyToCheckIn},
+		{name: "early within grace", now: start.Add(-10 * time.Minute), want: start},
+		{name: "within slot", now: start.Add(20 * time.Minute), want: start},
+		{name: "after slot", now: start.Add(45 * time.Minute), want: start.Add(45 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkInTime(appointment, tt.now)
+			if err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("expected joined at %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateSlot(t *testing.T) {
+	valid := db.AppointmentSlot{Weekday: 1, StartTime: "09:00", EndTime: "09:30", Capacity: 2}
+	if err := validateSlot(&valid); err != nil {
+		t.Fatalf("expected valid slot, got %v", err)
+	}
+
+	invalid := []db.AppointmentSlot{
+		{Weekday: 7, StartTime: "09:00", EndTime: "09:30", Capacity: 2},
+		{Weekday: 1, StartTime: "9am", EndTime: "09:30", Capacity: 2},
+		{Weekday: 1, StartTime: "09:30", EndTime: "09:00", Capacity: 2},
+		{Weekday: 1, StartTime: "09:00", EndTime: "09:30", Capacity: 0},
+	}
+
+	for _, slot := range invalid {
+		if err := validateSlot(&slot); err == nil {
+			t.Errorf("expected error for slot %+v, got nil", slot)
+		}
+	}
+}
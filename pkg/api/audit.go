@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"go.uber.org/zap"
+)
+
+const auditContextKey = contextKey("audit")
+
+// auditRecord collects what a handler did during a mutating
+// request so the audit middleware can log it once the
+// response has been written
+type auditRecord struct {
+	action     string
+	targetType string
+	targetID   string
+	before     interface{}
+	after      interface{}
+	skip       bool
+}
+
+// auditRecordFrom returns the audit record of the request. Requests
+// that are not audited get a throwaway record so handlers never
+// need to check whether auditing is enabled
+func auditRecordFrom(r *http.Request) *auditRecord {
+	record, ok := r.Context().Value(auditContextKey).(*auditRecord)
+	if !ok {
+		return &auditRecord{}
+	}
+
+	return record
+}
+
+// auditAction names the action performed and its target
+func auditAction(r *http.Request, action, targetType, targetID string) {
+	record := auditRecordFrom(r)
+	record.action = action
+	record.targetType = targetType
+	record.targetID = targetID
+}
+
+// auditBefore records the state of the target before it was changed
+func auditBefore(r *http.Request, v interface{}) {
+	auditRecordFrom(r).before = v
+}
+
+// auditAfter records the state of the target after it was changed
+func auditAfter(r *http.Request, v interface{}) {
+	auditRecordFrom(r).after = v
+}
+
+// auditSkip keeps a routine request, such as a device heartbeat,
+// out of the audit log
+func auditSkip(r *http.Request) {
+	auditRecordFrom(r).skip = true
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// snapshot encodes v as JSON for storage in the audit log
+func snapshot(v interface{}) types.JSONText {
+	if v == nil {
+		return types.JSONText("null")
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return types.JSONText("null")
+	}
+
+	return types.JSONText(b)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// audit appends an entry to the audit log for every mutating request,
+// successful or not. Handlers describe what they changed through
+// auditAction, auditBefore and auditAfter; requests whose handler
+// does not name an action are logged under their route pattern
+func audit(dbConn *sqlx.DB, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			record := &auditRecord{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditContextKey, record)))
+			if record.skip {
+				return
+			}
+
+			event := &db.AuditEvent{
+				Actor:      "anonymous",
+				Action:     record.action,
+				TargetType: record.targetType,
+				TargetID:   record.targetID,
+				Before:     snapshot(record.before),
+				After:      snapshot(record.after),
+				IPAddress:  clientIP(r),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				StatusCode: ww.Status(),
+			}
+
+			if actor := actorFrom(r); actor != nil {
+				event.ActorID = &actor.ID
+				event.Actor = actor.Username
+			} else if device := deviceFrom(r); device != nil {
+				event.Actor = "device:" + device.Name
+			}
+
+			if event.Action == "" {
+				event.Action = strings.ToLower(r.Method)
+				if rctx := chi.RouteContext(r.Context()); rctx != nil {
+					event.Action += " " + rctx.RoutePattern()
+				}
+			}
+
+			if event.StatusCode == 0 {
+				event.StatusCode = http.StatusOK
+			}
+
+			// the event is written even when the client has gone
+			// away, as the action it records has already happened
+			_, err := db.NewAuditRepo(dbConn).Create(context.Background(), event)
+			if err != nil {
+				logger.Error("failed writing audit event", zap.Error(err), zap.String("action", event.Action), zap.String("actor", event.Actor))
+			}
+		})
+	}
+}
+
+var auditSortColumns = map[string]string{
+	"id":        "id",
+	"createdAt": "created_at",
+}
+
+func getAuditEvents(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := parsePage(r, auditSortColumns)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := db.AuditFilter{
+			Actor:      query.Get("actor"),
+			Action:     query.Get("action"),
+			TargetType: query.Get("targetType"),
+			TargetID:   query.Get("targetId"),
+		}
+
+		filter.From, err = parseDateParam(query.Get("from"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		filter.To, err = parseEndDateParam(query.Get("to"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		repo := db.NewAuditRepo(dbConn)
+		events, hasMore, err := repo.List(r.Context(), filter, page)
+		if err != nil {
+			handleServerError(w, "failed fetching audit events", err, logger)
+			return
+		}
+
+		var lastID int64
+		if len(events) > 0 {
+			lastID = events[len(events)-1].ID
+		}
+
+		render.JSON(w, r, Response{Data: events, Pagination: newPagination(page, hasMore, lastID)})
+	}
+}
+
+func auditRoutes(dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(requireGlobalAdmin)
+	router.Get("/", getAuditEvents(dbConn, logger))
+
+	return router
+}
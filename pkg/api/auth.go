@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+type contextKey string
+
+const actorContextKey = contextKey("actor")
+
+var errBranchForbidden = errors.New("access to this branch is not allowed")
+
+// Claims are the JWT claims issued to authenticated users.
+// The standard subject claim holds the user's id. Users
+// without a branch have access to every branch
+type Claims struct {
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"isAdmin"`
+	BranchID *int64 `json:"branchId,omitempty"`
+	jwt.StandardClaims
+}
+
+// Actor identifies the user performing a request
+type Actor struct {
+	ID       int64
+	Username string
+	IsAdmin  bool
+	BranchID *int64
+}
+
+// CanAccessBranch returns true if the actor may see
+// and change data belonging to the given branch
+func (a *Actor) CanAccessBranch(branchID int64) bool {
+	return a.BranchID == nil || *a.BranchID == branchID
+}
+
+func generateJWT(account *db.UserAccount, config Config) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Username: account.Username,
+		IsAdmin:  account.IsAdmin,
+		BranchID: account.BranchID,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    config.JWTIssuer,
+			Subject:   strconv.FormatInt(account.ID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(24 * 7 * time.Hour).Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(config.JWTSecret))
+}
+
+// parseJWT verifies a token issued by generateJWT and returns its claims
+func parseJWT(tokenString string, config Config) (*Claims, error) {
+	claims := new(Claims)
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(config.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(config.JWTIssuer, true) {
+		return nil, jwt.NewValidationError("unexpected issuer", jwt.ValidationErrorIssuer)
+	}
+
+	return claims, nil
+}
+
+// identifyActor attaches the user identified by a valid bearer
+// token to the request context. Requests without a valid
+// token proceed anonymously
+func identifyActor(config Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if !strings.HasPrefix(header, "Bearer ") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := parseJWT(strings.TrimPrefix(header, "Bearer "), config)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id, _ := strconv.ParseInt(claims.Subject, 10, 64)
+			actor := &Actor{ID: id, Username: claims.Username, IsAdmin: claims.IsAdmin, BranchID: claims.BranchID}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorContextKey, actor)))
+		})
+	}
+}
+
+// actorFrom returns the user performing the request,
+// or nil if the request is anonymous
+func actorFrom(r *http.Request) *Actor {
+	actor, _ := r.Context().Value(actorContextKey).(*Actor)
+	return actor
+}
+
+// requireAuth rejects anonymous requests
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actorFrom(r) == nil {
+			writeProblem(w, newProblem(http.StatusUnauthorized, CodeUnauthorized, "authentication required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin rejects requests that are not made by an administrator
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := actorFrom(r)
+		if actor == nil {
+			writeProblem(w, newProblem(http.StatusUnauthorized, CodeUnauthorized, "authentication required"))
+			return
+		}
+
+		if !actor.IsAdmin {
+			writeProblem(w, newProblem(http.StatusForbidden, CodeForbidden, "administrator access required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireGlobalAdmin rejects requests that are not made by an
+// administrator with access to every branch
+func requireGlobalAdmin(next http.Handler) http.Handler {
+	return requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actorFrom(r).BranchID != nil {
+			writeProblem(w, newProblem(http.StatusForbidden, CodeForbidden, "access to all branches required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// branchScope returns the branch a request is restricted to, taking
+// the optional branchId query parameter into account. Zero means
+// every branch. Users bound to a branch and devices are always
+// restricted to their branch
+func branchScope(r *http.Request) (int64, error) {
+	var requested int64
+	if v := r.URL.Query().Get("branchId"); v != "" {
+		branchID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid branchId %q", v)
+		}
+		requested = branchID
+	}
+
+	var bound *int64
+	if actor := actorFrom(r); actor != nil {
+		bound = actor.BranchID
+	} else if device := deviceFrom(r); device != nil {
+		bound = &device.BranchID
+	}
+
+	if bound == nil {
+		return requested, nil
+	}
+
+	if requested != 0 && requested != *bound {
+		return 0, errBranchForbidden
+	}
+
+	return *bound, nil
+}
+
+// canAccessBranch returns true if the request may see and change
+// data belonging to the given branch. Devices only have access to
+// their own branch, and anonymous requests to none: routes open to
+// the public check what anonymous callers may do themselves
+func canAccessBranch(r *http.Request, branchID int64) bool {
+	if actor := actorFrom(r); actor != nil {
+		return actor.CanAccessBranch(branchID)
+	}
+
+	if device := deviceFrom(r); device != nil {
+		return device.BranchID == branchID
+	}
+
+	return false
+}
+
+// isAnonymous returns true if the request was made
+// by neither a user nor a device
+func isAnonymous(r *http.Request) bool {
+	return actorFrom(r) == nil && deviceFrom(r) == nil
+}
+
+func handleScopeError(w http.ResponseWriter, err error, logger *zap.Logger) {
+	if err == errBranchForbidden {
+		handleForbidden(w, err.Error(), err, logger)
+		return
+	}
+
+	handleBadRequest(w, err.Error(), err, logger)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/db"
+)
+
+func TestJWTRoundTrip(t *testing.T) {
+	config := Config{JWTIssuer: "rubix", JWTSecret: "secret"}
+	account := &db.UserAccount{ID: 7, Username: "teller", IsAdmin: false}
+
+	token, err := generateJWT(account, config)
+	if err != nil {
+		t.Fatalf("expected no error generating JWT, got %v", err)
+	}
+
+	claims, err := parseJWT(token, config)
+	if err != nil {
+		t.Fatalf("expected no error parsing JWT, got %v", err)
+	}
+
+	if claims.Subject != "7" || claims.Username != "teller" || claims.IsAdmin {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	_, err = parseJWT(token, Config{JWTIssuer: "rubix", JWTSecret: "another secret"})
+	if err == nil {
+		t.Fatalf("expected error parsing JWT signed with another secret, got none")
+	}
+
+	_, err = parseJWT(token, Config{JWTIssuer: "someone else", JWTSecret: "secret"})
+	if err == nil {
+		t.Fatalf("expected error parsing JWT from another issuer, got none")
+	}
+}
+
+func TestBranchScope(t *testing.T) {
+	branchID := int64(2)
+	bound := &Actor{ID: 3, Username: "teller", BranchID: &branchID}
+	global := &Actor{ID: 1, Username: "admin", IsAdmin: true}
+
+	tests := []struct {
+		name    string
+		actor   *Actor
+		query   string
+		want    int64
+		wantErr error
+	}{
+		{name: "anonymous without branch", want: 0},
+		{name: "global admin picks branch", actor: global, query: "branchId=5", want: 5},
+		{name: "bound user defaults to own branch", actor: bound, want: 2},
+		{name: "bound user asks for own branch", actor: bound, query: "branchId=2", want: 2},
+		{name: "bound user asks for another branch", actor: bound, query: "branchId=5", wantErr: errBranchForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			if tt.actor != nil {
+				r = r.WithContext(context.WithValue(r.Context(), actorContextKey, tt.actor))
+			}
+
+			got, err := branchScope(r)
+			if err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected branch %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCanAccessBranch(t *testing.T) {
+	branchID := int64(2)
+	bound := &Actor{ID: 3, Username: "teller", BranchID: &branchID}
+	kiosk := &db.Device{ID: 4, BranchID: 2}
+	served := time.Now()
+
+	tests := []struct {
+		name    string
+		actor   *Actor
+		device  *db.Device
+		config  Config
+		access  bool
+		join    bool
+		printed bool
+	}{
+		{name: "anonymous", join: true, printed: true},
+		{name: "anonymous with device keys required", config: Config{RequireDeviceKey: true}},
+		{name: "user of the branch", actor: bound, access: true, join: true, printed: true},
+		{name: "device of the branch", device: kiosk, access: true, join: true, printed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.actor != nil {
+				r = r.WithContext(context.WithValue(r.Context(), actorContextKey, tt.actor))
+			}
+			if tt.device != nil {
+				r = r.WithContext(context.WithValue(r.Context(), deviceContextKey, tt.device))
+			}
+
+			if got := canAccessBranch(r, 2); got != tt.access {
+				t.Errorf("expected access to branch %v, got %v", tt.access, got)
+			}
+			if canAccessBranch(r, 5) {
+				t.Errorf("expected no access to another branch")
+			}
+			if got := canJoinQueue(r, tt.config, 2); got != tt.join {
+				t.Errorf("expected joining a queue %v, got %v", tt.join, got)
+			}
+			if got := canPrintTicket(r, tt.config, &db.Customer{BranchID: 2}); got != tt.printed {
+				t.Errorf("expected printing a waiting ticket %v, got %v", tt.printed, got)
+			}
+			if isAnonymous(r) && canPrintTicket(r, tt.config, &db.Customer{BranchID: 2, ServedAt: &served}) {
+				t.Errorf("expected anonymous callers not to print served tickets")
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/hackstock/rubixcore/pkg/ticket"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// registerBranch makes rubix aware of a new or updated branch so
+// its tickets are reset at the right time without a restart
+func registerBranch(rubix *app.Rubix, branch *db.Branch, config Config) error {
+	resetTime := config.TicketsResetTime
+	if branch.TicketsResetTime != nil {
+		resetTime = *branch.TicketsResetTime
+	}
+
+	location, err := time.LoadLocation(branch.Timezone)
+	if err != nil {
+		return err
+	}
+
+	return rubix.AddBranch(branch.ID, resetTime, location)
+}
+
+// validateBranch checks the timezone and ticket template of a
+// branch, which cannot be checked by declarative rules
+func validateBranch(branch *db.Branch) FieldErrors {
+	fields := FieldErrors{}
+	if branch.Timezone == "" {
+		branch.Timezone = "UTC"
+	}
+
+	if _, err := time.LoadLocation(branch.Timezone); err != nil {
+		fields["timezone"] = "must be an IANA timezone such as Africa/Accra"
+	}
+
+	if branch.TicketTemplate != nil {
+		if err := ticket.Validate(*branch.TicketTemplate); err != nil {
+			fields["ticketTemplate"] = err.Error()
+		}
+	}
+
+	return fields
+}
+
+func getAllBranches(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repo := db.NewBranchesRepo(dbConn)
+
+		actor := actorFrom(r)
+		if actor.BranchID != nil {
+			branch, err := repo.Get(r.Context(), *actor.BranchID)
+			if err != nil {
+				handleServerError(w, "failed fetching branch", err, logger)
+				return
+			}
+
+			render.JSON(w, r, Response{Data: []*db.Branch{branch}})
+			return
+		}
+
+		branches, err := repo.GetAll(r.Context())
+		if err != nil {
+			handleServerError(w, "failed fetching all branches", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Data: branches})
+	}
+}
+
+func createBranch(rubix *app.Rubix, dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var branch db.Branch
+		if !decodePayload(w, r, &branch, logger) {
+			return
+		}
+
+		if fields := validateBranch(&branch); len(fields) > 0 {
+			handleInvalidFields(w, r, fields, logger)
+			return
+		}
+
+		repo := db.NewBranchesRepo(dbConn)
+		b, err := repo.Create(r.Context(), &branch)
+		if err != nil {
+			handleDBError(w, "failed creating branch", "branch", err, logger)
+			return
+		}
+
+		err = registerBranch(rubix, b, config)
+		if err != nil {
+			handleServerError(w, "failed registering branch", err, logger)
+			return
+		}
+
+		auditAction(r, "branch.create", "branch", strconv.FormatInt(b.ID, 10))
+		auditAfter(r, b)
+		render.JSON(w, r, Response{Data: b, Info: "branch created successfully"})
+	}
+}
+
+func updateBranch(rubix *app.Rubix, dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var branch db.Branch
+		if !decodePayload(w, r, &branch, logger) {
+			return
+		}
+
+		if fields := validateBranch(&branch); len(fields) > 0 {
+			handleInvalidFields(w, r, fields, logger)
+			return
+		}
+
+		auditAction(r, "branch.update", "branch", strconv.FormatInt(branch.ID, 10))
+
+		repo := db.NewBranchesRepo(dbConn)
+		before, err := repo.Get(r.Context(), branch.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "branch does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching branch", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		updated, err := repo.Update(r.Context(), &branch)
+		if err != nil {
+			handleDBError(w, "failed updating branch", "branch", err, logger)
+			return
+		}
+
+		err = registerBranch(rubix, updated, config)
+		if err != nil {
+			handleServerError(w, "failed registering branch", err, logger)
+			return
+		}
+
+		auditAfter(r, updated)
+		render.JSON(w, r, Response{Data: updated, Info: "branch updated successfully"})
+	}
+}
+
+func branchesRoutes(rubix *app.Rubix, dbConn *sqlx.DB, config Config, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.With(requireAuth).Get("/", getAllBranches(dbConn, logger))
+	router.With(requireGlobalAdmin).Post("/", createBranch(rubix, dbConn, config, logger))
+	router.With(requireGlobalAdmin).Put("/", updateBranch(rubix, dbConn, config, logger))
+
+	return router
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net"
+	"time"
+)
+
+// Config holds the settings the HTTP API needs
+// beyond its database and broker connections
+//
+// 'TicketsResetTime' is the time of day, as HH:MM, at which
+// ticket numbers restart for branches without their own
+//
+// 'NotifyClosedQueue' sends customers who try to join a closed
+// queue an SMS saying when it reopens
+//
+// 'RequireDeviceKey' stops anonymous clients from adding customers
+// to queues, so that only registered kiosks and signed in users can
+//
+// 'TicketStatusURL' is the base URL of the ticket status page that
+// printed tickets link to, and 'TicketWidth' the number of columns
+// tickets are printed in
+//
+// 'DefaultCountry' is the two letter code of the country phone
+// numbers without a country code are read as belonging to
+//
+// 'IdempotencyRetention' is how long responses to requests sent
+// with an Idempotency-Key are kept for replay to retries
+//
+// 'MaxTicketsPerQueue' and 'MaxTicketsPerBranch' cap how many
+// unserved tickets a phone number may hold, and the 'RateLimit'
+// fields how many customers may be added a minute per anonymous
+// client address, per device and per phone number. Zero lifts
+// a limit
+//
+// 'EventStreamDuration' is how long a stream of events is kept
+// open before clients are asked to reconnect. It must be shorter
+// than the server's write timeout. Zero keeps streams open
+//
+// 'TrustedProxies' are the networks of the proxies whose
+// X-Forwarded-For and X-Real-IP headers name the client
+type Config struct {
+	JWTIssuer         string
+	JWTSecret         string
+	TicketsResetTime  string
+	NotifyClosedQueue bool
+	RequireDeviceKey  bool
+	TicketStatusURL   string
+	TicketWidth       int
+	DefaultCountry    string
+
+	IdempotencyRetention time.Duration
+	MaxTicketsPerQueue   int
+	MaxTicketsPerBranch  int
+	RateLimitPerIP       int
+	RateLimitPerDevice   int
+	RateLimitPerMsisdn   int
+	EventStreamDuration  time.Duration
+	TrustedProxies       []*net.IPNet
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// toAppCounter converts a counter and its queues for routing by rubix
+func toAppCounter(c *db.Counter) app.Counter {
+	counter := app.Counter{ID: c.ID, Name: c.Name, Strategy: c.Strategy}
+	for _, q := range c.Queues {
+		counter.Queues = append(counter.Queues, app.CounterQueue{QueueID: q.QueueID, Weight: q.Weight, Priority: q.Priority})
+	}
+
+	return counter
+}
+
+func getAllCounters(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		branchID, err := branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		repo := db.NewCountersRepo(dbConn)
+		counters, err := repo.GetAll(r.Context(), branchID)
+		if err != nil {
+			handleServerError(w, "failed fetching counters", err, logger)
+			return
+		}
+
+		for _, c := range counters {
+			c.Queues, err = repo.GetQueues(r.Context(), c.ID)
+			if err != nil {
+				handleServerError(w, "failed fetching counter queues", err, logger)
+				return
+			}
+		}
+
+		render.JSON(w, r, Response{Data: counters})
+	}
+}
+
+func createCounter(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var counter db.Counter
+		if !decodePayload(w, r, &counter, logger) {
+			return
+		}
+
+		actor := actorFrom(r)
+		if actor.BranchID != nil {
+			if counter.BranchID != 0 && counter.BranchID != *actor.BranchID {
+				handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+				return
+			}
+			counter.BranchID = *actor.BranchID
+		}
+
+		if counter.BranchID == 0 {
+			handleBadRequest(w, "branchId is required", nil, logger)
+			return
+		}
+
+		if counter.Strategy == "" {
+			counter.Strategy = app.StrategyLongestWait
+		}
+
+		if !app.ValidStrategy(counter.Strategy) {
+			handleBadRequest(w, fmt.Sprintf("unknown strategy %q", counter.Strategy), nil, logger)
+			return
+		}
+
+		c, err := db.NewCountersRepo(dbConn).Create(r.Context(), &counter)
+		if err != nil {
+			handleDBError(w, "failed creating counter", "counter", err, logger)
+			return
+		}
+
+		auditAction(r, "counter.create", "counter", strconv.FormatInt(c.ID, 10))
+		auditAfter(r, c)
+		render.JSON(w, r, Response{Data: c, Info: "counter created successfully"})
+	}
+}
+
+func updateCounter(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var counter db.Counter
+		if !decodePayload(w, r, &counter, logger) {
+			return
+		}
+
+		auditAction(r, "counter.update", "counter", strconv.FormatInt(counter.ID, 10))
+
+		repo := db.NewCountersRepo(dbConn)
+		before, err := repo.Get(r.Context(), counter.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "counter does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching counter", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canAccessBranch(r, before.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		// counters updated without a strategy keep the one they have
+		if counter.Strategy == "" {
+			counter.Strategy = before.Strategy
+		}
+
+		if !app.ValidStrategy(counter.Strategy) {
+			handleBadRequest(w, fmt.Sprintf("unknown strategy %q", counter.Strategy), nil, logger)
+			return
+		}
+
+		updated, err := repo.Update(r.Context(), &counter)
+		if err != nil {
+			handleDBError(w, "failed updating counter", "counter", err, logger)
+			return
+		}
+
+		auditAfter(r, updated)
+		render.JSON(w, r, Response{Data: updated, Info: "counter updated successfully"})
+	}
+}
+
+func setCounterQueues(queues db.QueueStore, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			CounterID int64              `json:"counterId" validate:"required"`
+			Queues    []*db.CounterQueue `json:"queues"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "counter.queues.update", "counter", strconv.FormatInt(payload.CounterID, 10))
+
+		repo := db.NewCountersRepo(dbConn)
+		before, err := repo.Get(r.Context(), payload.CounterID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "counter does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching counter", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canAccessBranch(r, before.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		seen := map[int64]bool{}
+		for _, q := range payload.Queues {
+			if seen[q.QueueID] {
+				handleBadRequest(w, fmt.Sprintf("queue %d is listed more than once", q.QueueID), nil, logger)
+				return
+			}
+			seen[q.QueueID] = true
+
+			if q.Weight == 0 {
+				q.Weight = 1
+			}
+			if q.Weight < 0 {
+				handleBadRequest(w, "weight must be at least 1", nil, logger)
+				return
+			}
+
+			queue, err := queues.Get(r.Context(), q.QueueID)
+			if err == sql.ErrNoRows || (err == nil && queue.BranchID != before.BranchID) {
+				handleBadRequest(w, fmt.Sprintf("queue %d does not exist in the counter's branch", q.QueueID), err, logger)
+				return
+			}
+			if err != nil {
+				handleServerError(w, "failed fetching queue", err, logger)
+				return
+			}
+		}
+
+		assigned, err := repo.SetQueues(r.Context(), before.ID, payload.Queues)
+		if err != nil {
+			handleServerError(w, "failed updating counter queues", err, logger)
+			return
+		}
+
+		auditAfter(r, assigned)
+		render.JSON(w, r, Response{Data: assigned, Info: "counter queues updated successfully"})
+	}
+}
+
+// CalledCustomer is returned to a counter after calling its next
+// customer, along with the queue the customer was called from
+type CalledCustomer struct {
+	QueueID  int64        `json:"queueId"`
+	Customer *db.Customer `json:"customer"`
+}
+
+func callNextForCounter(rubix *app.Rubix, stores *db.Stores, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		counterID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			handleBadRequest(w, "invalid counter id", err, logger)
+			return
+		}
+
+		auditAction(r, "counter.call_next", "counter", id)
+
+		counter, err := db.NewCountersRepo(dbConn).Get(r.Context(), counterID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "counter does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching counter", err, logger)
+			return
+		}
+
+		if !canAccessBranch(r, counter.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		if !counter.IsActive {
+			handleConflict(w, "counter is not active", nil, logger)
+			return
+		}
+
+		queueID, customer, err := rubix.NotifyNextCustomerForCounter(r.Context(), toAppCounter(counter))
+		if err == app.ErrNoWaitingCustomers {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed notifying next customer", err, logger)
+			return
+		}
+
+		served, err := markCalledAsServed(r.Context(), rubix, stores.Customers, customer)
+		if err != nil {
+			handleServerError(w, "failed marking customer as served", err, logger)
+			return
+		}
+		archiveIfDrained(r.Context(), rubix, stores.Queues, queueID, logger)
+
+		called := &CalledCustomer{QueueID: queueID, Customer: served}
+		auditAfter(r, called)
+		render.JSON(w, r, Response{Data: called, Info: "next customer notified"})
+	}
+}
+
+func countersRoutes(rubix *app.Rubix, stores *db.Stores, dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.With(requireAuth).Get("/", getAllCounters(dbConn, logger))
+	router.With(requireAdmin).Post("/", createCounter(dbConn, logger))
+	router.With(requireAdmin).Put("/", updateCounter(dbConn, logger))
+	router.With(requireAdmin).Put("/queues", setCounterQueues(stores.Queues, dbConn, logger))
+	router.With(requireAuth).Post("/{id}/next", callNextForCounter(rubix, stores, dbConn, logger))
+
+	return router
+}
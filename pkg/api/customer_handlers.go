@@ -1,8 +1,13 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -12,89 +17,408 @@ import (
 	"go.uber.org/zap"
 )
 
-func createCustomer(rubix *app.Rubix, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func createCustomer(rubix *app.Rubix, stores *db.Stores, dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var customer db.Customer
-		err := json.NewDecoder(r.Body).Decode(&customer)
+		if !decodePayload(w, r, &customer, logger) {
+			return
+		}
+
+		if customer.Msisdn != "" && !normalizeMsisdnField(w, r, &customer.Msisdn, config, logger) {
+			return
+		}
+
+		queue, err := stores.Queues.Get(r.Context(), customer.QueueID)
+		if err == sql.ErrNoRows {
+			handleBadRequest(w, "queue does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		if !canJoinQueue(r, config, queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		if !queue.IsActive {
+			handleConflict(w, fmt.Sprintf("%s is not active", queue.Name), nil, logger)
+			return
+		}
+
+		if queue.Status != app.QueueOpen {
+			handleConflict(w, fmt.Sprintf("%s is %s and not taking new customers", queue.Name, queue.Status), nil, logger)
+			return
+		}
+
+		// tickets issued before the last reset are no longer waiting;
+		// a branch rubix does not know yet has not reset since startup
+		lastReset, _ := rubix.LastReset(queue.BranchID, time.Now())
+		reason, err := ticketLimitReason(r.Context(), stores.Customers, config, customer.Msisdn, queue, lastReset)
+		if err != nil {
+			handleServerError(w, "failed checking tickets held", err, logger)
+			return
+		}
+		if reason != "" {
+			auditAction(r, "customer.reject", "queue", strconv.FormatInt(queue.ID, 10))
+			handleError(w, reason, nil, logger, http.StatusConflict, CodeTicketLimit)
+			return
+		}
+
+		location, err := branchLocation(r.Context(), dbConn, queue.BranchID)
+		if err != nil {
+			handleServerError(w, "failed fetching branch location", err, logger)
+			return
+		}
+
+		schedule, err := loadSchedule(r.Context(), dbConn, queue.ID, location)
+		if err != nil {
+			handleServerError(w, "failed fetching queue schedule", err, logger)
+			return
+		}
+
+		now := time.Now()
+		if !schedule.Admits(now) {
+			msg := closedQueueMessage(queue, schedule, now)
+			if config.NotifyClosedQueue && customer.Msisdn != "" {
+				if err := rubix.SendSMS(r.Context(), customer.Msisdn, msg); err != nil {
+					logger.Warn("failed notifying customer of closed queue", zap.Int64("queue_id", queue.ID), zap.Error(err))
+				}
+			}
+
+			handleConflict(w, msg, nil, logger)
+			return
+		}
+
+		decision, err := admit(r.Context(), rubix, stores.Queues, dbConn, queue, location, now)
 		if err != nil {
-			handleServerError(w, "failed decoding request payload", err, logger)
+			handleServerError(w, "failed checking queue capacity", err, logger)
+			return
+		}
+
+		if decision.Queue == nil {
+			auditAction(r, "customer.reject", "queue", strconv.FormatInt(queue.ID, 10))
+			auditAfter(r, decision)
+
+			msg := fmt.Sprintf("%s is full: %s", queue.Name, decision.Reason)
+			handleConflict(w, msg, nil, logger)
 			return
 		}
 
-		repo := db.NewCustomersRepo(dbConn)
-		customer.Ticket = rubix.GenerateTicket()
+		if decision.redirected() {
+			customer.QueueID = decision.Queue.ID
+			customer.RedirectedFromQueueID = &queue.ID
+		}
 
-		c, err := repo.Create(&customer)
+		customer.BranchID = queue.BranchID
+		customer.Ticket, err = rubix.GenerateTicket(r.Context(), queue.BranchID)
+		if err != nil {
+			handleServerError(w, "failed generating ticket", err, logger)
+			return
+		}
+
+		c, err := createWithinTicketLimit(r.Context(), stores.Customers, config, &customer, queue, lastReset)
+		var limitErr *ticketLimitError
+		if errors.As(err, &limitErr) {
+			auditAction(r, "customer.reject", "queue", strconv.FormatInt(queue.ID, 10))
+			handleError(w, limitErr.Error(), nil, logger, http.StatusConflict, CodeTicketLimit)
+			return
+		}
 		if err != nil {
 			handleServerError(w, "failed creating customer", err, logger)
 			return
 		}
 
-		err = rubix.AddCustomerToWaitList(customer.QueueID, customer.Msisdn, customer.Ticket)
+		info := "customer created successfully"
+		if decision.redirected() {
+			info = fmt.Sprintf("%s is full, customer placed on %s", queue.Name, decision.Queue.Name)
+			logger.Info("customer redirected to overflow queue", zap.Int64("queue_id", queue.ID), zap.Int64("overflow_queue_id", decision.Queue.ID), zap.String("reason", decision.Reason))
+		}
+		err = joinWaitList(stores.Customers, c, logger, func() error {
+			if decision.redirected() {
+				return rubix.AddRedirectedCustomerToWaitList(r.Context(), c.QueueID, c.ID, c.Msisdn, c.Ticket, queue.Name, decision.Queue.Name)
+			}
+			return rubix.AddCustomerToWaitList(r.Context(), c.QueueID, c.ID, c.Msisdn, c.Ticket)
+		})
+		if err == app.ErrQueueNotAccepting {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
 		if err != nil {
 			handleServerError(w, "failed adding customer to queue", err, logger)
 			return
 		}
 
-		render.JSON(w, r, Response{Data: c, Info: "customer created successfully"})
+		auditAction(r, "customer.create", "customer", strconv.FormatInt(c.ID, 10))
+		auditAfter(r, c)
+		render.JSON(w, r, Response{Data: c, Info: info})
 	}
 }
 
-func getAllCustomers(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+// canJoinQueue returns true if the request may add a customer to a
+// queue of the given branch. Anonymous kiosks may join the queues of
+// any branch, but only while device keys are not required
+func canJoinQueue(r *http.Request, config Config, branchID int64) bool {
+	if isAnonymous(r) {
+		return !config.RequireDeviceKey
+	}
+
+	return canAccessBranch(r, branchID)
+}
+
+// joinWaitList places a customer just saved on the wait list of their
+// queue with join. If they cannot join it, for instance because their
+// ticket could not be sent, the customer is deleted again so that the
+// ticket does not count against them when they retry
+func joinWaitList(customers db.CustomerStore, c *db.Customer, logger *zap.Logger, join func() error) error {
+	err := join()
+	if err == nil {
+		return nil
+	}
+
+	// the request may have been cancelled, which must not
+	// keep the customer from being deleted
+	if delErr := customers.Delete(context.Background(), c.ID); delErr != nil {
+		logger.Error("failed deleting customer who could not join queue", zap.Int64("customer_id", c.ID), zap.Error(delErr))
+	}
+
+	return err
+}
+
+var customerSortColumns = map[string]string{
+	"id":        "id",
+	"createdAt": "created_at",
+}
+
+func getAllCustomers(customers db.CustomerStore, config Config, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewCustomersRepo(dbConn)
-		customers, err := repo.GetAll()
+		page, err := parsePage(r, customerSortColumns)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		filter, err := parseCustomerFilter(r, config)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		filter.BranchID, err = branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		listed, hasMore, err := customers.List(r.Context(), filter, page)
 		if err != nil {
 			handleServerError(w, "failed fetching all customers", err, logger)
 			return
 		}
 
-		render.JSON(w, r, Response{Data: customers})
+		var lastID int64
+		if len(listed) > 0 {
+			lastID = listed[len(listed)-1].ID
+		}
+
+		render.JSON(w, r, Response{Data: listed, Pagination: newPagination(page, hasMore, lastID)})
 	}
 }
 
-func getUnservedCustomers(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+// parseCustomerFilter reads the queueId, status, msisdn, from
+// and to query parameters
+func parseCustomerFilter(r *http.Request, config Config) (db.CustomerFilter, error) {
+	var filter db.CustomerFilter
+	query := r.URL.Query()
+
+	if v := query.Get("queueId"); v != "" {
+		queueID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid queueId %q", v)
+		}
+		filter.QueueID = queueID
+	}
+
+	switch v := query.Get("status"); v {
+	case "":
+	case "served":
+		served := true
+		filter.Served = &served
+	case "unserved":
+		served := false
+		filter.Served = &served
+	default:
+		return filter, fmt.Errorf("invalid status %q", v)
+	}
+
+	filter.Msisdn = msisdnFilter(query.Get("msisdn"), config)
+
+	from, err := parseDateParam(query.Get("from"))
+	if err != nil {
+		return filter, err
+	}
+	filter.From = from
+
+	to, err := parseEndDateParam(query.Get("to"))
+	if err != nil {
+		return filter, err
+	}
+	filter.To = to
+
+	return filter, nil
+}
+
+func getUnservedCustomers(customers db.CustomerStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewCustomersRepo(dbConn)
-		customers, err := repo.GetUnserved()
+		branchID, err := branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		var unserved []*db.Customer
+		if branchID == 0 {
+			unserved, err = customers.GetUnserved(r.Context())
+		} else {
+			unserved, err = customers.GetUnservedInBranch(r.Context(), branchID)
+		}
 		if err != nil {
 			handleServerError(w, "failed fetching unserved customers", err, logger)
 			return
 		}
 
-		render.JSON(w, r, Response{Data: customers})
+		render.JSON(w, r, Response{Data: unserved})
 	}
 }
 
-func markAsServed(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func markAsServed(rubix *app.Rubix, customers db.CustomerStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload = struct {
-			CustomerID int `json:"customerId"`
+			CustomerID int `json:"customerId" validate:"required"`
 		}{}
 
-		err := json.NewDecoder(r.Body).Decode(&payload)
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "customer.serve", "customer", strconv.Itoa(payload.CustomerID))
+
+		before, err := customers.Get(r.Context(), int64(payload.CustomerID))
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "customer does not exist", err, logger)
+			return
+		}
 		if err != nil {
-			handleServerError(w, "failed decoding request payload", err, logger)
+			handleServerError(w, "failed fetching customer", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canAccessBranch(r, before.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
 			return
 		}
 
-		repo := db.NewCustomersRepo(dbConn)
-		err = repo.MarkAsServed(payload.CustomerID)
+		err = customers.MarkAsServed(r.Context(), payload.CustomerID)
 		if err != nil {
 			handleServerError(w, "failed marking customer as served", err, logger)
 			return
 		}
 
+		rubix.ServeCustomer(before.QueueID, toCustomerInfo(before))
+
+		after, err := customers.Get(r.Context(), int64(payload.CustomerID))
+		if err == nil {
+			auditAfter(r, after)
+		}
+
 		render.JSON(w, r, Response{Info: "customer called successfully"})
 	}
 }
 
-func customersRoutes(rubix *app.Rubix, dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+func recallCustomer(rubix *app.Rubix, customers db.CustomerStore, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			CustomerID int64 `json:"customerId" validate:"required"`
+			CounterID  int64 `json:"counterId" validate:"required"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "customer.recall", "customer", strconv.FormatInt(payload.CustomerID, 10))
+
+		customer, err := customers.Get(r.Context(), payload.CustomerID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "customer does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching customer", err, logger)
+			return
+		}
+
+		counter, err := db.NewCountersRepo(dbConn).Get(r.Context(), payload.CounterID)
+		if err == sql.ErrNoRows {
+			handleBadRequest(w, "counter does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching counter", err, logger)
+			return
+		}
+
+		if !canAccessBranch(r, customer.BranchID) || counter.BranchID != customer.BranchID {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		if customer.ServedAt == nil {
+			handleConflict(w, "customer has not been called", nil, logger)
+			return
+		}
+
+		err = rubix.RecallCustomer(r.Context(), customer.QueueID, toCustomerInfo(customer), counter.Name)
+		if err != nil {
+			handleServerError(w, "failed recalling customer", err, logger)
+			return
+		}
+
+		auditAfter(r, customer)
+		render.JSON(w, r, Response{Data: customer, Info: "customer recalled"})
+	}
+}
+
+// toCustomerInfo returns the wait list entry of a customer record
+func toCustomerInfo(c *db.Customer) *app.CustomerInfo {
+	info := &app.CustomerInfo{ID: c.ID, Msisdn: c.Msisdn, Ticket: c.Ticket}
+	if c.CreatedAt != nil {
+		info.JoinedAt = *c.CreatedAt
+	}
+
+	return info
+}
+
+func customersRoutes(rubix *app.Rubix, stores *db.Stores, dbConn *sqlx.DB, config Config, logger *zap.Logger) *chi.Mux {
 	router := chi.NewRouter()
-	router.Post("/", createCustomer(rubix, dbConn, logger))
-	router.Get("/", getAllCustomers(dbConn, logger))
-	router.Get("/unserved", getUnservedCustomers(dbConn, logger))
-	router.Put("/", markAsServed(dbConn, logger))
+	kiosk := router.With()
+	if config.RequireDeviceKey {
+		kiosk = router.With(requireUserOrDevice)
+	}
+	kiosk.With(
+		rateLimit(limiterFor(config.RateLimitPerIP), anonymousIP, logger),
+		rateLimit(limiterFor(config.RateLimitPerDevice), deviceID, logger),
+		rateLimit(limiterFor(config.RateLimitPerMsisdn), payloadMsisdn(config), logger),
+		idempotent(dbConn, config, logger),
+	).Post("/", createCustomer(rubix, stores, dbConn, config, logger))
+	kiosk.Get("/{id}/ticket", getCustomerTicket(rubix, stores, dbConn, config, logger))
+	router.With(requireAuth).Get("/", getAllCustomers(stores.Customers, config, logger))
+	router.With(requireAuth).Get("/unserved", getUnservedCustomers(stores.Customers, logger))
+	router.With(requireAuth).Put("/", markAsServed(rubix, stores.Customers, logger))
+	router.With(requireAuth).Post("/recall", recallCustomer(rubix, stores.Customers, dbConn, logger))
 
 	return router
 }
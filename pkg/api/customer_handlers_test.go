@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// fakeCustomers records the calls made to the customer
+// store by the handlers under test
+type fakeCustomers struct {
+	db.CustomerStore
+	since   time.Time
+	held    int
+	deleted []int64
+	served  []int
+}
+
+func (s *fakeCustomers) CountUnservedByMsisdn(ctx context.Context, msisdn string, branchID, queueID int64, since time.Time) (int, int, error) {
+	s.since = since
+	return s.held, s.held, nil
+}
+
+func (s *fakeCustomers) Create(ctx context.Context, c *db.Customer) (*db.Customer, error) {
+	c.ID = 1
+	return c, nil
+}
+
+func (s *fakeCustomers) CreateWithinLimit(ctx context.Context, c *db.Customer, queueID int64, since time.Time, allow func(inBranch, inQueue int) error) (*db.Customer, error) {
+	s.since = since
+	if err := allow(s.held, s.held); err != nil {
+		return nil, err
+	}
+	return s.Create(ctx, c)
+}
+
+func (s *fakeCustomers) Delete(ctx context.Context, id int64) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func (s *fakeCustomers) MarkAsServed(ctx context.Context, custID int) error {
+	s.served = append(s.served, custID)
+	return nil
+}
+
+func (s *fakeCustomers) Get(ctx context.Context, id int64) (*db.Customer, error) {
+	return &db.Customer{ID: id}, nil
+}
+
+func TestTicketLimitReason(t *testing.T) {
+	customers := &fakeCustomers{held: 1}
+	queue := &db.Queue{ID: 2, BranchID: 1, Name: "Tellers"}
+	lastReset := time.Date(2020, 1, 6, 5, 0, 0, 0, time.UTC)
+
+	reason, err := ticketLimitReason(context.Background(), customers, Config{MaxTicketsPerQueue: 1}, "+233200662782", queue, lastReset)
+	if err != nil || reason == "" {
+		t.Fatalf("expected a number holding a ticket to be refused, got %q (%v)", reason, err)
+	}
+	if !customers.since.Equal(lastReset) {
+		t.Errorf("expected tickets to be counted since %v, got %v", lastReset, customers.since)
+	}
+
+	customers.held = 0
+	reason, err = ticketLimitReason(context.Background(), customers, Config{MaxTicketsPerQueue: 1}, "+233200662782", queue, lastReset)
+	if err != nil || reason != "" {
+		t.Errorf("expected a number holding no ticket to be admitted, got %q (%v)", reason, err)
+	}
+}
+
+func TestCreateWithinTicketLimit(t *testing.T) {
+	customers := &fakeCustomers{held: 1}
+	queue := &db.Queue{ID: 2, BranchID: 1, Name: "Tellers"}
+	lastReset := time.Date(2020, 1, 6, 5, 0, 0, 0, time.UTC)
+
+	// another join took the last ticket after the first check passed
+	_, err := createWithinTicketLimit(context.Background(), customers, Config{MaxTicketsPerQueue: 1}, &db.Customer{Msisdn: "+233200662782"}, queue, lastReset)
+	var limitErr *ticketLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a ticket limit error, got %v", err)
+	}
+	if !customers.since.Equal(lastReset) {
+		t.Errorf("expected tickets to be counted since %v, got %v", lastReset, customers.since)
+	}
+
+	c, err := createWithinTicketLimit(context.Background(), customers, Config{}, &db.Customer{Msisdn: "+233200662782"}, queue, lastReset)
+	if err != nil || c.ID != 1 {
+		t.Errorf("expected a customer to be created without a limit, got %+v (%v)", c, err)
+	}
+}
+
+func TestJoinWaitList(t *testing.T) {
+	rubix := app.NewRubix(nil, zap.NewNop())
+	customers := &fakeCustomers{}
+	c := &db.Customer{ID: 7, QueueID: 99, Msisdn: "+233200662782", Ticket: "A001"}
+
+	err := joinWaitList(customers, c, zap.NewNop(), func() error {
+		return rubix.AddCustomerToWaitList(context.Background(), c.QueueID, c.ID, c.Msisdn, c.Ticket)
+	})
+	if err == nil {
+		t.Fatalf("expected joining an unknown queue to fail")
+	}
+	if len(customers.deleted) != 1 || customers.deleted[0] != c.ID {
+		t.Errorf("expected customer who could not join to be deleted, got %v", customers.deleted)
+	}
+
+	customers.deleted = nil
+	err = joinWaitList(customers, c, zap.NewNop(), func() error { return nil })
+	if err != nil || len(customers.deleted) != 0 {
+		t.Errorf("expected customer who joined to be kept, got %v (%v)", customers.deleted, err)
+	}
+}
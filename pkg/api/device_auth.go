@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const deviceContextKey = contextKey("device")
+
+// deviceKeyHeader carries the API key of a kiosk or display board.
+// Devices never send user tokens, so the two paths stay apart
+const deviceKeyHeader = "X-Device-Key"
+
+// API keys look like rbx_<prefix>.<secret>. The prefix is stored in
+// the clear to find the device, the whole key is stored hashed
+const (
+	deviceKeyScheme      = "rbx_"
+	deviceKeyPrefixBytes = 6
+	deviceKeySecretBytes = 24
+)
+
+var errInvalidDeviceKey = errors.New("invalid device key")
+
+// generateDeviceKey returns a new API key along with its prefix
+func generateDeviceKey() (string, string, error) {
+	buf := make([]byte, deviceKeyPrefixBytes+deviceKeySecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	prefix := hex.EncodeToString(buf[:deviceKeyPrefixBytes])
+	secret := hex.EncodeToString(buf[deviceKeyPrefixBytes:])
+	return deviceKeyScheme + prefix + "." + secret, prefix, nil
+}
+
+// parseDeviceKey returns the prefix of an API key issued
+// by generateDeviceKey
+func parseDeviceKey(key string) (string, error) {
+	if !strings.HasPrefix(key, deviceKeyScheme) {
+		return "", errInvalidDeviceKey
+	}
+
+	parts := strings.Split(strings.TrimPrefix(key, deviceKeyScheme), ".")
+	if len(parts) != 2 || len(parts[0]) != 2*deviceKeyPrefixBytes || len(parts[1]) != 2*deviceKeySecretBytes {
+		return "", errInvalidDeviceKey
+	}
+
+	return parts[0], nil
+}
+
+// verifiedKeys remembers keys that have already been checked
+// against a device's hash, as bcrypt is too slow to run on every
+// request from a kiosk. Entries are keyed by a digest of the key
+// and only hold while the device's hash is unchanged, so rotating
+// a key invalidates them
+type verifiedKeys struct {
+	lock   sync.Mutex
+	hashes map[[sha256.Size]byte]string
+}
+
+func (v *verifiedKeys) verify(key, hash string) bool {
+	digest := sha256.Sum256([]byte(key))
+
+	v.lock.Lock()
+	cached, ok := v.hashes[digest]
+	v.lock.Unlock()
+	if ok && cached == hash {
+		return true
+	}
+
+	if !comparePasswords(hash, key) {
+		return false
+	}
+
+	v.lock.Lock()
+	v.hashes[digest] = hash
+	v.lock.Unlock()
+	return true
+}
+
+// authenticateDevice returns the device an API key belongs to
+func authenticateDevice(ctx context.Context, dbConn *sqlx.DB, keys *verifiedKeys, key string) (*db.Device, error) {
+	prefix, err := parseDeviceKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := db.NewDevicesRepo(dbConn).GetByKeyPrefix(ctx, prefix)
+	if err == sql.ErrNoRows {
+		return nil, errInvalidDeviceKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if device.IsRevoked || !keys.verify(key, device.KeyHash) {
+		return nil, errInvalidDeviceKey
+	}
+
+	return device, nil
+}
+
+// identifyDevice attaches the device identified by a valid API key
+// to the request context. Requests presenting an unknown or revoked
+// key are rejected rather than treated as anonymous
+func identifyDevice(dbConn *sqlx.DB, logger *zap.Logger) func(http.Handler) http.Handler {
+	keys := &verifiedKeys{hashes: map[[sha256.Size]byte]string{}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(deviceKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			device, err := authenticateDevice(r.Context(), dbConn, keys, key)
+			if err == errInvalidDeviceKey {
+				writeProblem(w, newProblem(http.StatusUnauthorized, CodeUnauthorized, err.Error()))
+				return
+			}
+			if err != nil {
+				handleServerError(w, "failed authenticating device", err, logger)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), deviceContextKey, device)))
+		})
+	}
+}
+
+// deviceFrom returns the device performing the request,
+// or nil if the request is not made by a device
+func deviceFrom(r *http.Request) *db.Device {
+	device, _ := r.Context().Value(deviceContextKey).(*db.Device)
+	return device
+}
+
+// requireDevice rejects requests that are not made by a device
+func requireDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deviceFrom(r) == nil {
+			writeProblem(w, newProblem(http.StatusUnauthorized, CodeUnauthorized, "device authentication required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireUserOrDevice rejects requests made neither by
+// a signed in user nor by a device
+func requireUserOrDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actorFrom(r) == nil && deviceFrom(r) == nil {
+			writeProblem(w, newProblem(http.StatusUnauthorized, CodeUnauthorized, "authentication required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
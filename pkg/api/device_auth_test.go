@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDeviceKey(t *testing.T) {
+	key, prefix, err := generateDeviceKey()
+	if err != nil {
+		t.Fatalf("expected no error generating key, got %v", err)
+	}
+
+	if !strings.HasPrefix(key, deviceKeyScheme+prefix+".") {
+		t.Fatalf("expected key %q to start with its prefix %q", key, prefix)
+	}
+
+	parsed, err := parseDeviceKey(key)
+	if err != nil {
+		t.Fatalf("expected no error parsing key, got %v", err)
+	}
+
+	if parsed != prefix {
+		t.Fatalf("expected prefix %q, got %q", prefix, parsed)
+	}
+
+	other, _, _ := generateDeviceKey()
+	if other == key {
+		t.Fatal("expected distinct keys")
+	}
+}
+
+func TestParseDeviceKey(t *testing.T) {
+	testCases := []struct {
+		tag string
+		key string
+	}{
+		{tag: "missing scheme", key: "a1b2c3d4e5f6." + strings.Repeat("0", 48)},
+		{tag: "missing secret", key: "rbx_a1b2c3d4e5f6"},
+		{tag: "short prefix", key: "rbx_a1b2." + strings.Repeat("0", 48)},
+		{tag: "short secret", key: "rbx_a1b2c3d4e5f6.00"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			_, err := parseDeviceKey(tc.key)
+			if err != errInvalidDeviceKey {
+				t.Fatalf("expected %v, got %v", errInvalidDeviceKey, err)
+			}
+		})
+	}
+}
+
+func TestVerifiedKeys(t *testing.T) {
+	key, _, hash, err := issueDeviceKey()
+	if err != nil {
+		t.Fatalf("expected no error issuing key, got %v", err)
+	}
+
+	keys := &verifiedKeys{hashes: map[[sha256.Size]byte]string{}}
+	if !keys.verify(key, hash) {
+		t.Fatal("expected key to match its hash")
+	}
+
+	if !keys.verify(key, hash) {
+		t.Fatal("expected cached key to match its hash")
+	}
+
+	_, _, rotated, _ := issueDeviceKey()
+	if keys.verify(key, rotated) {
+		t.Fatal("expected key not to match a rotated hash")
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// IssuedDevice is returned when a device is registered or its key
+// rotated. The API key is only ever shown in this response
+type IssuedDevice struct {
+	Device *db.Device `json:"device"`
+	APIKey string     `json:"apiKey"`
+}
+
+// Heartbeat acknowledges a device heartbeat with the server's
+// clock, so devices can tell how far theirs has drifted
+type Heartbeat struct {
+	DeviceID   int64     `json:"deviceId"`
+	ServerTime time.Time `json:"serverTime"`
+}
+
+// issueDeviceKey generates an API key and returns it along
+// with its prefix and hash
+func issueDeviceKey() (key, prefix, hash string, err error) {
+	key, prefix, err = generateDeviceKey()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	hash, err = hashPassword(key)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return key, prefix, hash, nil
+}
+
+// loadDevice fetches the device named by the id URL parameter and
+// checks the request may manage it. It writes the error response
+// and returns nil on failure
+func loadDevice(w http.ResponseWriter, r *http.Request, dbConn *sqlx.DB, logger *zap.Logger) *db.Device {
+	deviceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleBadRequest(w, "invalid device id", err, logger)
+		return nil
+	}
+
+	device, err := db.NewDevicesRepo(dbConn).Get(r.Context(), deviceID)
+	if err == sql.ErrNoRows {
+		handleNotFound(w, "device does not exist", err, logger)
+		return nil
+	}
+	if err != nil {
+		handleServerError(w, "failed fetching device", err, logger)
+		return nil
+	}
+
+	if !canAccessBranch(r, device.BranchID) {
+		handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+		return nil
+	}
+
+	return device
+}
+
+func getAllDevices(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		branchID, err := branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		devices, err := db.NewDevicesRepo(dbConn).GetAll(r.Context(), branchID)
+		if err != nil {
+			handleServerError(w, "failed fetching devices", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Data: devices})
+	}
+}
+
+func createDevice(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var device db.Device
+		if !decodePayload(w, r, &device, logger) {
+			return
+		}
+
+		actor := actorFrom(r)
+		if actor.BranchID != nil {
+			if device.BranchID != 0 && device.BranchID != *actor.BranchID {
+				handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+				return
+			}
+			device.BranchID = *actor.BranchID
+		}
+
+		if device.BranchID == 0 {
+			handleBadRequest(w, "branchId is required", nil, logger)
+			return
+		}
+
+		device.Name = strings.TrimSpace(device.Name)
+		if device.Kind == "" {
+			device.Kind = db.DeviceKiosk
+		}
+
+		key, prefix, hash, err := issueDeviceKey()
+		if err != nil {
+			handleServerError(w, "failed generating device key", err, logger)
+			return
+		}
+		device.KeyPrefix = prefix
+		device.KeyHash = hash
+
+		d, err := db.NewDevicesRepo(dbConn).Create(r.Context(), &device)
+		if err != nil {
+			handleServerError(w, "failed creating device", err, logger)
+			return
+		}
+
+		auditAction(r, "device.create", "device", strconv.FormatInt(d.ID, 10))
+		auditAfter(r, d)
+		render.JSON(w, r, Response{Data: &IssuedDevice{Device: d, APIKey: key}, Info: "device registered successfully"})
+	}
+}
+
+func rotateDeviceKey(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auditAction(r, "device.rotate_key", "device", chi.URLParam(r, "id"))
+
+		device := loadDevice(w, r, dbConn, logger)
+		if device == nil {
+			return
+		}
+		auditBefore(r, device)
+
+		key, prefix, hash, err := issueDeviceKey()
+		if err != nil {
+			handleServerError(w, "failed generating device key", err, logger)
+			return
+		}
+
+		repo := db.NewDevicesRepo(dbConn)
+		err = repo.RotateKey(r.Context(), device.ID, prefix, hash)
+		if err != nil {
+			handleServerError(w, "failed rotating device key", err, logger)
+			return
+		}
+
+		updated, err := repo.Get(r.Context(), device.ID)
+		if err != nil {
+			handleServerError(w, "failed fetching device", err, logger)
+			return
+		}
+
+		auditAfter(r, updated)
+		render.JSON(w, r, Response{Data: &IssuedDevice{Device: updated, APIKey: key}, Info: "device key rotated successfully"})
+	}
+}
+
+func revokeDevice(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auditAction(r, "device.revoke", "device", chi.URLParam(r, "id"))
+
+		device := loadDevice(w, r, dbConn, logger)
+		if device == nil {
+			return
+		}
+		auditBefore(r, device)
+
+		repo := db.NewDevicesRepo(dbConn)
+		err := repo.Revoke(r.Context(), device.ID)
+		if err != nil {
+			handleServerError(w, "failed revoking device", err, logger)
+			return
+		}
+
+		updated, err := repo.Get(r.Context(), device.ID)
+		if err != nil {
+			handleServerError(w, "failed fetching device", err, logger)
+			return
+		}
+
+		auditAfter(r, updated)
+		render.JSON(w, r, Response{Data: updated, Info: "device revoked successfully"})
+	}
+}
+
+func deviceHeartbeat(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auditSkip(r)
+
+		device := deviceFrom(r)
+		err := db.NewDevicesRepo(dbConn).Heartbeat(r.Context(), device.ID, clientIP(r))
+		if err != nil {
+			handleServerError(w, "failed recording heartbeat", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Data: &Heartbeat{DeviceID: device.ID, ServerTime: time.Now()}})
+	}
+}
+
+func devicesRoutes(dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.With(requireAdmin).Get("/", getAllDevices(dbConn, logger))
+	router.With(requireAdmin).Post("/", createDevice(dbConn, logger))
+	router.With(requireDevice).Post("/heartbeat", deviceHeartbeat(dbConn, logger))
+	router.With(requireAdmin).Post("/{id}/rotate", rotateDeviceKey(dbConn, logger))
+	router.With(requireAdmin).Post("/{id}/revoke", revokeDevice(dbConn, logger))
+
+	return router
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/app"
+	"go.uber.org/zap"
+)
+
+const (
+	// eventStreamRetry is how long clients wait before
+	// reconnecting once a stream of events ends
+	eventStreamRetry = time.Second
+
+	// eventStreamKeepAlive is how often a comment is sent on a
+	// quiet stream, so proxies do not close it as idle
+	eventStreamKeepAlive = 15 * time.Second
+)
+
+// StreamedEvent is an event sent to clients streaming events. Phone
+// numbers are left out, as displays show tickets to everyone
+type StreamedEvent struct {
+	Type     string    `json:"type"`
+	At       time.Time `json:"at"`
+	BranchID int64     `json:"branchId"`
+	QueueID  int64     `json:"queueId"`
+	Ticket   string    `json:"ticket,omitempty"`
+	Counter  string    `json:"counter,omitempty"`
+	Status   string    `json:"status,omitempty"`
+}
+
+// toStreamedEvent returns the event streamed to clients for an event
+// of rubix, or false if clients are not sent events of its type.
+// Queue status changes are sent as queue.<status>, as queue.paused,
+// and clients that missed events are sent a resync
+func toStreamedEvent(e app.Event) (StreamedEvent, bool) {
+	streamed := StreamedEvent{Type: e.Type, At: e.At, BranchID: e.BranchID, QueueID: e.QueueID, Counter: e.Counter}
+	if e.Customer != nil {
+		streamed.Ticket = e.Customer.Ticket
+	}
+
+	switch e.Type {
+	case app.EventTicketIssued, app.EventCustomerCalled, app.EventCustomerRecalled, app.EventCustomerServed, app.EventResync:
+		return streamed, true
+	case app.EventQueueStatus:
+		streamed.Type = "queue." + e.Status
+		streamed.Status = e.Status
+		return streamed, true
+	}
+
+	return StreamedEvent{}, false
+}
+
+// writeEvent writes an event in the Server-Sent Events format if it
+// is streamed to clients and matches the branch and queue filters,
+// where zero matches any. Resyncs match every filter. It returns
+// false if nothing was written
+func writeEvent(w io.Writer, e app.LoggedEvent, branchID, queueID int64) (bool, error) {
+	filtered := (branchID != 0 && e.BranchID != branchID) || (queueID != 0 && e.QueueID != queueID)
+	if filtered && e.Type != app.EventResync {
+		return false, nil
+	}
+
+	streamed, ok := toStreamedEvent(e.Event)
+	if !ok {
+		return false, nil
+	}
+
+	data, err := json.Marshal(streamed)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, streamed.Type, data)
+	return err == nil, err
+}
+
+// streamEvents streams the events of queues as Server-Sent Events,
+// optionally only those of a branch and of a queue. Clients that
+// reconnect with a Last-Event-ID header are first sent the events
+// they missed if the instance they reach still has them, or else a
+// resync event telling them to fetch the state of the queues again
+func streamEvents(rubix *app.Rubix, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			handleServerError(w, "streaming is not supported", nil, logger)
+			return
+		}
+
+		branchID, err := branchScope(r)
+		if err == errBranchForbidden {
+			handleForbidden(w, err.Error(), err, logger)
+			return
+		}
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		var queueID int64
+		if v := r.URL.Query().Get("queueId"); v != "" {
+			queueID, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				handleBadRequest(w, fmt.Sprintf("invalid queueId %q", v), err, logger)
+				return
+			}
+		}
+
+		replay, events, cancel := rubix.Events().Subscribe(r.Header.Get("Last-Event-ID"))
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry/time.Millisecond)
+		for _, e := range replay {
+			if _, err := writeEvent(w, e, branchID, queueID); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		var end <-chan time.Time
+		if config.EventStreamDuration > 0 {
+			timer := time.NewTimer(config.EventStreamDuration)
+			defer timer.Stop()
+			end = timer.C
+		}
+
+		keepAlive := time.NewTicker(eventStreamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-end:
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case e, ok := <-events:
+				// the stream fell behind and was dropped, or the
+				// server is shutting down; the client resumes from
+				// the last event it got
+				if !ok {
+					return
+				}
+
+				written, err := writeEvent(w, e, branchID, queueID)
+				if err != nil {
+					logger.Warn("failed streaming event", zap.String("id", e.ID), zap.Error(err))
+					return
+				}
+				if written {
+					flusher.Flush()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/app"
+	"go.uber.org/zap"
+)
+
+func TestStreamEvents(t *testing.T) {
+	rubix := app.NewRubix(nil, zap.NewNop())
+
+	// clients resume from the first event, which is not streamed
+	_, events, cancel := rubix.Events().Subscribe("")
+	rubix.AddQueue(1, 1)
+	first := <-events
+	cancel()
+
+	rubix.AddQueue(2, 1)
+	rubix.AddQueue(3, 2)
+	rubix.SetQueueStatus(1, 1, app.QueuePaused)
+	rubix.SetQueueStatus(2, 1, app.QueuePaused)
+	rubix.SetQueueStatus(3, 2, app.QueuePaused)
+
+	handler := streamEvents(rubix, Config{EventStreamDuration: 50 * time.Millisecond}, zap.NewNop())
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "every queue", query: "", want: []string{"queue 1", "queue 2", "queue 3"}},
+		{name: "one branch", query: "?branchId=1", want: []string{"queue 1", "queue 2"}},
+		{name: "one queue", query: "?branchId=1&queueId=2", want: []string{"queue 2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events"+tt.query, nil)
+			req.Header.Set("Last-Event-ID", first.ID)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+				t.Fatalf("expected an event stream, got %q", ct)
+			}
+
+			body := rec.Body.String()
+			if n := strings.Count(body, "event: queue.paused\n"); n != len(tt.want) {
+				t.Fatalf("expected %d queue.paused events, got %d in %q", len(tt.want), n, body)
+			}
+			for _, queue := range tt.want {
+				id := strings.TrimPrefix(queue, "queue ")
+				if !strings.Contains(body, `"queueId":`+id+",") {
+					t.Errorf("expected an event of %s, got %q", queue, body)
+				}
+			}
+			if strings.Contains(body, "queue.added") {
+				t.Errorf("expected internal events not to be streamed, got %q", body)
+			}
+		})
+	}
+
+	// an identifier given by another instance cannot be resumed from
+	req := httptest.NewRequest(http.MethodGet, "/events?branchId=2", nil)
+	req.Header.Set("Last-Event-ID", "other-1")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "event: resync\n") || strings.Contains(body, "queue.paused") {
+		t.Errorf("expected a resync in place of the missed events, got %q", body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events?queueId=x", nil)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid queue id, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
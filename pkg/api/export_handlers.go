@@ -0,0 +1,305 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+
+	// exportFlushInterval is the number of rows written
+	// before the response is flushed to the client
+	exportFlushInterval = 500
+)
+
+// exportWriter writes rows of an export in a specific format
+type exportWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(record []string, value interface{}) error
+	Flush() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvExportWriter) WriteHeader(columns []string) error {
+	return cw.w.Write(columns)
+}
+
+func (cw *csvExportWriter) WriteRow(record []string, value interface{}) error {
+	return cw.w.Write(record)
+}
+
+func (cw *csvExportWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlExportWriter struct {
+	enc *json.Encoder
+}
+
+func (jw *jsonlExportWriter) WriteHeader(columns []string) error {
+	return nil
+}
+
+func (jw *jsonlExportWriter) WriteRow(record []string, value interface{}) error {
+	return jw.enc.Encode(value)
+}
+
+func (jw *jsonlExportWriter) Flush() error {
+	return nil
+}
+
+// newExportWriter prepares w for streaming an export with the given
+// name in the format requested by the client. Headers are only set
+// once the format is known to be supported
+func newExportWriter(w http.ResponseWriter, r *http.Request, name string) (exportWriter, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatCSV
+	}
+
+	var ew exportWriter
+	var contentType string
+	switch format {
+	case formatCSV:
+		ew, contentType = &csvExportWriter{w: csv.NewWriter(w)}, "text/csv; charset=utf-8"
+	case formatJSONL:
+		ew, contentType = &jsonlExportWriter{enc: json.NewEncoder(w)}, "application/x-ndjson"
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	return ew, nil
+}
+
+// parseExportFilter reads the queueId, from and to query parameters.
+// Dates may be given as RFC3339 timestamps or as YYYY-MM-DD, and a
+// to given as a date includes that whole day
+func parseExportFilter(r *http.Request) (db.ExportFilter, error) {
+	var filter db.ExportFilter
+	query := r.URL.Query()
+
+	if v := query.Get("queueId"); v != "" {
+		queueID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid queueId %q", v)
+		}
+		filter.QueueID = queueID
+	}
+
+	from, err := parseDateParam(query.Get("from"))
+	if err != nil {
+		return filter, err
+	}
+	filter.From = from
+
+	to, err := parseEndDateParam(query.Get("to"))
+	if err != nil {
+		return filter, err
+	}
+	filter.To = to
+
+	return filter, nil
+}
+
+func parseDateParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, v)
+		if err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid date %q", v)
+}
+
+// parseEndDateParam parses the exclusive end of a date range. A date
+// given without a time ends at the start of the following day, so
+// that the range takes in the whole of the day named
+func parseEndDateParam(v string) (*time.Time, error) {
+	t, err := parseDateParam(v)
+	if err != nil || t == nil {
+		return t, err
+	}
+
+	if _, dateOnly := time.Parse("2006-01-02", v); dateOnly == nil {
+		next := t.AddDate(0, 0, 1)
+		return &next, nil
+	}
+
+	return t, nil
+}
+
+// streamExport writes rows produced by export to the client, flushing
+// periodically so memory usage stays constant regardless of the
+// number of rows exported
+func streamExport(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	columns []string,
+	export func(filter db.ExportFilter, write func(record []string, value interface{}) error) error,
+	logger *zap.Logger,
+) {
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		handleBadRequest(w, err.Error(), err, logger)
+		return
+	}
+
+	filter.BranchID, err = branchScope(r)
+	if err != nil {
+		handleScopeError(w, err, logger)
+		return
+	}
+
+	ew, err := newExportWriter(w, r, name)
+	if err != nil {
+		handleBadRequest(w, err.Error(), err, logger)
+		return
+	}
+
+	// exports may take longer than the server's write timeout
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		logger.Warn("failed clearing write deadline for export", zap.Error(err))
+	}
+
+	flusher, _ := w.(http.Flusher)
+	err = ew.WriteHeader(columns)
+	if err != nil {
+		logger.Warn("failed writing export header", zap.Error(err))
+		return
+	}
+
+	rows := 0
+	err = export(filter, func(record []string, value interface{}) error {
+		if err := ew.WriteRow(record, value); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushInterval == 0 {
+			if err := ew.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		return r.Context().Err()
+	})
+	if err == nil {
+		err = ew.Flush()
+	}
+	if err != nil {
+		// headers have already been sent, so the client is left
+		// with a truncated export
+		logger.Warn("export aborted", zap.String("export", name), zap.Int("rows", rows), zap.Error(err))
+		return
+	}
+
+	logger.Info("export completed", zap.String("export", name), zap.Int("rows", rows))
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func exportCustomers(customers db.CustomerStore, logger *zap.Logger) http.HandlerFunc {
+	columns := []string{"id", "branch_id", "msisdn", "ticket", "queue_id", "created_at", "served_at"}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamExport(w, r, "customers", columns, func(filter db.ExportFilter, write func([]string, interface{}) error) error {
+			return customers.Export(r.Context(), filter, func(c *db.Customer) error {
+				return write([]string{
+					strconv.FormatInt(c.ID, 10),
+					strconv.FormatInt(c.BranchID, 10),
+					c.Msisdn,
+					c.Ticket,
+					strconv.FormatInt(c.QueueID, 10),
+					formatTime(c.CreatedAt),
+					formatTime(c.ServedAt),
+				}, c)
+			})
+		}, logger)
+	}
+}
+
+func exportQueues(queues db.QueueStore, logger *zap.Logger) http.HandlerFunc {
+	columns := []string{"id", "branch_id", "name", "description", "is_active", "status", "created_at", "updated_at", "archived_at"}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamExport(w, r, "queues", columns, func(filter db.ExportFilter, write func([]string, interface{}) error) error {
+			return queues.Export(r.Context(), filter, func(q *db.Queue) error {
+				return write([]string{
+					strconv.FormatInt(q.ID, 10),
+					strconv.FormatInt(q.BranchID, 10),
+					q.Name,
+					q.Description,
+					strconv.FormatBool(q.IsActive),
+					q.Status,
+					formatTime(q.CreatedAt),
+					formatTime(q.UpdatedAt),
+					formatTime(q.ArchivedAt),
+				}, q)
+			})
+		}, logger)
+	}
+}
+
+func exportServiceEvents(customers db.CustomerStore, logger *zap.Logger) http.HandlerFunc {
+	columns := []string{"customer_id", "branch_id", "queue_id", "msisdn", "ticket", "event", "occurred_at"}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamExport(w, r, "service-events", columns, func(filter db.ExportFilter, write func([]string, interface{}) error) error {
+			return customers.ExportEvents(r.Context(), filter, func(e *db.ServiceEvent) error {
+				return write([]string{
+					strconv.FormatInt(e.CustomerID, 10),
+					strconv.FormatInt(e.BranchID, 10),
+					strconv.FormatInt(e.QueueID, 10),
+					e.Msisdn,
+					e.Ticket,
+					e.Event,
+					formatTime(e.OccurredAt),
+				}, e)
+			})
+		}, logger)
+	}
+}
+
+func exportsRoutes(stores *db.Stores, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(requireAuth)
+	router.Get("/customers", exportCustomers(stores.Customers, logger))
+	router.Get("/queues", exportQueues(stores.Queues, logger))
+	router.Get("/events", exportServiceEvents(stores.Customers, logger))
+
+	return router
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewExportWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	_, err := newExportWriter(rec, httptest.NewRequest(http.MethodGet, "/exports/customers?format=xml", nil), "customers")
+	if err == nil {
+		t.Fatalf("expected an error for an unsupported format")
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("expected no attachment header for an unsupported format, got %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	_, err = newExportWriter(rec, httptest.NewRequest(http.MethodGet, "/exports/customers?format=jsonl", nil), "customers")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("expected a JSON Lines content type, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got == "" {
+		t.Errorf("expected an attachment header")
+	}
+}
+
+func TestParseEndDateParam(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "2020-01-06", want: time.Date(2020, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{value: "2020-01-06T09:30:00Z", want: time.Date(2020, 1, 6, 9, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseEndDateParam(tt.value)
+		if err != nil || got == nil || !got.Equal(tt.want) {
+			t.Errorf("expected %q to end at %v, got %v (%v)", tt.value, tt.want, got, err)
+		}
+	}
+
+	if got, err := parseEndDateParam(""); got != nil || err != nil {
+		t.Errorf("expected no end for an empty value, got %v (%v)", got, err)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/jmoiron/sqlx"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+
+	healthCheckTimeout = 2 * time.Second
+)
+
+var (
+	errSMSConsumerDown = errors.New("sms consumer is not subscribed to the broker")
+	errNotRehydrated   = errors.New("wait lists have not been rehydrated")
+	errEventFanoutDown = errors.New("event fanout is not subscribed to the broker")
+)
+
+// HealthCheck is the outcome of checking a single dependency.
+// 'Driver' names the database driver of the database check
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latencyMs"`
+	Driver    string  `json:"driver,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthReport is the body returned by the health endpoints
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// runCheck times check and records its outcome
+func runCheck(check func() error) *HealthCheck {
+	start := time.Now()
+	err := check()
+	result := &HealthCheck{
+		Status:    statusOK,
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		result.Status = statusUnavailable
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, HealthReport{Status: statusOK})
+	}
+}
+
+func readiness(rubix *app.Rubix, brokerConn *amqp.Connection, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		database := runCheck(func() error {
+			ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+			defer cancel()
+			return dbConn.PingContext(ctx)
+		})
+		database.Driver = dbConn.DriverName()
+
+		checks := map[string]*HealthCheck{
+			"database": database,
+			"rabbitmq": runCheck(func() error {
+				channel, err := brokerConn.Channel()
+				if err != nil {
+					return err
+				}
+				return channel.Close()
+			}),
+			"smsConsumer": runCheck(func() error {
+				if !rubix.SMSWorkersAlive() {
+					return errSMSConsumerDown
+				}
+				return nil
+			}),
+			"eventFanout": runCheck(func() error {
+				if !rubix.BroadcasterAlive() {
+					return errEventFanoutDown
+				}
+				return nil
+			}),
+			"rubixState": runCheck(func() error {
+				if !rubix.Rehydrated() {
+					return errNotRehydrated
+				}
+				return nil
+			}),
+		}
+
+		report := HealthReport{Status: statusOK, Checks: checks}
+		for name, check := range checks {
+			if check.Status != statusOK {
+				report.Status = statusUnavailable
+				logger.Warn("readiness check failed", zap.String("check", name), zap.String("error", check.Error))
+			}
+		}
+
+		if report.Status != statusOK {
+			render.Status(r, http.StatusServiceUnavailable)
+		}
+		render.JSON(w, r, report)
+	}
+}
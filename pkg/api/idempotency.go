@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// idempotencyKeyHeader lets a client retry a request without it
+// taking effect twice. Kiosks send a fresh key for every ticket
+// and the same key when retrying after a timeout
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader marks responses replayed from a
+// previous request with the same key
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+const maxIdempotencyKeyLength = 255
+
+var errIdempotencyKeyBusy = errors.New("a request with this Idempotency-Key is still being processed")
+
+// idempotencyScope identifies the client presenting a key, so
+// that clients choosing the same key do not see each other's
+// responses
+func idempotencyScope(r *http.Request) string {
+	if device := deviceFrom(r); device != nil {
+		return "device:" + strconv.FormatInt(device.ID, 10)
+	}
+
+	if actor := actorFrom(r); actor != nil {
+		return "user:" + strconv.FormatInt(actor.ID, 10)
+	}
+
+	return "anonymous"
+}
+
+// requestHash returns a digest of what a request asks for,
+// used to detect a key reused for a different request
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claimIdempotencyKey reserves a key for a request. When the key is
+// already held, the record holding it is returned instead. Expired
+// records are released and the key claimed again
+func claimIdempotencyKey(ctx context.Context, repo *db.IdempotencyRepo, rec *db.IdempotencyRecord, now time.Time) (*db.IdempotencyRecord, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := repo.Reserve(ctx, rec)
+		if err == nil {
+			return nil, nil
+		}
+		if !db.IsDuplicateKey(err) {
+			return nil, err
+		}
+
+		existing, err := repo.Get(ctx, rec.Scope, rec.Key)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if existing.ExpiresAt.After(now) {
+			return existing, nil
+		}
+
+		if err := repo.Release(ctx, existing.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errIdempotencyKeyBusy
+}
+
+// replay writes the response stored for a key
+func replay(w http.ResponseWriter, rec *db.IdempotencyRecord) {
+	if rec.ContentType != nil && *rec.ContentType != "" {
+		w.Header().Set("Content-Type", *rec.ContentType)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(*rec.StatusCode)
+	w.Write(rec.ResponseBody)
+}
+
+// idempotent stores the response to requests carrying an
+// Idempotency-Key for the retention window of config, and replays
+// it when the request is retried with the same key instead of
+// running the handler again. Requests without a key are passed
+// through. Server errors are not stored so that a retry can
+// succeed once the fault is gone
+func idempotent(dbConn *sqlx.DB, config Config, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				handleBadRequest(w, "Idempotency-Key must not be longer than 255 characters", nil, logger)
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				handleMalformedPayload(w, err, logger)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			rec := &db.IdempotencyRecord{
+				Scope:       idempotencyScope(r),
+				Key:         key,
+				RequestHash: requestHash(r, body),
+				ExpiresAt:   now.Add(config.IdempotencyRetention),
+			}
+
+			repo := db.NewIdempotencyRepo(dbConn)
+			existing, err := claimIdempotencyKey(r.Context(), repo, rec, now)
+			if err == errIdempotencyKeyBusy {
+				w.Header().Set("Retry-After", "1")
+				handleConflict(w, err.Error(), err, logger)
+				return
+			}
+			if err != nil {
+				handleServerError(w, "failed reserving idempotency key", err, logger)
+				return
+			}
+
+			if existing != nil {
+				switch {
+				case existing.RequestHash != rec.RequestHash:
+					msg := "Idempotency-Key was already used for a different request"
+					handleError(w, msg, nil, logger, http.StatusUnprocessableEntity, CodeKeyReused)
+				case !existing.IsComplete():
+					w.Header().Set("Retry-After", "1")
+					handleConflict(w, errIdempotencyKeyBusy.Error(), nil, logger)
+				default:
+					auditSkip(r)
+					replay(w, existing)
+				}
+				return
+			}
+
+			var response bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&response)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// the response is saved even when the client has gone
+			// away, so that its retry is answered with it
+			ctx := context.Background()
+			if status < http.StatusInternalServerError {
+				err = repo.Complete(ctx, rec.ID, status, ww.Header().Get("Content-Type"), response.Bytes())
+				if err == nil {
+					return
+				}
+				logger.Error("failed saving idempotent response", zap.Error(err), zap.String("scope", rec.Scope), zap.String("key", key))
+			}
+
+			if err := repo.Release(ctx, rec.ID); err != nil {
+				logger.Error("failed releasing idempotency key", zap.Error(err), zap.String("scope", rec.Scope), zap.String("key", key))
+			}
+		})
+	}
+}
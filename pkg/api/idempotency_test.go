@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	reserveKeyQuery  = `^INSERT INTO idempotency_keys \(scope, idempotency_key, request_hash, expires_at\) VALUES \(\?, \?, \?, \?\)$`
+	getKeyQuery      = `^SELECT k\.\* FROM idempotency_keys AS k WHERE k\.scope = \? AND k\.idempotency_key = \?$`
+	completeKeyQuery = `^UPDATE idempotency_keys SET status_code = \?, content_type = \?, response_body = \? WHERE id = \?$`
+)
+
+var keyColumns = []string{"id", "scope", "idempotency_key", "request_hash", "status_code", "content_type", "response_body", "created_at", "expires_at"}
+
+func idempotentRequest(key, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/customers/", strings.NewReader(body))
+	r.Header.Set(idempotencyKeyHeader, key)
+	return r
+}
+
+func TestIdempotent_StoresFirstResponse(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer conn.Close()
+
+	body := `{"queueId":1}`
+	mock.ExpectExec(reserveKeyQuery).
+		WithArgs("anonymous", "k1", requestHash(idempotentRequest("k1", body), []byte(body)), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec(completeKeyQuery).
+		WithArgs(http.StatusOK, "application/json", []byte(`{"ticket":"A001"}`), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	calls := 0
+	handler := idempotent(sqlx.NewDb(conn, "sqlmock"), Config{IdempotencyRetention: time.Hour}, zap.NewNop())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ticket":"A001"}`))
+		}),
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("k1", body))
+
+	if calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", calls)
+	}
+
+	if w.Header().Get(idempotentReplayedHeader) != "" {
+		t.Errorf("expected first response not to be marked as replayed")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotent_ReplaysStoredResponse(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer conn.Close()
+
+	body := `{"queueId":1}`
+	hash := requestHash(idempotentRequest("k1", body), []byte(body))
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	expiresAt := time.Now().Add(time.Hour)
+
+	testCases := []struct {
+		tag        string
+		hash       string
+		status     interface{}
+		wantStatus int
+		wantBody   string
+	}{
+		{tag: "completed", hash: hash, status: http.StatusOK, wantStatus: http.StatusOK, wantBody: `{"ticket":"A001"}`},
+		{tag: "in progress", hash: hash, status: nil, wantStatus: http.StatusConflict},
+		{tag: "different request", hash: "other", status: http.StatusOK, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			mock.ExpectExec(reserveKeyQuery).WillReturnError(duplicate)
+			mock.ExpectQuery(getKeyQuery).
+				WithArgs("anonymous", "k1").
+				WillReturnRows(sqlmock.NewRows(keyColumns).
+					AddRow(3, "anonymous", "k1", tc.hash, tc.status, "application/json", []byte(`{"ticket":"A001"}`), nil, expiresAt))
+
+			handler := idempotent(sqlx.NewDb(conn, "sqlmock"), Config{IdempotencyRetention: time.Hour}, zap.NewNop())(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					t.Fatalf("expected handler not to run for a retried key")
+				}),
+			)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, idempotentRequest("k1", body))
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+
+			if tc.wantBody != "" {
+				if got := w.Body.String(); got != tc.wantBody {
+					t.Errorf("expected body %s, got %s", tc.wantBody, got)
+				}
+				if w.Header().Get(idempotentReplayedHeader) != "true" {
+					t.Errorf("expected replayed response to be marked as replayed")
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hackstock/rubixcore/pkg/phone"
+	"go.uber.org/zap"
+)
+
+// normalizeMsisdnField normalises the msisdn of a request to E.164.
+// Invalid numbers are answered with a 400 naming the field, in which
+// case false is returned
+func normalizeMsisdnField(w http.ResponseWriter, r *http.Request, msisdn *string, config Config, logger *zap.Logger) bool {
+	normalized, err := phone.Normalize(*msisdn, config.DefaultCountry)
+	if err != nil {
+		handleInvalidFields(w, r, FieldErrors{"msisdn": err.Error()}, logger)
+		return false
+	}
+
+	*msisdn = normalized
+	return true
+}
+
+// msisdnFilter normalises a phone number used to look records up.
+// Numbers that cannot be normalised are returned as is, so they
+// simply match nothing
+func msisdnFilter(msisdn string, config Config) string {
+	if msisdn == "" {
+		return ""
+	}
+
+	normalized, err := phone.Normalize(msisdn, config.DefaultCountry)
+	if err != nil {
+		return msisdn
+	}
+
+	return normalized
+}
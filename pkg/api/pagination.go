@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hackstock/rubixcore/pkg/db"
+)
+
+// parsePage reads the cursor, limit and sort query parameters.
+// sortable maps the sort keys accepted from clients to database
+// columns; a leading '-' on the sort key requests descending order
+func parsePage(r *http.Request, sortable map[string]string) (db.Page, error) {
+	var page db.Page
+	query := r.URL.Query()
+
+	if v := query.Get("cursor"); v != "" {
+		after, err := decodeCursor(v)
+		if err != nil {
+			return page, err
+		}
+		page.After = after
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > db.MaxPageLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", db.MaxPageLimit)
+		}
+		page.Limit = limit
+	}
+
+	if v := query.Get("sort"); v != "" {
+		if strings.HasPrefix(v, "-") {
+			page.Desc = true
+			v = v[1:]
+		}
+
+		column, ok := sortable[v]
+		if !ok {
+			return page, fmt.Errorf("cannot sort by %q", v)
+		}
+		page.Sort = column
+	}
+
+	return page, nil
+}
+
+// newPagination builds the pagination envelope for a page whose
+// last row has the given id
+func newPagination(page db.Page, hasMore bool, lastID int64) *Pagination {
+	limit := page.Limit
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	p := &Pagination{Limit: limit, HasMore: hasMore}
+	if hasMore {
+		p.NextCursor = encodeCursor(lastID)
+	}
+
+	return p
+}
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+
+	return id, nil
+}
+
+// parseBoolParam reads an optional boolean query parameter
+func parseBoolParam(r *http.Request, name string) (*bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", name, v)
+	}
+
+	return &b, nil
+}
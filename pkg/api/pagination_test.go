@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := encodeCursor(42)
+
+	id, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("expected no error decoding cursor, got %v", err)
+	}
+
+	if id != 42 {
+		t.Fatalf("expected 42, got %d", id)
+	}
+
+	if _, err := decodeCursor("not-a-cursor"); err == nil {
+		t.Fatalf("expected error decoding invalid cursor, got none")
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	testCases := []struct {
+		tag       string
+		url       string
+		expectErr bool
+		sort      string
+		desc      bool
+		limit     int
+	}{
+		{tag: "defaults", url: "/customers"},
+		{tag: "descending sort", url: "/customers?sort=-createdAt&limit=10", sort: "created_at", desc: true, limit: 10},
+		{tag: "unknown sort", url: "/customers?sort=password", expectErr: true},
+		{tag: "limit too large", url: "/customers?limit=100000", expectErr: true},
+		{tag: "invalid cursor", url: "/customers?cursor=%21%21", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tc.url, nil)
+			page, err := parsePage(r, customerSortColumns)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if page.Sort != tc.sort || page.Desc != tc.desc || page.Limit != tc.limit {
+				t.Fatalf("unexpected page %+v", page)
+			}
+		})
+	}
+}
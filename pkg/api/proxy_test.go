@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("expected no error parsing trusted proxies, got %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "forged header", remoteAddr: "203.0.113.7:5000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "203.0.113.7"},
+		{name: "forged real ip", remoteAddr: "203.0.113.7:5000", headers: map[string]string{"X-Real-IP": "198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:5000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "forged hop behind proxies", remoteAddr: "10.0.0.2:5000", headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 192.168.1.1"}, want: "198.51.100.1"},
+		{name: "trusted real ip", remoteAddr: "192.168.1.1:5000", headers: map[string]string{"X-Real-IP": "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "malformed header", remoteAddr: "10.0.0.2:5000", headers: map[string]string{"X-Forwarded-For": "unknown"}, want: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := realIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("expected client address %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"not-an-address"}); err == nil {
+		t.Errorf("expected an error for an invalid trusted proxy")
+	}
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -13,124 +16,452 @@ import (
 	"go.uber.org/zap"
 )
 
-func createQueue(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+// errQueueArchived is returned when changing a queue that has
+// been archived
+var errQueueArchived = errors.New("queue is archived")
+
+func createQueue(rubix *app.Rubix, queues db.QueueStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var queue db.Queue
-		err := json.NewDecoder(r.Body).Decode(&queue)
-		if err != nil {
-			handleServerError(w, "failed decoding request payload", err, logger)
+		if !decodePayload(w, r, &queue, logger) {
+			return
+		}
+
+		actor := actorFrom(r)
+		if actor.BranchID != nil {
+			if queue.BranchID != 0 && queue.BranchID != *actor.BranchID {
+				handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+				return
+			}
+			queue.BranchID = *actor.BranchID
+		}
+
+		if queue.BranchID == 0 {
+			handleBadRequest(w, "branchId is required", nil, logger)
+			return
+		}
+
+		if err := validateQueueLimits(r.Context(), queues, &queue); err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
 			return
 		}
 
-		repo := db.NewQueuesRepo(dbConn)
-		q, err := repo.Create(&queue)
+		queue.Status = app.QueueOpen
+		q, err := queues.Create(r.Context(), &queue)
 		if err != nil {
-			handleServerError(w, "failed creating queue", err, logger)
+			handleDBError(w, "failed creating queue", "queue", err, logger)
 			return
 		}
+		rubix.AddQueue(q.ID, q.BranchID)
 
+		auditAction(r, "queue.create", "queue", strconv.FormatInt(q.ID, 10))
+		auditAfter(r, q)
 		render.JSON(w, r, Response{Data: q, Info: "queue created successfully"})
 	}
 }
 
-func getAllQueues(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+var queueSortColumns = map[string]string{
+	"id":        "id",
+	"name":      "name",
+	"createdAt": "created_at",
+}
+
+func getAllQueues(queues db.QueueStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewQueuesRepo(dbConn)
-		queues, err := repo.GetAll()
+		page, err := parsePage(r, queueSortColumns)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		var filter db.QueueFilter
+		filter.IsActive, err = parseBoolParam(r, "isActive")
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+		filter.Name = r.URL.Query().Get("name")
+		filter.Status = r.URL.Query().Get("status")
+
+		filter.BranchID, err = branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		filter.From, err = parseDateParam(r.URL.Query().Get("from"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		filter.To, err = parseEndDateParam(r.URL.Query().Get("to"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		listed, hasMore, err := queues.List(r.Context(), filter, page)
 		if err != nil {
 			handleServerError(w, "failed fetching all queues", err, logger)
 			return
 		}
 
-		render.JSON(w, r, Response{Data: queues})
+		var lastID int64
+		if len(listed) > 0 {
+			lastID = listed[len(listed)-1].ID
+		}
+
+		render.JSON(w, r, Response{Data: listed, Pagination: newPagination(page, hasMore, lastID)})
 	}
 }
 
-func getActiveQueues(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func getActiveQueues(queues db.QueueStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewQueuesRepo(dbConn)
-		queues, err := repo.GetActive()
+		branchID, err := branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		var active []*db.Queue
+		if branchID == 0 {
+			active, err = queues.GetActive(r.Context())
+		} else {
+			active, err = queues.GetActiveInBranch(r.Context(), branchID)
+		}
 		if err != nil {
 			handleServerError(w, "failed fetching active queues", err, logger)
 			return
 		}
 
-		render.JSON(w, r, Response{Data: queues})
+		render.JSON(w, r, Response{Data: active})
 	}
 }
 
-func updateQueue(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func updateQueue(rubix *app.Rubix, queues db.QueueStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var queue db.Queue
-		err := json.NewDecoder(r.Body).Decode(&queue)
+		if !decodePayload(w, r, &queue, logger) {
+			return
+		}
+
+		auditAction(r, "queue.update", "queue", strconv.FormatInt(queue.ID, 10))
+
+		before, err := queues.Get(r.Context(), queue.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "queue does not exist", err, logger)
+			return
+		}
 		if err != nil {
-			handleServerError(w, "failed decoding request payload", err, logger)
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canAccessBranch(r, before.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
 			return
 		}
 
-		repo := db.NewQueuesRepo(dbConn)
-		updatedQueue, err := repo.Update(&queue)
+		if before.Status == app.QueueArchived {
+			handleConflict(w, errQueueArchived.Error(), errQueueArchived, logger)
+			return
+		}
+
+		queue.BranchID = before.BranchID
+		if err = validateQueueLimits(r.Context(), queues, &queue); err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		updatedQueue, err := queues.Update(r.Context(), &queue)
 		if err != nil {
-			handleServerError(w, "failed updating queue", err, logger)
+			handleDBError(w, "failed updating queue", "queue", err, logger)
 			return
 		}
+		rubix.SetQueueActive(updatedQueue.ID, updatedQueue.IsActive)
 
+		auditAfter(r, updatedQueue)
 		render.JSON(w, r, Response{Data: updatedQueue, Info: "queue updated successfully"})
 	}
 }
 
-func deleteQueue(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func setQueueStatus(rubix *app.Rubix, queues db.QueueStore, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		queueID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			handleBadRequest(w, "invalid queue id", err, logger)
+			return
+		}
+
+		var payload = struct {
+			Status string `json:"status" validate:"required"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		if !app.ValidQueueStatus(payload.Status) {
+			handleBadRequest(w, fmt.Sprintf("unknown status %q", payload.Status), nil, logger)
+			return
+		}
+
+		auditAction(r, "queue.set_status", "queue", id)
+
+		before, err := queues.Get(r.Context(), queueID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "queue does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canAccessBranch(r, before.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		if before.Status == app.QueueArchived {
+			handleConflict(w, errQueueArchived.Error(), errQueueArchived, logger)
+			return
+		}
+
+		var updated *db.Queue
+		if payload.Status == app.QueueArchived {
+			updated, err = archiveQueue(r.Context(), rubix, queues, queueID)
+		} else {
+			updated, err = changeQueueStatus(r.Context(), rubix, queues, before, payload.Status)
+		}
+		if err == app.ErrQueueNotEmpty {
+			handleConflict(w, "queue still has customers waiting, drain it first", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed updating queue status", err, logger)
+			return
+		}
+
+		auditAfter(r, updated)
+		render.JSON(w, r, Response{Data: updated, Info: fmt.Sprintf("queue is now %s", updated.Status)})
+	}
+}
+
+func deleteQueue(rubix *app.Rubix, queues db.QueueStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
-		queueID, err := strconv.Atoi(id)
+		queueID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			handleBadRequest(w, "invalid queue id", err, logger)
+			return
+		}
+
+		auditAction(r, "queue.archive", "queue", id)
+
+		before, err := queues.Get(r.Context(), queueID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "queue does not exist", err, logger)
+			return
+		}
 		if err != nil {
-			handleServerError(w, "failed converting url param", err, logger)
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+		auditBefore(r, before)
+
+		if !canAccessBranch(r, before.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		if before.Status == app.QueueArchived {
+			handleConflict(w, errQueueArchived.Error(), errQueueArchived, logger)
 			return
 		}
 
-		repo := db.NewQueuesRepo(dbConn)
-		err = repo.Delete(int64(queueID))
+		archived, err := archiveQueue(r.Context(), rubix, queues, queueID)
+		if err == app.ErrQueueNotEmpty {
+			handleConflict(w, "queue still has customers waiting, drain it first", err, logger)
+			return
+		}
 		if err != nil {
-			handleServerError(w, "failed updating queue", err, logger)
+			handleServerError(w, "failed archiving queue", err, logger)
 			return
 		}
 
-		render.JSON(w, r, Response{Info: "queue deleted successfully"})
+		auditAfter(r, archived)
+		render.JSON(w, r, Response{Data: archived, Info: "queue archived successfully"})
+	}
+}
+
+// changeQueueStatus moves a queue to an open, paused or draining
+// status. A draining queue with nobody waiting is archived at once.
+// Rubix is updated first, so a request retried after the database
+// failed finishes the change
+func changeQueueStatus(ctx context.Context, rubix *app.Rubix, queues db.QueueStore, q *db.Queue, status string) (*db.Queue, error) {
+	if err := rubix.SetQueueStatus(q.ID, q.BranchID, status); err != nil {
+		return nil, err
+	}
+
+	if rubix.Drained(q.ID) {
+		return archiveQueue(ctx, rubix, queues, q.ID)
+	}
+
+	return queues.SetStatus(ctx, q.ID, status)
+}
+
+// archiveQueue closes a queue for good once nobody is waiting on it.
+// Rubix keeps the queue as it was unless the database records the
+// archive, so a failed archive can be retried
+func archiveQueue(ctx context.Context, rubix *app.Rubix, queues db.QueueStore, queueID int64) (*db.Queue, error) {
+	var archived *db.Queue
+	err := rubix.ArchiveQueueWith(queueID, func() (err error) {
+		archived, err = queues.Archive(ctx, queueID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return archived, nil
+}
+
+// archiveIfDrained archives a draining queue once its last customer
+// has been called. Failures are logged rather than returned, as the
+// call that drained the queue has already succeeded; the queue stays
+// drained until ArchiveDrainedQueues archives it
+func archiveIfDrained(ctx context.Context, rubix *app.Rubix, queues db.QueueStore, queueID int64, logger *zap.Logger) {
+	if !rubix.Drained(queueID) {
+		return
+	}
+
+	if _, err := archiveQueue(ctx, rubix, queues, queueID); err != nil {
+		logger.Warn("failed archiving drained queue", zap.Int64("queue_id", queueID), zap.Error(err))
+		return
 	}
+
+	logger.Info("drained queue archived", zap.Int64("queue_id", queueID))
 }
 
-func notifyNextCustomer(rubix *app.Rubix, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+// ArchiveDrainedQueues archives the queues left draining with nobody
+// waiting, which no call will come to archive. Every queue is tried
+// and the first error met is returned
+func ArchiveDrainedQueues(ctx context.Context, rubix *app.Rubix, queues db.QueueStore) error {
+	var first error
+	for _, queueID := range rubix.DrainedQueues() {
+		_, err := archiveQueue(ctx, rubix, queues, queueID)
+		if err != nil && first == nil {
+			first = fmt.Errorf("failed archiving drained queue %d: %v", queueID, err)
+		}
+	}
+
+	return first
+}
+
+func notifyNextCustomer(rubix *app.Rubix, stores *db.Stores, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload = struct {
-			QueuID    int64 `json:"queueId"`
+			QueuID    int64 `json:"queueId" validate:"required"`
 			CounterID int64 `json:"counterId"`
 		}{}
 
-		err := json.NewDecoder(r.Body).Decode(&payload)
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "queue.call_next", "queue", strconv.FormatInt(payload.QueuID, 10))
+
+		queue, err := stores.Queues.Get(r.Context(), payload.QueuID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "queue does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		if !canAccessBranch(r, queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		// customers can be called without a counter, in which
+		// case they are not told where to go
+		var counterName string
+		if payload.CounterID != 0 {
+			counter, err := db.NewCountersRepo(dbConn).Get(r.Context(), payload.CounterID)
+			if err == sql.ErrNoRows {
+				handleBadRequest(w, "counter does not exist", err, logger)
+				return
+			}
+			if err != nil {
+				handleServerError(w, "failed fetching counter", err, logger)
+				return
+			}
+
+			if counter.BranchID != queue.BranchID {
+				handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+				return
+			}
+			counterName = counter.Name
+		}
+
+		customer, err := rubix.NotifyNextCustomer(r.Context(), queue.ID, counterName)
+		if err == app.ErrNoWaitingCustomers {
+			handleConflict(w, err.Error(), err, logger)
+			return
+		}
 		if err != nil {
-			handleServerError(w, "failed decoding request payload", err, logger)
+			handleServerError(w, "failed notifying next customer", err, logger)
 			return
 		}
 
-		customerID := rubix.NotifyNextCustomer(payload.QueuID, payload.CounterID)
-		repo := db.NewCustomersRepo(dbConn)
-		err = repo.MarkAsServed(customerID)
+		served, err := markCalledAsServed(r.Context(), rubix, stores.Customers, customer)
 		if err != nil {
 			handleServerError(w, "failed marking customer as served", err, logger)
 			return
 		}
+		archiveIfDrained(r.Context(), rubix, stores.Queues, queue.ID, logger)
 
-		render.JSON(w, r, Response{Info: "next customer notified"})
+		auditAfter(r, served)
+		render.JSON(w, r, Response{Data: served, Info: "next customer notified"})
 	}
 }
 
-func queuesRoutes(dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+// markCalledAsServed marks a customer called from a wait list as
+// served and returns their updated record. With a coordinator, rubix
+// already marked them as served when it claimed them
+func markCalledAsServed(ctx context.Context, rubix *app.Rubix, customers db.CustomerStore, customer *app.CustomerInfo) (*db.Customer, error) {
+	if !rubix.Coordinated() {
+		err := customers.MarkAsServed(ctx, int(customer.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return customers.Get(ctx, customer.ID)
+}
+
+func queuesRoutes(rubix *app.Rubix, stores *db.Stores, dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
 	router := chi.NewRouter()
-	router.Post("/", createQueue(dbConn, logger))
-	router.Get("/", getAllQueues(dbConn, logger))
-	router.Get("/active", getActiveQueues(dbConn, logger))
-	router.Put("/", updateQueue(dbConn, logger))
-	router.Delete("/{id}", deleteQueue(dbConn, logger))
+	router.With(requireAdmin).Post("/", createQueue(rubix, stores.Queues, logger))
+	router.With(requireAuth).Get("/", getAllQueues(stores.Queues, logger))
+	router.Get("/active", getActiveQueues(stores.Queues, logger))
+	router.With(requireAdmin).Put("/", updateQueue(rubix, stores.Queues, logger))
+	router.With(requireAdmin).Delete("/{id}", deleteQueue(rubix, stores.Queues, logger))
+	router.With(requireAdmin).Put("/{id}/status", setQueueStatus(rubix, stores.Queues, logger))
+	router.With(requireAuth).Post("/next", notifyNextCustomer(rubix, stores, dbConn, logger))
+	router.Get("/hours", getQueueHours(dbConn, logger))
+	router.With(requireAdmin).Put("/hours", setQueueHours(stores.Queues, dbConn, logger))
+	router.Get("/closures", getQueueClosures(dbConn, logger))
+	router.With(requireAdmin).Post("/closures", createQueueClosure(stores.Queues, dbConn, logger))
+	router.With(requireAdmin).Delete("/closures", deleteQueueClosure(stores.Queues, dbConn, logger))
 
 	return router
 }
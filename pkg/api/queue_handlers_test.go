@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// claimingCoordinator is a coordinator that lets
+// every call it is asked about go ahead
+type claimingCoordinator struct{}
+
+func (claimingCoordinator) NextTicket(ctx context.Context, branchID int64) (int, error) {
+	return 1, nil
+}
+
+func (claimingCoordinator) ResumeTickets(ctx context.Context, branchID int64, next int) error {
+	return nil
+}
+
+func (claimingCoordinator) ResetTickets(ctx context.Context, branchID int64, at time.Time) error {
+	return nil
+}
+
+func (claimingCoordinator) Claim(ctx context.Context, customerID int64) (bool, error) {
+	return true, nil
+}
+
+// fakeQueues is a queue store whose archives
+// fail until it is told to let them through
+type fakeQueues struct {
+	db.QueueStore
+	failArchive bool
+}
+
+func (s *fakeQueues) Archive(ctx context.Context, id int64) (*db.Queue, error) {
+	if s.failArchive {
+		return nil, errors.New("database unavailable")
+	}
+	return &db.Queue{ID: id, Status: app.QueueArchived}, nil
+}
+
+func TestArchiveIfDrained(t *testing.T) {
+	rubix := app.NewRubix(nil, zap.NewNop())
+	rubix.AddQueue(1, 1)
+	if err := rubix.SetQueueStatus(1, 1, app.QueueDraining); err != nil {
+		t.Fatalf("unexpected error draining queue: %v", err)
+	}
+
+	queues := &fakeQueues{failArchive: true}
+	archiveIfDrained(context.Background(), rubix, queues, 1, zap.NewNop())
+	if rubix.QueueStatus(1) != app.QueueDraining {
+		t.Fatalf("expected the queue to stay draining when the database fails, got %s", rubix.QueueStatus(1))
+	}
+
+	if err := ArchiveDrainedQueues(context.Background(), rubix, queues); err == nil {
+		t.Fatalf("expected an error while the database fails")
+	}
+
+	queues.failArchive = false
+	if err := ArchiveDrainedQueues(context.Background(), rubix, queues); err != nil {
+		t.Fatalf("expected no error archiving drained queues, got %v", err)
+	}
+	if rubix.QueueStatus(1) != app.QueueArchived {
+		t.Errorf("expected the queue to be archived on retry, got %s", rubix.QueueStatus(1))
+	}
+}
+
+func TestMarkCalledAsServed(t *testing.T) {
+	rubix := app.NewRubix(nil, zap.NewNop())
+	customers := &fakeCustomers{}
+	customer := &app.CustomerInfo{ID: 7}
+
+	served, err := markCalledAsServed(context.Background(), rubix, customers, customer)
+	if err != nil || served.ID != 7 {
+		t.Fatalf("expected the called customer, got %+v (%v)", served, err)
+	}
+	if len(customers.served) != 1 || customers.served[0] != 7 {
+		t.Errorf("expected customer to be marked as served without a coordinator, got %v", customers.served)
+	}
+
+	customers.served = nil
+	rubix.SetCoordinator(claimingCoordinator{})
+	if _, err := markCalledAsServed(context.Background(), rubix, customers, customer); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(customers.served) != 0 {
+		t.Errorf("expected the coordinator's claim to be left to mark the customer, got %v", customers.served)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/phone"
+	"go.uber.org/zap"
+)
+
+// sweepInterval is how often buckets that have refilled are dropped,
+// so clients seen once do not stay in memory
+const sweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per client. Buckets hold up to
+// 'burst' tokens and refill at 'rate' tokens a second; a request
+// takes a token and is refused when the bucket is empty
+type rateLimiter struct {
+	lock    sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// newRateLimiter returns a limiter letting each client make perMinute
+// requests a minute, all at once if it has been idle
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}
+}
+
+// refill tops a bucket up with the tokens earned since it was last used
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+}
+
+// take removes a token from the bucket of a client. If the bucket
+// is empty, false is returned along with how long until it holds
+// a token again
+func (l *rateLimiter) take(client string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	if now.Sub(l.swept) >= sweepInterval {
+		for c, b := range l.buckets {
+			l.refill(b, now)
+			if b.tokens >= l.burst {
+				delete(l.buckets, c)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// rateLimit refuses requests with a 429 once the client named by
+// clientOf has used up its bucket. Requests clientOf returns an
+// empty string for are not limited. A nil limiter disables the
+// middleware
+func rateLimit(limiter *rateLimiter, clientOf func(*http.Request) string, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := clientOf(r)
+			if client == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, wait := limiter.take(client)
+			if !ok {
+				seconds := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				logger.Warn("rate limit exceeded", zap.String("client", client), zap.String("path", r.URL.Path))
+				writeProblem(w, newProblem(http.StatusTooManyRequests, CodeRateLimited, "too many requests, retry in "+strconv.Itoa(seconds)+"s"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limiterFor returns a limiter allowing perMinute requests a
+// minute, or nil when perMinute disables limiting
+func limiterFor(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return newRateLimiter(perMinute)
+}
+
+// anonymousIP names anonymous clients by address. Signed in staff
+// and devices are left to their own limits, as a branch's desks
+// and kiosks usually share one address
+func anonymousIP(r *http.Request) string {
+	if actorFrom(r) != nil || deviceFrom(r) != nil {
+		return ""
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+// deviceID names the device making a request
+func deviceID(r *http.Request) string {
+	device := deviceFrom(r)
+	if device == nil {
+		return ""
+	}
+
+	return "device:" + strconv.FormatInt(device.ID, 10)
+}
+
+// payloadMsisdn names the phone number a request is made for,
+// read from the msisdn field of its payload. The body is put
+// back for the handler to decode
+func payloadMsisdn(config Config) func(*http.Request) string {
+	return func(r *http.Request) string {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return ""
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var payload struct {
+			Msisdn string `json:"msisdn"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || payload.Msisdn == "" {
+			return ""
+		}
+
+		msisdn, err := phone.Normalize(payload.Msisdn, config.DefaultCountry)
+		if err != nil {
+			return ""
+		}
+
+		return "msisdn:" + msisdn
+	}
+}
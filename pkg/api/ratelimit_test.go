@@ -0,0 +1,116 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	now := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.take("a"); !ok {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	ok, wait := limiter.take("a")
+	if ok {
+		t.Fatalf("expected third request to be refused")
+	}
+	if wait != 30*time.Second {
+		t.Errorf("expected to wait 30s, got %v", wait)
+	}
+
+	if ok, _ := limiter.take("b"); !ok {
+		t.Errorf("expected another client to be allowed")
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, _ := limiter.take("a"); !ok {
+		t.Errorf("expected request to be allowed once a token was earned")
+	}
+
+	now = now.Add(2 * time.Minute)
+	limiter.take("c")
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Errorf("expected refilled bucket to be swept")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := newRateLimiter(1)
+	handler := rateLimit(limiter, payloadMsisdn(Config{DefaultCountry: "GH"}), zap.NewNop())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil || len(body) == 0 {
+				t.Errorf("expected payload to reach the handler")
+			}
+		}),
+	)
+
+	send := func(msisdn string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/customers/", strings.NewReader(`{"queueId":1,"msisdn":"`+msisdn+`"}`)))
+		return w
+	}
+
+	if w := send("0200662782"); w.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", w.Code)
+	}
+
+	w := send("+233200662782")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the same number written differently to be limited, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("expected Retry-After 60, got %q", got)
+	}
+
+	if w := send("0244000000"); w.Code != http.StatusOK {
+		t.Errorf("expected another number to pass, got %d", w.Code)
+	}
+}
+
+func TestRateLimitForgedForwardedFor(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	limiter := newRateLimiter(1)
+	handler := realIP(trusted)(rateLimit(limiter, anonymousIP, zap.NewNop())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	))
+
+	send := func(remoteAddr, forwardedFor string) int {
+		r := httptest.NewRequest(http.MethodGet, "/queues/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := send("203.0.113.7:5000", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", code)
+	}
+	if code := send("203.0.113.7:5000", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("expected a forged X-Forwarded-For not to escape the limit, got %d", code)
+	}
+
+	if code := send("10.0.0.2:5000", "198.51.100.3"); code != http.StatusOK {
+		t.Errorf("expected a client behind a trusted proxy to be limited on its own, got %d", code)
+	}
+	if code := send("10.0.0.2:5000", "198.51.100.3"); code != http.StatusTooManyRequests {
+		t.Errorf("expected a client behind a trusted proxy to be limited, got %d", code)
+	}
+}
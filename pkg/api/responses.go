@@ -1,16 +1,81 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/hackstock/rubixcore/pkg/db"
 	"go.uber.org/zap"
 )
 
 // Response represent a response sent to
 // clients when request is successful
 type Response struct {
-	Data interface{} `json:"data"`
-	Info string      `json:"info"`
+	Data       interface{} `json:"data"`
+	Info       string      `json:"info"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes the position of a page of results
+// returned by a list endpoint. NextCursor is passed back as
+// the cursor query parameter to fetch the following page
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Error codes let clients tell failed requests apart
+// without parsing messages
+const (
+	CodeMalformedPayload = "malformed_payload"
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeDuplicate        = "duplicate"
+	CodeKeyReused        = "idempotency_key_reused"
+	CodeTicketLimit      = "ticket_limit_reached"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+)
+
+// problemContentType is the media type of problem details
+const problemContentType = "application/problem+json"
+
+// FieldErrors maps fields of a request payload or query
+// to what is wrong with their values
+type FieldErrors map[string]string
+
+// Problem is sent to clients when a request fails, following
+// RFC 7807. 'Code' identifies the kind of failure and 'Errors'
+// lists invalid fields of the request
+type Problem struct {
+	Type   string      `json:"type"`
+	Title  string      `json:"title"`
+	Status int         `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Code   string      `json:"code"`
+	Errors FieldErrors `json:"errors,omitempty"`
+}
+
+func newProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "urn:rubixcore:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
 }
 
 func handleError(
@@ -19,9 +84,36 @@ func handleError(
 	err error,
 	logger *zap.Logger,
 	code int,
+	errorCode string,
+) {
+	if code >= http.StatusInternalServerError {
+		logger.Error(msg, zap.Error(err))
+	} else {
+		logger.Warn(msg, zap.Error(err))
+	}
+
+	writeProblem(w, newProblem(code, errorCode, msg))
+}
+
+func handleMalformedPayload(
+	w http.ResponseWriter,
+	err error,
+	logger *zap.Logger,
 ) {
-	logger.Warn(msg, zap.Error(err))
-	http.Error(w, msg, code)
+	handleError(w, "failed decoding request payload", err, logger, http.StatusBadRequest, CodeMalformedPayload)
+}
+
+func handleInvalidFields(
+	w http.ResponseWriter,
+	r *http.Request,
+	fields FieldErrors,
+	logger *zap.Logger,
+) {
+	logger.Warn("invalid request fields", zap.String("path", r.URL.Path), zap.Any("fields", fields))
+
+	p := newProblem(http.StatusBadRequest, CodeValidationFailed, "one or more fields are invalid")
+	p.Errors = fields
+	writeProblem(w, p)
 }
 
 func handleBadRequest(
@@ -30,7 +122,34 @@ func handleBadRequest(
 	err error,
 	logger *zap.Logger,
 ) {
-	handleError(w, msg, err, logger, http.StatusBadRequest)
+	handleError(w, msg, err, logger, http.StatusBadRequest, CodeInvalidRequest)
+}
+
+func handleUnauthorized(
+	w http.ResponseWriter,
+	msg string,
+	err error,
+	logger *zap.Logger,
+) {
+	handleError(w, msg, err, logger, http.StatusUnauthorized, CodeUnauthorized)
+}
+
+func handleForbidden(
+	w http.ResponseWriter,
+	msg string,
+	err error,
+	logger *zap.Logger,
+) {
+	handleError(w, msg, err, logger, http.StatusForbidden, CodeForbidden)
+}
+
+func handleNotFound(
+	w http.ResponseWriter,
+	msg string,
+	err error,
+	logger *zap.Logger,
+) {
+	handleError(w, msg, err, logger, http.StatusNotFound, CodeNotFound)
 }
 
 func handleServerError(
@@ -39,5 +158,36 @@ func handleServerError(
 	err error,
 	logger *zap.Logger,
 ) {
-	handleError(w, msg, err, logger, http.StatusInternalServerError)
+	handleError(w, msg, err, logger, http.StatusInternalServerError, CodeInternal)
+}
+
+func handleConflict(
+	w http.ResponseWriter,
+	msg string,
+	err error,
+	logger *zap.Logger,
+) {
+	handleError(w, msg, err, logger, http.StatusConflict, CodeConflict)
+}
+
+// handleDBError reports a failed write, telling clients when it
+// failed because of their input rather than an outage. 'what'
+// names the record being written, such as "queue"
+func handleDBError(
+	w http.ResponseWriter,
+	msg string,
+	what string,
+	err error,
+	logger *zap.Logger,
+) {
+	switch {
+	case db.IsDuplicateKey(err):
+		handleError(w, "a "+what+" with the same name already exists", err, logger, http.StatusConflict, CodeDuplicate)
+	case db.IsMissingReference(err):
+		handleError(w, what+" refers to a record that does not exist", err, logger, http.StatusBadRequest, CodeInvalidRequest)
+	case db.IsReferenced(err):
+		handleError(w, what+" is still in use", err, logger, http.StatusConflict, CodeConflict)
+	default:
+		handleServerError(w, msg, err, logger)
+	}
 }
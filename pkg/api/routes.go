@@ -5,6 +5,8 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/gorilla/websocket"
 	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/hackstock/rubixcore/pkg/metrics"
 	"github.com/jmoiron/sqlx"
 	"github.com/streadway/amqp"
 	"go.uber.org/zap"
@@ -16,19 +18,42 @@ func InitRoutes(
 	brokerConn *amqp.Connection,
 	dbConn *sqlx.DB,
 	upgrader *websocket.Upgrader,
+	config Config,
 	logger *zap.Logger,
 ) *chi.Mux {
+	stores := db.NewStores(dbConn)
+
 	router := chi.NewRouter()
 	router.Use(
+		realIP(config.TrustedProxies),
 		middleware.Logger,
+		instrument,
+		identifyActor(config),
+		identifyDevice(dbConn, logger),
+		audit(dbConn, logger),
 		/*middleware.DefaultCompress,
 		middleware.RedirectSlashes,
 		middleware.Recoverer,*/
 	)
 
-	router.Mount("/users", usersRoutes(dbConn, logger))
-	router.Mount("/queues", queuesRoutes(dbConn, logger))
-	router.Mount("/customers", customersRoutes(rubix, dbConn, logger))
+	router.Handle("/metrics", metrics.Handler())
+	router.Get("/healthz", liveness())
+	router.Get("/readyz", readiness(rubix, brokerConn, dbConn, logger))
+	router.Mount("/branches", branchesRoutes(rubix, dbConn, config, logger))
+	router.Mount("/users", usersRoutes(stores.Users, config, logger))
+	router.Mount("/queues", queuesRoutes(rubix, stores, dbConn, logger))
+	router.Mount("/devices", devicesRoutes(dbConn, logger))
+	router.Mount("/counters", countersRoutes(rubix, stores, dbConn, logger))
+	router.Mount("/appointments", appointmentsRoutes(rubix, dbConn, config, logger))
+	router.Mount("/customers", customersRoutes(rubix, stores, dbConn, config, logger))
+	router.Mount("/exports", exportsRoutes(stores, logger))
+	router.Mount("/audit", auditRoutes(dbConn, logger))
+
+	events := router.With()
+	if config.RequireDeviceKey {
+		events = router.With(requireUserOrDevice)
+	}
+	events.Get("/events", streamEvents(rubix, config, logger))
 
 	return router
 }
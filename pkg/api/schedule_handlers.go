@@ -0,0 +1,312 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// loadSchedule builds the schedule of a queue from its opening
+// hours and the closures that have not ended yet
+func loadSchedule(ctx context.Context, dbConn *sqlx.DB, queueID int64, location *time.Location) (*app.Schedule, error) {
+	repo := db.NewSchedulesRepo(dbConn)
+	hours, err := repo.GetHours(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	closures, err := repo.GetClosures(ctx, queueID, time.Now().In(location))
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &app.Schedule{Location: location, Hours: map[time.Weekday]app.OpeningHours{}}
+	for _, h := range hours {
+		opening, err := toOpeningHours(h)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Hours[time.Weekday(h.Weekday)] = opening
+	}
+
+	for _, c := range closures {
+		schedule.Closures = append(schedule.Closures, app.Closure{
+			From:   c.StartsOn.Format("2006-01-02"),
+			To:     c.EndsOn.Format("2006-01-02"),
+			Reason: c.Reason,
+		})
+	}
+
+	return schedule, nil
+}
+
+// toOpeningHours validates the opening hours of a weekday
+func toOpeningHours(h *db.QueueHours) (app.OpeningHours, error) {
+	var opening app.OpeningHours
+	if h.Weekday < 0 || h.Weekday > 6 {
+		return opening, errors.New("weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+
+	var err error
+	opening.Opens, err = app.ParseClock(h.OpensAt)
+	if err != nil {
+		return opening, err
+	}
+
+	opening.Closes, err = app.ParseClock(h.ClosesAt)
+	if err != nil {
+		return opening, err
+	}
+
+	if opening.Closes <= opening.Opens {
+		return opening, errors.New("closesAt must be after opensAt")
+	}
+
+	if h.LastAdmission != nil {
+		opening.LastAdmission, err = app.ParseClock(*h.LastAdmission)
+		if err != nil {
+			return opening, err
+		}
+
+		if opening.LastAdmission <= opening.Opens || opening.LastAdmission > opening.Closes {
+			return opening, errors.New("lastAdmission must be between opensAt and closesAt")
+		}
+	}
+
+	return opening, nil
+}
+
+// closedQueueMessage tells a customer when a closed queue reopens
+func closedQueueMessage(queue *db.Queue, schedule *app.Schedule, now time.Time) string {
+	msg := fmt.Sprintf("%s is closed", queue.Name)
+	if closure, ok := schedule.ClosureOn(now); ok && closure.Reason != "" {
+		msg += fmt.Sprintf(" (%s)", closure.Reason)
+	}
+
+	opens, ok := schedule.NextOpening(now)
+	if !ok {
+		return msg + "."
+	}
+
+	return msg + fmt.Sprintf(" and reopens on %s.", opens.Format("Mon 2 Jan at 15:04"))
+}
+
+// parseQueueID reads the required queueId query parameter
+func parseQueueID(r *http.Request) (int64, error) {
+	v := r.URL.Query().Get("queueId")
+	queueID, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid queueId %q", v)
+	}
+
+	return queueID, nil
+}
+
+func getQueueHours(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		queueID, err := parseQueueID(r)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		hours, err := db.NewSchedulesRepo(dbConn).GetHours(r.Context(), queueID)
+		if err != nil {
+			handleServerError(w, "failed fetching queue hours", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Data: hours})
+	}
+}
+
+func setQueueHours(queues db.QueueStore, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			QueueID int64            `json:"queueId" validate:"required"`
+			Hours   []*db.QueueHours `json:"hours"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		weekdays := map[int]bool{}
+		for _, h := range payload.Hours {
+			if _, err := toOpeningHours(h); err != nil {
+				handleBadRequest(w, err.Error(), err, logger)
+				return
+			}
+
+			if weekdays[h.Weekday] {
+				handleBadRequest(w, fmt.Sprintf("weekday %d is listed more than once", h.Weekday), nil, logger)
+				return
+			}
+			weekdays[h.Weekday] = true
+		}
+
+		auditAction(r, "queue.hours.update", "queue", strconv.FormatInt(payload.QueueID, 10))
+
+		queue, err := queues.Get(r.Context(), payload.QueueID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "queue does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		if !canAccessBranch(r, queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		repo := db.NewSchedulesRepo(dbConn)
+		before, err := repo.GetHours(r.Context(), queue.ID)
+		if err == nil {
+			auditBefore(r, before)
+		}
+
+		hours, err := repo.SetHours(r.Context(), queue.ID, payload.Hours)
+		if err != nil {
+			handleServerError(w, "failed updating queue hours", err, logger)
+			return
+		}
+
+		auditAfter(r, hours)
+		render.JSON(w, r, Response{Data: hours, Info: "queue hours updated successfully"})
+	}
+}
+
+func getQueueClosures(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		queueID, err := parseQueueID(r)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		closures, err := db.NewSchedulesRepo(dbConn).GetClosures(r.Context(), queueID, time.Now())
+		if err != nil {
+			handleServerError(w, "failed fetching queue closures", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Data: closures})
+	}
+}
+
+func createQueueClosure(queues db.QueueStore, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			QueueID  int64  `json:"queueId" validate:"required"`
+			StartsOn string `json:"startsOn" validate:"required"`
+			EndsOn   string `json:"endsOn" validate:"required"`
+			Reason   string `json:"reason" validate:"max=255"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		startsOn, err := time.Parse("2006-01-02", payload.StartsOn)
+		if err != nil {
+			handleInvalidFields(w, r, FieldErrors{"startsOn": "must be a date formatted as YYYY-MM-DD"}, logger)
+			return
+		}
+
+		endsOn, err := time.Parse("2006-01-02", payload.EndsOn)
+		if err != nil {
+			handleInvalidFields(w, r, FieldErrors{"endsOn": "must be a date formatted as YYYY-MM-DD"}, logger)
+			return
+		}
+
+		closure := &db.QueueClosure{QueueID: payload.QueueID, StartsOn: startsOn, EndsOn: endsOn, Reason: payload.Reason}
+
+		if closure.EndsOn.Before(closure.StartsOn) {
+			handleBadRequest(w, "endsOn must not be before startsOn", nil, logger)
+			return
+		}
+
+		queue, err := queues.Get(r.Context(), payload.QueueID)
+		if err == sql.ErrNoRows {
+			handleBadRequest(w, "queue does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		if !canAccessBranch(r, queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		c, err := db.NewSchedulesRepo(dbConn).CreateClosure(r.Context(), closure)
+		if err != nil {
+			handleServerError(w, "failed creating queue closure", err, logger)
+			return
+		}
+
+		auditAction(r, "queue.closure.create", "queue_closure", strconv.FormatInt(c.ID, 10))
+		auditAfter(r, c)
+		render.JSON(w, r, Response{Data: c, Info: "queue closure created successfully"})
+	}
+}
+
+func deleteQueueClosure(queues db.QueueStore, dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			ID int64 `json:"id" validate:"required"`
+		}{}
+
+		if !decodePayload(w, r, &payload, logger) {
+			return
+		}
+
+		auditAction(r, "queue.closure.delete", "queue_closure", strconv.FormatInt(payload.ID, 10))
+
+		repo := db.NewSchedulesRepo(dbConn)
+		closure, err := repo.GetClosure(r.Context(), payload.ID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "queue closure does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching queue closure", err, logger)
+			return
+		}
+		auditBefore(r, closure)
+
+		queue, err := queues.Get(r.Context(), closure.QueueID)
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		if !canAccessBranch(r, queue.BranchID) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		err = repo.DeleteClosure(r.Context(), payload.ID)
+		if err != nil {
+			handleServerError(w, "failed deleting queue closure", err, logger)
+			return
+		}
+
+		render.JSON(w, r, Response{Info: "queue closure deleted successfully"})
+	}
+}
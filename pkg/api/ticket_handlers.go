@@ -0,0 +1,142 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/hackstock/rubixcore/pkg/app"
+	"github.com/hackstock/rubixcore/pkg/db"
+	"github.com/hackstock/rubixcore/pkg/ticket"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Formats a ticket can be rendered in
+const (
+	ticketFormatText   = "text"
+	ticketFormatEscPos = "escpos"
+)
+
+// ticketStatusURL returns the link to a customer's ticket status
+// page, or an empty string if no status page is configured
+func ticketStatusURL(config Config, customerID int64) string {
+	if config.TicketStatusURL == "" {
+		return ""
+	}
+
+	return strings.TrimRight(config.TicketStatusURL, "/") + "/" + strconv.FormatInt(customerID, 10)
+}
+
+// branchTicketTemplate returns the ticket template of a branch,
+// falling back to the default layout
+func branchTicketTemplate(branch *db.Branch) (*ticket.Template, error) {
+	if branch.TicketTemplate == nil || *branch.TicketTemplate == "" {
+		return ticket.Default, nil
+	}
+
+	return ticket.Parse(*branch.TicketTemplate)
+}
+
+// canPrintTicket returns true if the request may render the ticket
+// of a customer. Anonymous kiosks may only print the tickets of
+// customers still waiting, and only while device keys are not required
+func canPrintTicket(r *http.Request, config Config, customer *db.Customer) bool {
+	if isAnonymous(r) {
+		return !config.RequireDeviceKey && customer.ServedAt == nil
+	}
+
+	return canAccessBranch(r, customer.BranchID)
+}
+
+func getCustomerTicket(rubix *app.Rubix, stores *db.Stores, dbConn *sqlx.DB, config Config, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = ticketFormatText
+		}
+
+		if format != ticketFormatText && format != ticketFormatEscPos {
+			handleBadRequest(w, "format must be text or escpos", nil, logger)
+			return
+		}
+
+		customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			handleBadRequest(w, "invalid customer id", err, logger)
+			return
+		}
+
+		customer, err := stores.Customers.Get(r.Context(), customerID)
+		if err == sql.ErrNoRows {
+			handleNotFound(w, "customer does not exist", err, logger)
+			return
+		}
+		if err != nil {
+			handleServerError(w, "failed fetching customer", err, logger)
+			return
+		}
+
+		if !canPrintTicket(r, config, customer) {
+			handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+			return
+		}
+
+		queue, err := stores.Queues.Get(r.Context(), customer.QueueID)
+		if err != nil {
+			handleServerError(w, "failed fetching queue", err, logger)
+			return
+		}
+
+		branch, err := db.NewBranchesRepo(dbConn).Get(r.Context(), customer.BranchID)
+		if err != nil {
+			handleServerError(w, "failed fetching branch", err, logger)
+			return
+		}
+
+		location, err := time.LoadLocation(branch.Timezone)
+		if err != nil {
+			handleServerError(w, "failed loading branch timezone", err, logger)
+			return
+		}
+
+		tmpl, err := branchTicketTemplate(branch)
+		if err != nil {
+			handleServerError(w, "failed parsing branch ticket template", err, logger)
+			return
+		}
+
+		issuedAt := time.Now()
+		if customer.CreatedAt != nil {
+			issuedAt = *customer.CreatedAt
+		}
+
+		// customers who have been served no longer have a wait
+		wait, _ := rubix.EstimatedWaitFor(queue.ID, customer.ID)
+		t := ticket.New(branch.Name, queue.Name, customer.Ticket, wait, issuedAt.In(location), ticketStatusURL(config, customer.ID))
+
+		lines, err := tmpl.Lines(t)
+		if err != nil {
+			handleServerError(w, "failed rendering ticket", err, logger)
+			return
+		}
+
+		if format == ticketFormatEscPos {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(ticket.EscPos(lines, config.TicketWidth))
+			return
+		}
+
+		text, err := ticket.PlainText(lines, config.TicketWidth)
+		if err != nil {
+			handleServerError(w, "failed rendering ticket", err, logger)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(text))
+	}
+}
@@ -1,49 +1,113 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
 	"net/http"
-	"time"
+	"strconv"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 	"github.com/hackstock/rubixcore/pkg/db"
-	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
-func getAllUsers(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+var userSortColumns = map[string]string{
+	"id":        "id",
+	"username":  "username",
+	"createdAt": "created_at",
+}
+
+func getAllUsers(users db.UserStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewUsersRepo(dbConn)
-		users, err := repo.GetAll()
+		page, err := parsePage(r, userSortColumns)
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		var filter db.UserFilter
+		filter.IsAdmin, err = parseBoolParam(r, "isAdmin")
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+		filter.Username = r.URL.Query().Get("username")
+
+		filter.BranchID, err = branchScope(r)
+		if err != nil {
+			handleScopeError(w, err, logger)
+			return
+		}
+
+		filter.From, err = parseDateParam(r.URL.Query().Get("from"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		filter.To, err = parseEndDateParam(r.URL.Query().Get("to"))
+		if err != nil {
+			handleBadRequest(w, err.Error(), err, logger)
+			return
+		}
+
+		accounts, hasMore, err := users.List(r.Context(), filter, page)
 		if err != nil {
 			handleServerError(w, "failed fetching all users", err, logger)
 			return
 		}
 
-		render.JSON(w, r, Response{Data: users})
+		var lastID int64
+		if len(accounts) > 0 {
+			lastID = accounts[len(accounts)-1].ID
+		}
+
+		render.JSON(w, r, Response{Data: accounts, Pagination: newPagination(page, hasMore, lastID)})
 	}
 }
 
-func createUser(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func createUser(users db.UserStore, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload = struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
+			Username string `json:"username" validate:"required,max=255"`
+			Password string `json:"password" validate:"required,min=8,max=72"`
 			IsAdmin  bool   `json:"isAdmin"`
+			BranchID *int64 `json:"branchId"`
 		}{}
 
-		err := json.NewDecoder(r.Body).Decode(&payload)
-		if err != nil {
-			handleBadRequest(w, "failed decoding request payload", err, logger)
+		if !decodePayload(w, r, &payload, logger) {
 			return
 		}
 
+		// the very first account can be created anonymously so
+		// that a fresh installation can be bootstrapped
+		actor := actorFrom(r)
+		if actor == nil || !actor.IsAdmin {
+			count, err := users.Count(r.Context())
+			if err != nil {
+				handleServerError(w, "failed counting user accounts", err, logger)
+				return
+			}
+
+			if count > 0 {
+				handleForbidden(w, "administrator access required", nil, logger)
+				return
+			}
+		}
+
+		if actor != nil && actor.BranchID != nil {
+			if payload.BranchID != nil && *payload.BranchID != *actor.BranchID {
+				handleForbidden(w, errBranchForbidden.Error(), errBranchForbidden, logger)
+				return
+			}
+			payload.BranchID = actor.BranchID
+		}
+
 		account := &db.UserAccount{
 			Username: payload.Username,
 			Password: payload.Password,
 			IsAdmin:  payload.IsAdmin,
+			BranchID: payload.BranchID,
 		}
 
 		hash, err := hashPassword(account.Password)
@@ -53,42 +117,46 @@ func createUser(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 		}
 		account.Password = hash
 
-		repo := db.NewUsersRepo(dbConn)
-		u, err := repo.Create(account)
+		u, err := users.Create(r.Context(), account)
 		if err != nil {
-			handleServerError(w, "failed saving user into db", err, logger)
+			handleDBError(w, "failed saving user into db", "user", err, logger)
 			return
 		}
 
+		auditAction(r, "user.create", "user", strconv.FormatInt(u.ID, 10))
+		auditAfter(r, u)
 		render.JSON(w, r, Response{Data: u, Info: "account created successfully"})
 	}
 }
 
-func authenticate(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func authenticate(users db.UserStore, config Config, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var credentials = struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
+			Username string `json:"username" validate:"required"`
+			Password string `json:"password" validate:"required"`
 		}{}
 
-		err := json.NewDecoder(r.Body).Decode(&credentials)
-		if err != nil {
-			handleServerError(w, "failed decoding request payload", err, logger)
+		if !decodePayload(w, r, &credentials, logger) {
 			return
 		}
 
-		repo := db.NewUsersRepo(dbConn)
-		account, err := repo.GetByUsername(credentials.Username)
+		account, err := users.GetByUsername(r.Context(), credentials.Username)
+		if err == sql.ErrNoRows {
+			handleUnauthorized(w, "invalid username or password", err, logger)
+			return
+		}
 		if err != nil {
 			handleServerError(w, "failed fetching account", err, logger)
 			return
 		}
 
 		if comparePasswords(account.Password, credentials.Password) == false {
-			handleServerError(w, "failed comparing passwords", err, logger)
+			handleUnauthorized(w, "invalid username or password", nil, logger)
 			return
 		}
-		token, err := generateJWT()
+		auditAction(r, "user.login", "user", strconv.FormatInt(account.ID, 10))
+
+		token, err := generateJWT(account, config)
 		if err != nil {
 			handleServerError(w, "failed generating JWT", err, logger)
 			return
@@ -105,24 +173,11 @@ func authenticate(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 	}
 }
 
-func generateJWT() (string, error) {
-	now := time.Now()
-	claims := jwt.StandardClaims{
-		Issuer:    "rubix",
-		IssuedAt:  now.Unix(),
-		ExpiresAt: now.Add(24 * 7 * time.Hour).Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	return token.SignedString([]byte(`secret`))
-}
-
-func usersRoutes(dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+func usersRoutes(users db.UserStore, config Config, logger *zap.Logger) *chi.Mux {
 	router := chi.NewRouter()
-	router.Get("/", getAllUsers(dbConn, logger))
-	router.Post("/", createUser(dbConn, logger))
-	router.Post("/login", authenticate(dbConn, logger))
+	router.With(requireAuth).Get("/", getAllUsers(users, logger))
+	router.Post("/", createUser(users, logger))
+	router.Post("/login", authenticate(users, config, logger))
 
 	return router
 }
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// decodePayload decodes the JSON body of a request into v and
+// validates it. It writes a 400 and returns false if the body is
+// malformed or breaks the rules declared on v
+func decodePayload(w http.ResponseWriter, r *http.Request, v interface{}, logger *zap.Logger) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		handleMalformedPayload(w, err, logger)
+		return false
+	}
+
+	if fields := validate(v); len(fields) > 0 {
+		handleInvalidFields(w, r, fields, logger)
+		return false
+	}
+
+	return true
+}
+
+// validate checks the fields of a struct against the rules in their
+// validate tags and returns what is wrong with each, keyed by the
+// field's JSON name. Rules are separated by commas:
+//
+//	required  the field must be set and not blank
+//	min=N     strings must be at least N characters, numbers at least N
+//	max=N     strings must be at most N characters, numbers at most N
+//	oneof=a b the field must be one of the listed values
+//	hhmm      the field must be a time of day formatted as HH:MM
+//
+// Rules other than required are skipped for fields that are not set
+func validate(v interface{}) FieldErrors {
+	fields := FieldErrors{}
+
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if val.Kind() != reflect.Struct {
+		return fields
+	}
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		rules := typ.Field(i).Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+
+		name := typ.Field(i).Name
+		if tag := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+			name = tag
+		}
+
+		if msg := checkRules(val.Field(i), rules); msg != "" {
+			fields[name] = msg
+		}
+	}
+
+	return fields
+}
+
+// checkRules returns what is wrong with a field,
+// or an empty string if it follows its rules
+func checkRules(field reflect.Value, rules string) string {
+	// a pointer to zero is set, so optional numbers can be
+	// told apart from numbers explicitly set to zero
+	isSet, isPtr := true, field.Kind() == reflect.Ptr
+	if isPtr {
+		isSet = !field.IsNil()
+		field = reflect.Indirect(field)
+	}
+
+	if isSet {
+		switch field.Kind() {
+		case reflect.String:
+			isSet = strings.TrimSpace(field.String()) != ""
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			isSet = isPtr || field.Int() != 0
+		}
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		if name == "required" {
+			if !isSet {
+				return "is required"
+			}
+			continue
+		}
+
+		if !isSet {
+			continue
+		}
+
+		if msg := checkRule(field, name, arg); msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+func checkRule(field reflect.Value, name, arg string) string {
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: invalid %s=%s", name, arg))
+		}
+
+		var n int64
+		unit := ""
+		switch field.Kind() {
+		case reflect.String:
+			n = int64(len([]rune(field.String())))
+			unit = " characters"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = field.Int()
+		}
+
+		if name == "min" && n < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if name == "max" && n > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if field.String() == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	case "hhmm":
+		if _, err := time.Parse("15:04", field.String()); err != nil {
+			return "must be a time formatted as HH:MM"
+		}
+	default:
+		panic("validate: unknown rule " + name)
+	}
+
+	return ""
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hackstock/rubixcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+func TestValidate(t *testing.T) {
+	zero, long := 0, 30
+	testCases := []struct {
+		tag  string
+		v    interface{}
+		want FieldErrors
+	}{
+		{
+			tag:  "valid queue",
+			v:    &db.Queue{Name: "Tellers", MaxLength: &long},
+			want: FieldErrors{},
+		},
+		{
+			tag:  "blank name and zero limit",
+			v:    &db.Queue{Name: "  ", MaxLength: &zero},
+			want: FieldErrors{"name": "is required", "maxLength": "must be at least 1"},
+		},
+		{
+			tag:  "name too long",
+			v:    &db.Queue{Name: strings.Repeat("q", 256)},
+			want: FieldErrors{"name": "must be at most 255 characters"},
+		},
+		{
+			tag:  "unknown device kind",
+			v:    &db.Device{Name: "Entrance", Kind: "printer"},
+			want: FieldErrors{"kind": "must be one of kiosk, display"},
+		},
+		{
+			tag:  "malformed reset time",
+			v:    &db.Branch{Name: "Osu", TicketsResetTime: strPtr("7am")},
+			want: FieldErrors{"ticketsResetTime": "must be a time formatted as HH:MM"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			got := validate(tc.v)
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+
+			for field, msg := range tc.want {
+				if got[field] != msg {
+					t.Errorf("%s: expected %q, got %q", field, msg, got[field])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	testCases := []struct {
+		tag    string
+		body   string
+		ok     bool
+		status int
+		code   string
+	}{
+		{tag: "valid", body: `{"name": "Tellers"}`, ok: true},
+		{tag: "malformed", body: `{"name": `, status: http.StatusBadRequest, code: CodeMalformedPayload},
+		{tag: "invalid", body: `{"description": "no name"}`, status: http.StatusBadRequest, code: CodeValidationFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/queues", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			var queue db.Queue
+			ok := decodePayload(w, r, &queue, zap.NewNop())
+			if ok != tc.ok {
+				t.Fatalf("expected %v, got %v", tc.ok, ok)
+			}
+
+			if ok {
+				return
+			}
+
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, w.Code)
+			}
+
+			if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+				t.Fatalf("expected content type %q, got %q", problemContentType, ct)
+			}
+
+			if !strings.Contains(w.Body.String(), `"code":"`+tc.code+`"`) {
+				t.Fatalf("expected code %q in %s", tc.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
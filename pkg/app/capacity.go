@@ -0,0 +1,129 @@
+package app
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// serviceRateSmoothing is the weight given to the latest interval
+	// between two customers being called when updating a queue's
+	// average service interval
+	serviceRateSmoothing = 0.2
+
+	// maxServiceInterval is the longest gap between two calls that
+	// counts towards the service rate. Longer gaps are breaks or
+	// closures rather than slow service
+	maxServiceInterval = 30 * time.Minute
+)
+
+// serviceRate tracks the average interval between customers
+// being called from a queue
+type serviceRate struct {
+	lastCall time.Time
+	interval time.Duration
+}
+
+// QueueLimits caps the number of customers waiting on a queue and
+// how long new customers can be expected to wait. Zero values
+// mean no limit
+type QueueLimits struct {
+	MaxLength int
+	MaxWait   time.Duration
+}
+
+// recordCall updates the service rate of a queue with a customer
+// being called at t
+func (r *Rubix) recordCall(queueID int64, t time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rate, ok := r.serviceRates[queueID]
+	if !ok {
+		r.serviceRates[queueID] = &serviceRate{lastCall: t}
+		return
+	}
+
+	gap := t.Sub(rate.lastCall)
+	rate.lastCall = t
+	if gap <= 0 || gap > maxServiceInterval {
+		return
+	}
+
+	if rate.interval == 0 {
+		rate.interval = gap
+		return
+	}
+
+	rate.interval = time.Duration(serviceRateSmoothing*float64(gap) + (1-serviceRateSmoothing)*float64(rate.interval))
+}
+
+// EstimatedWait returns how long a customer joining a queue now can
+// expect to wait, or false while too few customers have been called
+// from the queue to tell
+func (r *Rubix) EstimatedWait(queueID int64) (time.Duration, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	rate, ok := r.serviceRates[queueID]
+	if !ok || rate.interval == 0 {
+		return 0, false
+	}
+
+	waiting := 0
+	if waitList, ok := r.waitLists[queueID]; ok {
+		waiting = waitList.Size()
+	}
+
+	return time.Duration(waiting+1) * rate.interval, true
+}
+
+// EstimatedWaitFor returns how long a customer already waiting on
+// a queue can expect to wait from now, or false if the customer is
+// not waiting or too few customers have been called to tell
+func (r *Rubix) EstimatedWaitFor(queueID, customerID int64) (time.Duration, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	rate, ok := r.serviceRates[queueID]
+	if !ok || rate.interval == 0 {
+		return 0, false
+	}
+
+	waitList, ok := r.waitLists[queueID]
+	if !ok {
+		return 0, false
+	}
+
+	position := waitList.Position(customerID)
+	if position == 0 {
+		return 0, false
+	}
+
+	return time.Duration(position) * rate.interval, true
+}
+
+// CheckCapacity returns false, along with the reason, if a new
+// customer joining a queue would exceed its limits
+func (r *Rubix) CheckCapacity(queueID int64, limits QueueLimits) (bool, string) {
+	if limits.MaxLength > 0 {
+		r.lock.RLock()
+		waiting := 0
+		if waitList, ok := r.waitLists[queueID]; ok {
+			waiting = waitList.Size()
+		}
+		r.lock.RUnlock()
+
+		if waiting >= limits.MaxLength {
+			return false, fmt.Sprintf("%d customers are already waiting", waiting)
+		}
+	}
+
+	if limits.MaxWait > 0 {
+		if wait, ok := r.EstimatedWait(queueID); ok && wait > limits.MaxWait {
+			return false, fmt.Sprintf("the estimated wait of %d minutes is too long", int(wait.Minutes()))
+		}
+	}
+
+	return true, ""
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimatedWait(t *testing.T) {
+	rubix := newTestRubix(t)
+	if _, ok := rubix.EstimatedWait(1); ok {
+		t.Fatalf("expected no estimate before any customer is called")
+	}
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	rubix.recordCall(1, start)
+	rubix.recordCall(1, start.Add(4*time.Minute))
+	// a long break is not counted as slow service
+	rubix.recordCall(1, start.Add(2*time.Hour))
+
+	rubix.Rehydrate(map[int64][]*CustomerInfo{
+		1: {{Ticket: "A001"}, {Ticket: "A002"}},
+	})
+
+	wait, ok := rubix.EstimatedWait(1)
+	if !ok {
+		t.Fatalf("expected an estimate once customers have been called")
+	}
+
+	if wait != 12*time.Minute {
+		t.Fatalf("expected an estimated wait of 12m, got %v", wait)
+	}
+}
+
+func TestEstimatedWaitFor(t *testing.T) {
+	rubix := newTestRubix(t)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{
+		1: {{ID: 7, Ticket: "A001"}, {ID: 9, Ticket: "A002"}},
+	})
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	rubix.recordCall(1, start)
+	rubix.recordCall(1, start.Add(3*time.Minute))
+
+	wait, ok := rubix.EstimatedWaitFor(1, 9)
+	if !ok || wait != 6*time.Minute {
+		t.Fatalf("expected an estimated wait of 6m for the second customer, got %v (%v)", wait, ok)
+	}
+
+	if _, ok := rubix.EstimatedWaitFor(1, 8); ok {
+		t.Fatalf("expected no estimate for a customer who is not waiting")
+	}
+}
+
+func TestCheckCapacity(t *testing.T) {
+	rubix := newTestRubix(t)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{
+		1: {{Ticket: "A001"}, {Ticket: "A002"}, {Ticket: "A003"}},
+	})
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	rubix.recordCall(1, start)
+	rubix.recordCall(1, start.Add(5*time.Minute))
+
+	tests := []struct {
+		name   string
+		limits QueueLimits
+		want   bool
+	}{
+		{name: "no limits", limits: QueueLimits{}, want: true},
+		{name: "room left", limits: QueueLimits{MaxLength: 4}, want: true},
+		{name: "full", limits: QueueLimits{MaxLength: 3}, want: false},
+		{name: "short enough wait", limits: QueueLimits{MaxWait: 20 * time.Minute}, want: true},
+		{name: "wait too long", limits: QueueLimits{MaxWait: 15 * time.Minute}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, reason := rubix.CheckCapacity(1, tt.limits)
+			if ok != tt.want {
+				t.Fatalf("expected %v, got %v (%s)", tt.want, ok, reason)
+			}
+			if !ok && reason == "" {
+				t.Fatalf("expected a reason for turning customers away")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Coordinator lets instances of the service that share a database
+// agree on the ticket numbers they issue and on which of them calls
+// each waiting customer. Without one, Rubix numbers tickets itself
+// and every customer it dequeues is its own to call
+type Coordinator interface {
+	// NextTicket returns the next ticket number of a branch
+	NextTicket(ctx context.Context, branchID int64) (int, error)
+
+	// ResumeTickets makes the ticket numbers of a branch
+	// continue from at least next
+	ResumeTickets(ctx context.Context, branchID int64, next int) error
+
+	// ResetTickets restarts the ticket numbers of a branch at 1
+	// for the reset due at 'at', unless that reset already happened
+	ResetTickets(ctx context.Context, branchID int64, at time.Time) error
+
+	// Claim records a customer as called and served, returning
+	// false if another instance called them first
+	Claim(ctx context.Context, customerID int64) (bool, error)
+}
+
+// SetCoordinator makes Rubix share ticket numbers and calls with
+// the other instances of the service through coordinator
+func (r *Rubix) SetCoordinator(coordinator Coordinator) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.coordinator = coordinator
+}
+
+// Coordinated returns true if Rubix shares ticket numbers and calls
+// with other instances, in which case the coordinator records the
+// customers it calls as served
+func (r *Rubix) Coordinated() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.coordinator != nil
+}
+
+// ResumeTickets carries the ticket numbering restored by Rehydrate
+// over to the coordinator, so that numbers issued before the
+// instances shared their sequences are not issued again. Sequences
+// left over from before the last reset of their branch, as when
+// every instance was down at the reset time, are reset first
+func (r *Rubix) ResumeTickets(ctx context.Context) error {
+	r.lock.RLock()
+	coordinator := r.coordinator
+	next := make(map[int64]int, len(r.branches))
+	lastReset := make(map[int64]time.Time, len(r.branches))
+	for branchID, branch := range r.branches {
+		next[branchID] = branch.nextTicketNumber
+		lastReset[branchID] = branch.lastReset
+	}
+	r.lock.RUnlock()
+
+	if coordinator == nil {
+		return nil
+	}
+
+	for branchID, n := range next {
+		if err := coordinator.ResetTickets(ctx, branchID, lastReset[branchID]); err != nil {
+			return err
+		}
+
+		if err := coordinator.ResumeTickets(ctx, branchID, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// claim records a customer dequeued from a queue as called by this
+// instance. It returns false if another instance called them first,
+// and puts them back on the queue if the coordinator failed
+func (r *Rubix) claim(ctx context.Context, queueID int64, customer *CustomerInfo) (bool, error) {
+	r.lock.RLock()
+	coordinator := r.coordinator
+	r.lock.RUnlock()
+
+	if coordinator == nil {
+		return true, nil
+	}
+
+	claimed, err := coordinator.Claim(ctx, customer.ID)
+	if err != nil {
+		r.lock.RLock()
+		if waitList, ok := r.waitLists[queueID]; ok {
+			waitList.Insert(customer)
+		}
+		r.lock.RUnlock()
+
+		return false, err
+	}
+
+	if !claimed {
+		r.logger.Info("customer already called by another instance", zap.Int64("customer_id", customer.ID), zap.Int64("queueID", queueID))
+	}
+
+	return claimed, nil
+}
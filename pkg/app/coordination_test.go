@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sharedCoordinator keeps the state instances sharing
+// a database would keep in it
+type sharedCoordinator struct {
+	lock    sync.Mutex
+	next    map[int64]int
+	resetAt map[int64]time.Time
+	claimed map[int64]bool
+	err     error
+}
+
+func newSharedCoordinator() *sharedCoordinator {
+	return &sharedCoordinator{next: map[int64]int{}, resetAt: map[int64]time.Time{}, claimed: map[int64]bool{}}
+}
+
+func (c *sharedCoordinator) NextTicket(ctx context.Context, branchID int64) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.next[branchID]++
+	return c.next[branchID], nil
+}
+
+func (c *sharedCoordinator) ResumeTickets(ctx context.Context, branchID int64, next int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.next[branchID] < next-1 {
+		c.next[branchID] = next - 1
+	}
+	return nil
+}
+
+func (c *sharedCoordinator) ResetTickets(ctx context.Context, branchID int64, at time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !at.After(c.resetAt[branchID]) {
+		return nil
+	}
+	c.next[branchID] = 0
+	c.resetAt[branchID] = at
+	return nil
+}
+
+func (c *sharedCoordinator) Claim(ctx context.Context, customerID int64) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return false, c.err
+	}
+
+	if c.claimed[customerID] {
+		return false, nil
+	}
+	c.claimed[customerID] = true
+	return true, nil
+}
+
+func TestGenerateTicket_NumbersTicketsThroughCoordinator(t *testing.T) {
+	coordinator := newSharedCoordinator()
+	a, b := newTestRubix(t), newTestRubix(t)
+	a.SetCoordinator(coordinator)
+	b.SetCoordinator(coordinator)
+
+	a.Rehydrate(map[int64][]*CustomerInfo{1: {{Ticket: "A007"}}})
+	if err := a.ResumeTickets(context.Background()); err != nil {
+		t.Fatalf("unexpected error resuming tickets: %v", err)
+	}
+
+	for i, rubix := range []*Rubix{b, a, b} {
+		ticket, err := rubix.GenerateTicket(context.Background(), 1)
+		if err != nil || ticketNumber(ticket) != 8+i {
+			t.Fatalf("expected ticket number %d, got %s (%v)", 8+i, ticket, err)
+		}
+	}
+}
+
+func TestResumeTickets_ResetsSequencesAfterMissedReset(t *testing.T) {
+	coordinator := newSharedCoordinator()
+
+	// no instance was running at the last reset, due at 00:00
+	coordinator.next[1] = 41
+	coordinator.resetAt[1] = time.Now().Add(-48 * time.Hour)
+
+	rubix := newTestRubix(t)
+	rubix.SetCoordinator(coordinator)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{})
+	if err := rubix.ResumeTickets(context.Background()); err != nil {
+		t.Fatalf("unexpected error resuming tickets: %v", err)
+	}
+
+	ticket, err := rubix.GenerateTicket(context.Background(), 1)
+	if err != nil || ticketNumber(ticket) != 1 {
+		t.Fatalf("expected numbering to restart after the missed reset, got %s (%v)", ticket, err)
+	}
+
+	// another instance starting later leaves the sequence alone
+	other := newTestRubix(t)
+	other.SetCoordinator(coordinator)
+	other.Rehydrate(map[int64][]*CustomerInfo{1: {{Ticket: "A001"}}})
+	if err := other.ResumeTickets(context.Background()); err != nil {
+		t.Fatalf("unexpected error resuming tickets: %v", err)
+	}
+
+	ticket, err = other.GenerateTicket(context.Background(), 1)
+	if err != nil || ticketNumber(ticket) != 2 {
+		t.Errorf("expected numbering to carry on, got %s (%v)", ticket, err)
+	}
+}
+
+func TestNotifyNextCustomer_SkipsCustomersClaimedElsewhere(t *testing.T) {
+	coordinator := newSharedCoordinator()
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+	rubix.SetCoordinator(coordinator)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{1: {{ID: 1, Ticket: "A001"}, {ID: 2, Ticket: "A002"}}})
+
+	coordinator.claimed[1] = true
+	customer, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 1")
+	if err != nil || customer.ID != 2 {
+		t.Fatalf("expected customer 2 to be called, got %v (%v)", customer, err)
+	}
+
+	if _, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 1"); err != ErrNoWaitingCustomers {
+		t.Fatalf("expected %v, got %v", ErrNoWaitingCustomers, err)
+	}
+}
+
+func TestNotifyNextCustomer_KeepsCustomerWhenClaimFails(t *testing.T) {
+	coordinator := newSharedCoordinator()
+	coordinator.err = errors.New("database unavailable")
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+	rubix.SetCoordinator(coordinator)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{1: {{ID: 1, Ticket: "A001"}, {ID: 2, Ticket: "A002", JoinedAt: time.Now()}}})
+
+	if _, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 1"); err != coordinator.err {
+		t.Fatalf("expected %v, got %v", coordinator.err, err)
+	}
+
+	if position := rubix.waitLists[1].Position(1); position != 1 {
+		t.Fatalf("expected customer 1 to stay at the head of the queue, got position %d", position)
+	}
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"errors"
+)
+
+// Strategies a counter can use to choose which of its
+// queues to call the next customer from
+const (
+	// StrategyLongestWait calls the customer who has
+	// been waiting longest across all queues
+	StrategyLongestWait = "longest_wait"
+
+	// StrategyWeightedRoundRobin takes turns between queues,
+	// calling from each in proportion to its weight
+	StrategyWeightedRoundRobin = "weighted_round_robin"
+
+	// StrategyPriority always calls from the queue with the
+	// highest priority that has customers waiting
+	StrategyPriority = "priority"
+)
+
+// ErrNoWaitingCustomers is returned when calling the next customer
+// while no customers are waiting on the queues being served
+var ErrNoWaitingCustomers = errors.New("no customers are waiting")
+
+// ValidStrategy returns true if strategy is a known counter strategy
+func ValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyLongestWait, StrategyWeightedRoundRobin, StrategyPriority:
+		return true
+	}
+
+	return false
+}
+
+// CounterQueue is a queue served by a counter. 'Weight' is used by
+// weighted round-robin and 'Priority' by strict priority, where
+// higher values are served first
+type CounterQueue struct {
+	QueueID  int64
+	Weight   int
+	Priority int
+}
+
+// Counter is a service point serving customers from
+// one or more queues
+type Counter struct {
+	ID       int64
+	Name     string
+	Strategy string
+	Queues   []CounterQueue
+}
+
+// NotifyNextCustomerForCounter chooses which of a counter's queues
+// to serve using the counter's strategy, deques the customer at the
+// head of that queue and notifies them of their turn. It returns
+// the queue the customer was called from. Customers another
+// instance called first are skipped
+func (r *Rubix) NotifyNextCustomerForCounter(ctx context.Context, counter Counter) (int64, *CustomerInfo, error) {
+	for {
+		r.lock.Lock()
+		queueID, ok := r.pickQueue(counter)
+		if !ok {
+			r.lock.Unlock()
+			return 0, nil, ErrNoWaitingCustomers
+		}
+		customer := r.waitLists[queueID].Deque()
+		r.lock.Unlock()
+
+		claimed, err := r.claim(ctx, queueID, customer)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if claimed {
+			r.notify(ctx, queueID, customer, counter.Name)
+			return queueID, customer, nil
+		}
+	}
+}
+
+// pickQueue returns the queue a counter should call its next
+// customer from, or false if all its queues are empty. It must
+// be called with r.lock held
+func (r *Rubix) pickQueue(counter Counter) (int64, bool) {
+	var waiting []CounterQueue
+	for _, q := range counter.Queues {
+		if waitList, ok := r.waitLists[q.QueueID]; ok && !waitList.IsEmpty() {
+			waiting = append(waiting, q)
+		}
+	}
+
+	if len(waiting) == 0 {
+		return 0, false
+	}
+
+	switch counter.Strategy {
+	case StrategyWeightedRoundRobin:
+		return r.pickWeighted(counter.ID, waiting), true
+	case StrategyPriority:
+		highest := waiting[0].Priority
+		for _, q := range waiting {
+			if q.Priority > highest {
+				highest = q.Priority
+			}
+		}
+
+		var top []CounterQueue
+		for _, q := range waiting {
+			if q.Priority == highest {
+				top = append(top, q)
+			}
+		}
+
+		return r.pickLongestWait(top), true
+	default:
+		return r.pickLongestWait(waiting), true
+	}
+}
+
+// pickLongestWait returns the queue whose first customer joined
+// earliest, preferring queues listed first on ties
+func (r *Rubix) pickLongestWait(queues []CounterQueue) int64 {
+	picked := queues[0].QueueID
+	oldest := r.waitLists[picked].Peek().JoinedAt
+	for _, q := range queues[1:] {
+		if joinedAt := r.waitLists[q.QueueID].Peek().JoinedAt; joinedAt.Before(oldest) {
+			picked, oldest = q.QueueID, joinedAt
+		}
+	}
+
+	return picked
+}
+
+// pickWeighted implements smooth weighted round-robin: every queue
+// gains its weight on each call, the queue with the highest running
+// weight is served and gives back the total weight. Over time each
+// queue is served in proportion to its weight without bursts
+func (r *Rubix) pickWeighted(counterID int64, queues []CounterQueue) int64 {
+	weights, ok := r.counterWeights[counterID]
+	if !ok {
+		weights = map[int64]int{}
+		r.counterWeights[counterID] = weights
+	}
+
+	total := 0
+	picked := queues[0].QueueID
+	for _, q := range queues {
+		weight := q.Weight
+		if weight < 1 {
+			weight = 1
+		}
+
+		total += weight
+		weights[q.QueueID] += weight
+		if weights[q.QueueID] > weights[picked] {
+			picked = q.QueueID
+		}
+	}
+
+	weights[picked] -= total
+	return picked
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type recordingPublisher struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, sms, queueName string) error {
+	p.lock.Lock()
+	p.messages = append(p.messages, sms)
+	p.lock.Unlock()
+	return nil
+}
+
+// newCounterTestRubix returns a rubix with queues 1, 2 and 3 of
+// branch 1, each holding the given tickets in order. Tickets on
+// the same queue joined a minute apart, starting at the offset
+// given for the queue
+func newCounterTestRubix(t *testing.T, tickets map[int64][]string, offsets map[int64]time.Duration) *Rubix {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	if err := rubix.AddBranch(1, "00:00", time.UTC); err != nil {
+		t.Fatalf("unexpected error adding branch: %v", err)
+	}
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	waiting := map[int64][]*CustomerInfo{}
+	for queueID, queueTickets := range tickets {
+		rubix.AddQueue(queueID, 1)
+		for i, ticket := range queueTickets {
+			joinedAt := start.Add(offsets[queueID] + time.Duration(i)*time.Minute)
+			waiting[queueID] = append(waiting[queueID], &CustomerInfo{Ticket: ticket, JoinedAt: joinedAt})
+		}
+	}
+	rubix.Rehydrate(waiting)
+
+	return rubix
+}
+
+func callAll(t *testing.T, rubix *Rubix, counter Counter, n int) []string {
+	var called []string
+	for i := 0; i < n; i++ {
+		_, customer, err := rubix.NotifyNextCustomerForCounter(context.Background(), counter)
+		if err != nil {
+			t.Fatalf("unexpected error calling customer %d: %v", i+1, err)
+		}
+		called = append(called, customer.Ticket)
+	}
+
+	return called
+}
+
+func assertOrder(t *testing.T, got, want []string) {
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestNotifyNextCustomerForCounter_LongestWait(t *testing.T) {
+	rubix := newCounterTestRubix(t,
+		map[int64][]string{1: {"A001", "A002"}, 2: {"B001", "B002"}},
+		map[int64]time.Duration{1: 0, 2: 30 * time.Second},
+	)
+
+	counter := Counter{ID: 1, Name: "Counter 1", Strategy: StrategyLongestWait, Queues: []CounterQueue{{QueueID: 1}, {QueueID: 2}}}
+	assertOrder(t, callAll(t, rubix, counter, 4), []string{"A001", "B001", "A002", "B002"})
+
+	if _, _, err := rubix.NotifyNextCustomerForCounter(context.Background(), counter); err != ErrNoWaitingCustomers {
+		t.Fatalf("expected ErrNoWaitingCustomers, got %v", err)
+	}
+}
+
+func TestNotifyNextCustomerForCounter_Priority(t *testing.T) {
+	rubix := newCounterTestRubix(t,
+		map[int64][]string{1: {"A001", "A002"}, 2: {"B001"}, 3: {"C001"}},
+		map[int64]time.Duration{1: 0, 2: 10 * time.Minute, 3: -10 * time.Minute},
+	)
+
+	counter := Counter{ID: 1, Name: "Counter 1", Strategy: StrategyPriority, Queues: []CounterQueue{
+		{QueueID: 1, Priority: 0},
+		{QueueID: 2, Priority: 5},
+		{QueueID: 3, Priority: 0},
+	}}
+
+	// queue 2 goes first despite its customer arriving last, then
+	// queues 1 and 3 share the lower priority by longest wait
+	assertOrder(t, callAll(t, rubix, counter, 4), []string{"B001", "C001", "A001", "A002"})
+}
+
+func TestNotifyNextCustomerForCounter_WeightedRoundRobin(t *testing.T) {
+	rubix := newCounterTestRubix(t,
+		map[int64][]string{1: {"A001", "A002", "A003", "A004", "A005"}, 2: {"B001", "B002", "B003"}},
+		map[int64]time.Duration{},
+	)
+
+	counter := Counter{ID: 1, Name: "Counter 1", Strategy: StrategyWeightedRoundRobin, Queues: []CounterQueue{
+		{QueueID: 1, Weight: 2},
+		{QueueID: 2, Weight: 1},
+	}}
+
+	// queue 1 is served twice as often until it runs out
+	assertOrder(t, callAll(t, rubix, counter, 8), []string{"A001", "B001", "A002", "A003", "B002", "A004", "A005", "B003"})
+}
+
+func TestNotifyNextCustomer_SendsSMS(t *testing.T) {
+	publisher := &recordingPublisher{}
+	rubix := NewRubix(publisher, zap.NewNop())
+	rubix.AddQueue(1, 1)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{1: {{ID: 7, Msisdn: "+233200662782", Ticket: "A001"}}})
+
+	customer, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 3")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if customer.ID != 7 {
+		t.Fatalf("expected customer 7, got %d", customer.ID)
+	}
+
+	if len(publisher.messages) != 1 {
+		t.Fatalf("expected one SMS, got %v", publisher.messages)
+	}
+
+	if _, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 3"); err != ErrNoWaitingCustomers {
+		t.Fatalf("expected ErrNoWaitingCustomers, got %v", err)
+	}
+}
+
+func TestNotifyNextCustomer_WithoutCounter(t *testing.T) {
+	publisher := &recordingPublisher{}
+	rubix := NewRubix(publisher, zap.NewNop())
+	rubix.AddQueue(1, 1)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{1: {{ID: 1, Msisdn: "+233200000001", Ticket: "A001"}}})
+
+	if _, err := rubix.NotifyNextCustomer(context.Background(), 1, ""); err != nil {
+		t.Fatalf("unexpected error calling customer: %v", err)
+	}
+
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+	if len(publisher.messages) != 1 || publisher.messages[0] != "+233200000001#Ticket number A001. It is your turn." {
+		t.Errorf("expected customers called without a counter not to be sent to one, got %q", publisher.messages)
+	}
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/hackstock/rubixcore/pkg/metrics"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// rubixEventsExchange fans the events of every instance
+// out to a queue of its own for each instance
+const rubixEventsExchange = "rubix_events"
+
+// EventFanout shares the events of Rubix between the instances of
+// the service over a fanout exchange of the message broker. Every
+// instance consumes the exchange through a queue that only lives
+// as long as its subscription, so the events published while an
+// instance is not subscribed are made up for by resyncing its state
+// from the database every time it subscribes
+type EventFanout struct {
+	brokerConn *amqp.Connection
+	logger     *zap.Logger
+	consuming  *int32
+}
+
+// NewEventFanout returns an EventFanout
+func NewEventFanout(brokerConn *amqp.Connection, logger *zap.Logger) EventFanout {
+	return EventFanout{
+		brokerConn: brokerConn,
+		logger:     logger,
+		consuming:  new(int32),
+	}
+}
+
+// declareEventsExchange declares the exchange events are published on
+func declareEventsExchange(channel *amqp.Channel) error {
+	return channel.ExchangeDeclare(
+		rubixEventsExchange, // name
+		amqp.ExchangeFanout, // type
+		true,                // durable
+		false,               // auto-deleted
+		false,               // internal
+		false,               // no-wait
+		nil,                 // arguments
+	)
+}
+
+// Broadcast publishes an event for every instance to consume
+func (f EventFanout) Broadcast(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	channel, err := f.brokerConn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	err = declareEventsExchange(channel)
+	if err != nil {
+		return err
+	}
+
+	return channel.Publish(
+		rubixEventsExchange, // exchange
+		"",                  // routing key
+		false,               // mandatory
+		false,               // immediate
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		})
+}
+
+// Run starts a goroutine that applies the events published by the
+// other instances to rubix. It re-subscribes to the exchange
+// whenever its channel is closed, calling resync once subscribed.
+// It stops for good once the broker connection is closed, after
+// which Alive returns false and the instance reports it is not ready
+func (f EventFanout) Run(rubix *Rubix, resync func() error) {
+	connClosed := f.brokerConn.NotifyClose(make(chan *amqp.Error, 1))
+
+	go func() {
+		backoff := time.Second
+		for {
+			err := f.consume(rubix, resync)
+			select {
+			case reason := <-connClosed:
+				f.logger.Error("broker connection closed, event fanout stopped", zap.Error(err), zap.Any("reason", reason))
+				return
+			default:
+			}
+
+			f.logger.Warn("event fanout lost its channel, re-subscribing", zap.Error(err), zap.Duration("backoff", backoff))
+			time.Sleep(backoff)
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			metrics.AMQPReconnects.Inc()
+		}
+	}()
+}
+
+// consume resyncs rubix once subscribed, then applies events to
+// it until the channel they are delivered on is closed
+func (f EventFanout) consume(rubix *Rubix, resync func() error) error {
+	channel, err := f.brokerConn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	err = declareEventsExchange(channel)
+	if err != nil {
+		return err
+	}
+
+	queue, err := channel.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	err = channel.QueueBind(queue.Name, "", rubixEventsExchange, false, nil)
+	if err != nil {
+		return err
+	}
+
+	messages, err := channel.Consume(
+		queue.Name, // queue
+		"",         // consumer
+		true,       // auto-ack
+		true,       // exclusive
+		false,      // no-local
+		false,      // no-wait
+		nil,        // args
+	)
+	if err != nil {
+		return err
+	}
+
+	// events delivered while resyncing wait on the channel, and
+	// are applied over the state read from the database
+	err = resync()
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(f.consuming, 1)
+	defer atomic.StoreInt32(f.consuming, 0)
+
+	for data := range messages {
+		var e Event
+		if err := json.Unmarshal(data.Body, &e); err != nil {
+			f.logger.Warn("failed decoding event", zap.Error(err))
+			continue
+		}
+
+		rubix.Apply(e)
+	}
+
+	return amqp.ErrClosed
+}
+
+// Alive returns true if the fanout is currently
+// subscribed to the events of the other instances
+func (f EventFanout) Alive() bool {
+	return atomic.LoadInt32(f.consuming) == 1
+}
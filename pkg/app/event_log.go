@@ -0,0 +1,181 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// eventLogSize is the number of latest events kept
+	// for clients resuming a stream of events
+	eventLogSize = 1024
+
+	// subscriberBuffer is the number of events a subscriber can
+	// fall behind by before it is dropped
+	subscriberBuffer = 64
+
+	// EventResync is replayed to subscribers resuming from an event
+	// this log no longer keeps or never gave. It is not a change to
+	// the state of Rubix: it tells them events were missed, so that
+	// they read the state again
+	EventResync = "resync"
+)
+
+// LoggedEvent is an event kept in an EventLog, with the
+// identifier clients resume a stream of events from
+type LoggedEvent struct {
+	ID string
+	Event
+}
+
+// EventLog keeps the latest events of Rubix, from this instance and
+// the others, in a ring buffer and hands them to subscribers as they
+// are logged. Identifiers are only meaningful to the instance that
+// gave them, so subscribers resuming from an identifier of another
+// instance, or from an event that was dropped, are told to resync
+type EventLog struct {
+	lock        sync.Mutex
+	prefix      string
+	events      []LoggedEvent
+	seqs        []uint64
+	head        int
+	seq         uint64
+	subscribers map[chan LoggedEvent]bool
+	closed      bool
+}
+
+// NewEventLog returns a pointer to a new EventLog keeping up to size
+// events, whose identifiers start with prefix
+func NewEventLog(prefix string, size int) *EventLog {
+	return &EventLog{
+		prefix:      prefix,
+		events:      make([]LoggedEvent, 0, size),
+		seqs:        make([]uint64, 0, size),
+		subscribers: map[chan LoggedEvent]bool{},
+	}
+}
+
+// Log keeps an event, dropping the oldest event once the log is
+// full, and hands it to every subscriber. Subscribers too far
+// behind to take it are dropped
+func (l *EventLog) Log(e Event) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.seq++
+	logged := LoggedEvent{ID: l.latestID(), Event: e}
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, logged)
+		l.seqs = append(l.seqs, l.seq)
+	} else if len(l.events) > 0 {
+		l.events[l.head] = logged
+		l.seqs[l.head] = l.seq
+		l.head = (l.head + 1) % len(l.events)
+	}
+
+	for subscriber := range l.subscribers {
+		select {
+		case subscriber <- logged:
+		default:
+			delete(l.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Subscribe returns the events logged after the event identified by
+// lastID, then every event logged from now on until cancel is called.
+// Nothing is replayed for an empty lastID. For a lastID whose events
+// cannot be replayed, a single EventResync identified as the latest
+// event is replayed instead. The channel is closed if the subscriber
+// falls too far behind, in which case it can subscribe again from the
+// last event it took, and once the log is closed
+func (l *EventLog) Subscribe(lastID string) (replay []LoggedEvent, events <-chan LoggedEvent, cancel func()) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if last, ok := l.parseID(lastID); ok && l.kept(last) {
+		for i := range l.events {
+			j := (l.head + i) % len(l.events)
+			if l.seqs[j] > last {
+				replay = append(replay, l.events[j])
+			}
+		}
+	} else if lastID != "" {
+		replay = []LoggedEvent{{ID: l.latestID(), Event: Event{Type: EventResync, At: time.Now()}}}
+	}
+
+	subscriber := make(chan LoggedEvent, subscriberBuffer)
+	if l.closed {
+		close(subscriber)
+		return replay, subscriber, func() {}
+	}
+	l.subscribers[subscriber] = true
+
+	cancel = func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		if l.subscribers[subscriber] {
+			delete(l.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+	return replay, subscriber, cancel
+}
+
+// Close ends every subscription, and those made from now on, so
+// that streams of events do not hold up the server shutting down
+func (l *EventLog) Close() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.closed = true
+	for subscriber := range l.subscribers {
+		delete(l.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// kept returns true if every event logged after the one with
+// sequence number last is still kept. It must be called with
+// l.lock held
+func (l *EventLog) kept(last uint64) bool {
+	if len(l.events) < cap(l.events) {
+		return true
+	}
+	if len(l.events) == 0 {
+		return last == l.seq
+	}
+
+	return last+1 >= l.seqs[l.head]
+}
+
+// latestID returns the identifier of the latest event logged, or an
+// empty string if none was. It must be called with l.lock held
+func (l *EventLog) latestID() string {
+	if l.seq == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s-%d", l.prefix, l.seq)
+}
+
+// parseID returns the sequence number of an event identifier
+// given by this log. It must be called with l.lock held
+func (l *EventLog) parseID(id string) (uint64, bool) {
+	if !strings.HasPrefix(id, l.prefix+"-") {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimPrefix(id, l.prefix+"-"), 10, 64)
+	if err != nil || seq > l.seq {
+		return 0, false
+	}
+
+	return seq, true
+}
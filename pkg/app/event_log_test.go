@@ -0,0 +1,81 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEventLog_ResumesFromLastEvent(t *testing.T) {
+	log := NewEventLog("a", 3)
+	for queueID := int64(1); queueID <= 4; queueID++ {
+		log.Log(Event{Type: EventTicketIssued, QueueID: queueID})
+	}
+
+	tests := []struct {
+		lastID string
+		want   []int64
+		resync bool
+	}{
+		{lastID: "", want: nil},
+		{lastID: "a-2", want: []int64{3, 4}},
+		{lastID: "a-4", want: nil},
+		{lastID: "a-1", want: []int64{2, 3, 4}},
+		{lastID: "a-0", resync: true},
+		{lastID: "b-2", resync: true},
+		{lastID: "a-9", resync: true},
+	}
+
+	for _, tt := range tests {
+		replay, _, cancel := log.Subscribe(tt.lastID)
+		cancel()
+
+		if tt.resync {
+			if len(replay) != 1 || replay[0].Type != EventResync || replay[0].ID != "a-4" {
+				t.Errorf("expected a resync from a-4 after %q, got %+v", tt.lastID, replay)
+			}
+			continue
+		}
+
+		var got []int64
+		for _, e := range replay {
+			got = append(got, e.QueueID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("expected events of queues %v after %q, got %v", tt.want, tt.lastID, got)
+		}
+	}
+}
+
+func TestEventLog_DropsSubscribersFallingBehind(t *testing.T) {
+	log := NewEventLog("a", eventLogSize)
+	_, events, cancel := log.Subscribe("")
+	defer cancel()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		log.Log(Event{Type: EventTicketIssued, QueueID: 1})
+	}
+
+	taken := 0
+	for range events {
+		taken++
+	}
+	if taken != subscriberBuffer {
+		t.Fatalf("expected a subscriber to take %d events before being dropped, took %d", subscriberBuffer, taken)
+	}
+}
+
+func TestEventLog_CloseEndsSubscriptions(t *testing.T) {
+	log := NewEventLog("a", eventLogSize)
+	_, events, cancel := log.Subscribe("")
+	defer cancel()
+
+	log.Close()
+	if _, ok := <-events; ok {
+		t.Errorf("expected closing the log to end its subscriptions")
+	}
+
+	_, events, _ = log.Subscribe("")
+	if _, ok := <-events; ok {
+		t.Errorf("expected subscriptions made once the log is closed to end at once")
+	}
+}
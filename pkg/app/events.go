@@ -0,0 +1,215 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Types of the changes to the state of Rubix that
+// are shared with the other instances of the service
+const (
+	EventBranchAdded      = "branch.added"
+	EventBranchReset      = "branch.reset"
+	EventQueueAdded       = "queue.added"
+	EventQueueStatus      = "queue.status"
+	EventQueueActive      = "queue.active"
+	EventTicketIssued     = "ticket.issued"
+	EventCustomerCalled   = "customer.called"
+	EventCustomerRecalled = "customer.recalled"
+	EventCustomerServed   = "customer.served"
+)
+
+// Event is a change to the state of Rubix. 'Instance' identifies
+// the instance the change was made on, and the other fields
+// used depend on the type of the event
+type Event struct {
+	Type       string        `json:"type"`
+	Instance   string        `json:"instance"`
+	At         time.Time     `json:"at"`
+	BranchID   int64         `json:"branchId,omitempty"`
+	QueueID    int64         `json:"queueId,omitempty"`
+	Customer   *CustomerInfo `json:"customer,omitempty"`
+	ByJoinTime bool          `json:"byJoinTime,omitempty"`
+	Counter    string        `json:"counter,omitempty"`
+	Status     string        `json:"status,omitempty"`
+	Active     bool          `json:"active,omitempty"`
+	ResetTime  string        `json:"resetTime,omitempty"`
+	Timezone   string        `json:"timezone,omitempty"`
+}
+
+// Broadcaster shares events with the other instances of the
+// service. Alive returns false while it is not receiving theirs
+type Broadcaster interface {
+	Broadcast(e Event) error
+	Alive() bool
+}
+
+// newInstanceID returns a random identifier for an instance
+// of the service, telling its events apart from the others'
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// SetBroadcaster makes Rubix share the changes made to its state
+// with the other instances of the service through broadcaster.
+// Changes made before it is set, such as registering the branches
+// and queues at startup, are not shared
+func (r *Rubix) SetBroadcaster(broadcaster Broadcaster) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.broadcaster = broadcaster
+}
+
+// BroadcasterAlive returns true if Rubix is receiving the events of
+// the other instances, or if it does not share events at all
+func (r *Rubix) BroadcasterAlive() bool {
+	r.lock.RLock()
+	broadcaster := r.broadcaster
+	r.lock.RUnlock()
+
+	return broadcaster == nil || broadcaster.Alive()
+}
+
+// Events returns the log of the latest events of this
+// instance and of the others
+func (r *Rubix) Events() *EventLog {
+	return r.events
+}
+
+// emit logs a change made on this instance and shares it with the
+// others. It must be called without holding r.lock. A change that
+// cannot be shared is still made here, so failures are only logged
+func (r *Rubix) emit(e Event) {
+	r.lock.RLock()
+	broadcaster := r.broadcaster
+	if e.BranchID == 0 {
+		e.BranchID = r.queueBranches[e.QueueID]
+	}
+	r.lock.RUnlock()
+
+	e.Instance = r.instance
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	r.events.Log(e)
+
+	if broadcaster == nil {
+		return
+	}
+
+	if err := broadcaster.Broadcast(e); err != nil {
+		r.logger.Warn("failed broadcasting event", zap.String("type", e.Type), zap.Error(err))
+	}
+}
+
+// Apply makes and logs a change shared by another instance of the
+// service, without sharing it again. Events of this instance are
+// ignored, as they were logged when they were made
+func (r *Rubix) Apply(e Event) {
+	if e.Instance == r.instance {
+		return
+	}
+
+	switch e.Type {
+	case EventBranchAdded:
+		location, err := time.LoadLocation(e.Timezone)
+		if err == nil {
+			err = r.addBranch(e.BranchID, e.ResetTime, location)
+		}
+		if err != nil {
+			r.logger.Warn("failed applying event", zap.String("type", e.Type), zap.Int64("branch_id", e.BranchID), zap.Error(err))
+		}
+	case EventBranchReset:
+		r.reset(e.BranchID, e.At)
+	case EventQueueAdded:
+		r.addQueue(e.QueueID, e.BranchID)
+	case EventQueueStatus:
+		r.applyQueueStatus(e)
+	case EventQueueActive:
+		r.setQueueActive(e.QueueID, e.Active)
+	case EventTicketIssued:
+		r.applyJoin(e)
+	case EventCustomerCalled:
+		r.applyCall(e)
+	case EventCustomerServed:
+		r.removeFromWaitList(e.QueueID, e.Customer)
+	case EventCustomerRecalled:
+		// recalls change nothing, and are only logged
+	default:
+		r.logger.Warn("ignoring event of unknown type", zap.String("type", e.Type))
+		return
+	}
+
+	r.events.Log(e)
+}
+
+// applyQueueStatus moves a queue to the status it was given on
+// another instance. A queue archived there is archived here even
+// if customers are still waiting on it, as they were called there
+func (r *Rubix) applyQueueStatus(e Event) {
+	if e.Status == QueueArchived {
+		r.archiveQueue(e.QueueID, true)
+		return
+	}
+
+	if err := r.setQueueStatus(e.QueueID, e.BranchID, e.Status); err != nil {
+		r.logger.Warn("failed applying event", zap.String("type", e.Type), zap.Int64("queueID", e.QueueID), zap.Error(err))
+	}
+}
+
+// applyJoin places a customer who joined a queue on another instance
+// on its wait list here, unless they are on it already
+func (r *Rubix) applyJoin(e Event) {
+	if e.Customer == nil {
+		return
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	waitList, ok := r.waitLists[e.QueueID]
+	if !ok || waitList.Position(e.Customer.ID) > 0 {
+		return
+	}
+
+	if e.ByJoinTime {
+		waitList.Insert(e.Customer)
+	} else {
+		waitList.Enqueue(e.Customer)
+	}
+}
+
+// applyCall takes a customer called on another instance off the
+// wait list of their queue here
+func (r *Rubix) applyCall(e Event) {
+	if r.removeFromWaitList(e.QueueID, e.Customer) {
+		r.recordCall(e.QueueID, e.At)
+	}
+}
+
+// removeFromWaitList takes a customer off the wait list of a
+// queue, returning false if the queue is not registered
+func (r *Rubix) removeFromWaitList(queueID int64, customer *CustomerInfo) bool {
+	if customer == nil {
+		return false
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	waitList, ok := r.waitLists[queueID]
+	if ok {
+		waitList.Remove(customer.ID)
+	}
+
+	return ok
+}
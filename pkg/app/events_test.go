@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// loopback applies the events of an instance to its peers,
+// as the event fanout does through the message broker
+type loopback struct {
+	lock  sync.Mutex
+	peers []*Rubix
+}
+
+func (l *loopback) Broadcast(e Event) error {
+	l.lock.Lock()
+	peers := l.peers
+	l.lock.Unlock()
+
+	for _, peer := range peers {
+		peer.Apply(e)
+	}
+
+	return nil
+}
+
+func (l *loopback) Alive() bool {
+	return true
+}
+
+// newInstances returns n instances of rubix sharing their events,
+// each with branch 1 and its queues 1 and 2 registered
+func newInstances(t *testing.T, n int) []*Rubix {
+	bus := &loopback{}
+	var instances []*Rubix
+	for i := 0; i < n; i++ {
+		rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+		if err := rubix.AddBranch(1, "00:00", time.UTC); err != nil {
+			t.Fatalf("unexpected error adding branch: %v", err)
+		}
+		rubix.AddQueue(1, 1)
+		rubix.AddQueue(2, 1)
+		rubix.SetBroadcaster(bus)
+		instances = append(instances, rubix)
+	}
+	bus.peers = instances
+
+	return instances
+}
+
+func TestApply_JoinsAndCallsAreShared(t *testing.T) {
+	instances := newInstances(t, 2)
+	a, b := instances[0], instances[1]
+
+	a.AddCustomerToWaitList(context.Background(), 1, 1, "+233200000001", "A001")
+	b.AddCustomerToWaitList(context.Background(), 1, 2, "+233200000002", "A002")
+
+	for i, rubix := range instances {
+		if size := rubix.WaitListSizes()[1]; size != 2 {
+			t.Fatalf("expected instance %d to see 2 customers waiting, got %d", i, size)
+		}
+	}
+
+	customer, err := b.NotifyNextCustomer(context.Background(), 1, "Counter 1")
+	if err != nil || customer.ID != 1 {
+		t.Fatalf("expected customer 1 to be called, got %v (%v)", customer, err)
+	}
+
+	customer, err = a.NotifyNextCustomer(context.Background(), 1, "Counter 2")
+	if err != nil || customer.ID != 2 {
+		t.Fatalf("expected customer 2 to be called next on the other instance, got %v (%v)", customer, err)
+	}
+
+	for i, rubix := range instances {
+		if size := rubix.WaitListSizes()[1]; size != 0 {
+			t.Errorf("expected instance %d to see nobody waiting, got %d", i, size)
+		}
+	}
+}
+
+func TestApply_QueueChangesAreShared(t *testing.T) {
+	instances := newInstances(t, 2)
+	a, b := instances[0], instances[1]
+
+	a.AddQueue(3, 1)
+	if err := b.AddCustomerToWaitList(context.Background(), 3, 1, "+233200000001", "A001"); err != nil {
+		t.Fatalf("expected a queue added on one instance to take customers on the other, got %v", err)
+	}
+
+	a.SetQueueActive(2, false)
+	if b.Accepting(2) {
+		t.Errorf("expected a queue deactivated on one instance not to accept customers on the other")
+	}
+
+	if err := a.SetQueueStatus(1, 1, QueuePaused); err != nil {
+		t.Fatalf("unexpected error pausing queue: %v", err)
+	}
+	if status := b.QueueStatus(1); status != QueuePaused {
+		t.Errorf("expected queue 1 to be paused on the other instance, got %s", status)
+	}
+
+	// the instance archiving the queue has already
+	// called the customer the other one still sees
+	a.NotifyNextCustomer(context.Background(), 3, "Counter 1")
+	b.waitLists[3].Enqueue(&CustomerInfo{ID: 1, Ticket: "A001"})
+	if err := a.ArchiveQueue(3); err != nil {
+		t.Fatalf("unexpected error archiving queue: %v", err)
+	}
+	if status := b.QueueStatus(3); status != QueueArchived {
+		t.Errorf("expected queue 3 to be archived on the other instance, got %s", status)
+	}
+}
+
+func TestApply_ResetsAreSharedOnce(t *testing.T) {
+	instances := newInstances(t, 2)
+	a, b := instances[0], instances[1]
+
+	b.AddCustomerToWaitList(context.Background(), 1, 1, "+233200000001", "A001")
+	a.Reset(1)
+	if size := b.WaitListSizes()[1]; size != 0 {
+		t.Fatalf("expected a reset on one instance to clear the other, got %d customers waiting", size)
+	}
+
+	// a reset already made is not made again when it comes
+	// back late from another instance
+	b.AddCustomerToWaitList(context.Background(), 1, 2, "+233200000002", "A002")
+	b.Apply(Event{Type: EventBranchReset, Instance: a.instance, BranchID: 1, At: a.branches[1].lastReset})
+	if size := b.WaitListSizes()[1]; size != 1 {
+		t.Errorf("expected a stale reset to be ignored, got %d customers waiting", size)
+	}
+}
+
+func TestResync_RecoversMissedEvents(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+
+	joined := time.Now().Add(-time.Minute)
+	rubix.AddCustomerToWaitList(context.Background(), 1, 1, "+233200000001", "A001")
+	rubix.AddCustomerToWaitList(context.Background(), 1, 3, "+233200000003", "A003")
+	rubix.waitLists[1].Customers()[0].JoinedAt = joined
+	rubix.waitLists[1].Customers()[1].JoinedAt = joined.Add(2 * time.Second)
+
+	// customer 1 was called and customer 2 joined on another instance
+	// while this one was not subscribed, and customer 4 joined here
+	// after the database was read
+	at := time.Now()
+	rubix.AddCustomerToWaitList(context.Background(), 1, 4, "+233200000004", "A004")
+	rubix.Resync(map[int64][]*CustomerInfo{
+		1: {
+			{ID: 2, Ticket: "A002", JoinedAt: joined.Add(time.Second)},
+			{ID: 3, Ticket: "A003", JoinedAt: joined.Add(2 * time.Second)},
+		},
+	}, at)
+
+	var got []int64
+	for _, c := range rubix.waitLists[1].Customers() {
+		got = append(got, c.ID)
+	}
+	if len(got) != 3 || got[0] != 2 || got[1] != 3 || got[2] != 4 {
+		t.Errorf("expected customers 2, 3 and 4 waiting in that order, got %v", got)
+	}
+}
+
+// deadBroadcaster is a broadcaster that lost its subscription
+type deadBroadcaster struct{}
+
+func (deadBroadcaster) Broadcast(e Event) error {
+	return nil
+}
+
+func (deadBroadcaster) Alive() bool {
+	return false
+}
+
+func TestBroadcasterAlive(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	if !rubix.BroadcasterAlive() {
+		t.Errorf("expected an instance not sharing events to be alive")
+	}
+
+	rubix.SetBroadcaster(deadBroadcaster{})
+	if rubix.BroadcasterAlive() {
+		t.Errorf("expected an instance not receiving events not to be alive")
+	}
+}
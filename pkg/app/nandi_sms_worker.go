@@ -5,17 +5,22 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/hackstock/rubixcore/pkg/metrics"
 	"github.com/streadway/amqp"
 	"go.uber.org/zap"
 )
 
+const nandiProvider = "nandi"
+
 // NandiSMSWorker sends text messages through Nandi Mobile
 type NandiSMSWorker struct {
 	brokerConn    *amqp.Connection
 	gatewayConfig *SmsGatewayConfig
 	logger        *zap.Logger
+	consuming     *int32
 }
 
 // NewNandiSMSWorker returns a NandiSMSWorker
@@ -24,17 +29,46 @@ func NewNandiSMSWorker(brokerConn *amqp.Connection, config *SmsGatewayConfig, lo
 		brokerConn:    brokerConn,
 		gatewayConfig: config,
 		logger:        logger,
+		consuming:     new(int32),
 	}
 }
 
 // Run starts a goroutine that consumes messages on the
 // sms_task_queue and makes HTTP calls to send SMS
-// via Nandi Mobile's SMS gateway
+// via Nandi Mobile's SMS gateway. The worker re-subscribes
+// to the queue whenever its channel is closed
 func (worker NandiSMSWorker) Run(queueName string) {
+	connClosed := worker.brokerConn.NotifyClose(make(chan *amqp.Error, 1))
+
+	go func() {
+		backoff := time.Second
+		for {
+			err := worker.consume(queueName)
+			select {
+			case reason := <-connClosed:
+				worker.logger.Error("broker connection closed, sms worker stopped", zap.Error(err), zap.Any("reason", reason))
+				return
+			default:
+			}
+
+			worker.logger.Warn("sms worker lost its channel, re-subscribing", zap.Error(err), zap.Duration("backoff", backoff))
+			time.Sleep(backoff)
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			metrics.AMQPReconnects.Inc()
+		}
+	}()
+}
+
+// consume processes messages on queueName until the
+// channel they are delivered on is closed
+func (worker NandiSMSWorker) consume(queueName string) error {
 	channel, err := worker.brokerConn.Channel()
 	if err != nil {
-		worker.logger.Info("failed creating channel for worker", zap.Error(err))
+		return err
 	}
+	defer channel.Close()
 
 	messages, err := channel.Consume(
 		queueName, // queue
@@ -46,23 +80,35 @@ func (worker NandiSMSWorker) Run(queueName string) {
 		nil,       // args
 	)
 	if err != nil {
-		worker.logger.Info("failed consuming messages on queue", zap.Error(err), zap.String("queue_name", queueName))
+		return err
 	}
 
-	go func() {
-		for data := range messages {
-			payload := string(data.Body)
-			worker.logger.Info("payload received", zap.String("payload", payload))
-			details := strings.Split(payload, "#")
-			msisdn := details[0]
-			message := details[1]
-			err := sendSMS(message, msisdn, worker.gatewayConfig)
-			if err != nil {
-				worker.logger.Error("failed sending SMS via Nandi", zap.Error(err))
-			}
-			data.Ack(true)
+	atomic.StoreInt32(worker.consuming, 1)
+	defer atomic.StoreInt32(worker.consuming, 0)
+
+	for data := range messages {
+		payload := string(data.Body)
+		worker.logger.Info("payload received", zap.String("payload", payload))
+		details := strings.Split(payload, "#")
+		msisdn := details[0]
+		message := details[1]
+		err := sendSMS(message, msisdn, worker.gatewayConfig)
+		if err != nil {
+			worker.logger.Error("failed sending SMS via Nandi", zap.Error(err))
+			metrics.SMSFailed.WithLabelValues(nandiProvider).Inc()
+		} else {
+			metrics.SMSSent.WithLabelValues(nandiProvider).Inc()
 		}
-	}()
+		data.Ack(true)
+	}
+
+	return amqp.ErrClosed
+}
+
+// Alive returns true if the worker is currently
+// subscribed to its queue on the message broker
+func (worker NandiSMSWorker) Alive() bool {
+	return atomic.LoadInt32(worker.consuming) == 1
 }
 
 func sendSMS(msg, to string, config *SmsGatewayConfig) error {
@@ -84,10 +130,15 @@ func sendSMS(msg, to string, config *SmsGatewayConfig) error {
 		return err
 	}
 
-	_, err = client.Do(req)
+	res, err := client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("sms gateway responded with status %d", res.StatusCode)
+	}
 
 	return nil
 }
@@ -0,0 +1,266 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Statuses of a queue over its lifecycle
+const (
+	// QueueOpen queues take new customers and serve them
+	QueueOpen = "open"
+
+	// QueuePaused queues take no new customers but keep
+	// serving the customers already waiting
+	QueuePaused = "paused"
+
+	// QueueDraining queues take no new customers and are
+	// archived once their last waiting customer is called
+	QueueDraining = "draining"
+
+	// QueueArchived queues are closed for good. Their wait
+	// list is dropped and their history kept for reports
+	QueueArchived = "archived"
+)
+
+var (
+	// ErrQueueNotAccepting is returned when a customer joins a
+	// queue that is not open or has been deactivated
+	ErrQueueNotAccepting = errors.New("queue is not accepting customers")
+
+	// ErrQueueNotEmpty is returned when archiving a queue
+	// that still has customers waiting
+	ErrQueueNotEmpty = errors.New("queue still has customers waiting")
+)
+
+// ValidQueueStatus returns true if status is a known queue status
+func ValidQueueStatus(status string) bool {
+	switch status {
+	case QueueOpen, QueuePaused, QueueDraining, QueueArchived:
+		return true
+	}
+
+	return false
+}
+
+// SetQueueStatus registers a queue of a branch if needed and moves
+// it to status, which must be open, paused or draining. Archived
+// queues cannot be moved to any other status
+func (r *Rubix) SetQueueStatus(queueID, branchID int64, status string) error {
+	if err := r.setQueueStatus(queueID, branchID, status); err != nil {
+		return err
+	}
+
+	r.emit(Event{Type: EventQueueStatus, QueueID: queueID, BranchID: branchID, Status: status})
+	return nil
+}
+
+func (r *Rubix) setQueueStatus(queueID, branchID int64, status string) error {
+	if !ValidQueueStatus(status) || status == QueueArchived {
+		return fmt.Errorf("invalid queue status %q", status)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.queueStatus(queueID) == QueueArchived {
+		return fmt.Errorf("queue %d is archived", queueID)
+	}
+
+	r.queueBranches[queueID] = branchID
+	if _, ok := r.waitLists[queueID]; !ok {
+		r.waitLists[queueID] = NewWaitList()
+	}
+	r.queueStatuses[queueID] = status
+
+	return nil
+}
+
+// ArchiveQueue closes a queue for good and drops its wait list.
+// It fails with ErrQueueNotEmpty while customers are still
+// waiting on the queue
+func (r *Rubix) ArchiveQueue(queueID int64) error {
+	return r.ArchiveQueueWith(queueID, func() error { return nil })
+}
+
+// ArchiveQueueWith archives a queue as ArchiveQueue does and then
+// calls save to record the archive. The queue takes no customers
+// while save runs, and is put back as it was if save fails, so
+// that archiving it can be tried again
+func (r *Rubix) ArchiveQueueWith(queueID int64, save func() error) error {
+	r.lock.RLock()
+	branchID := r.queueBranches[queueID]
+	r.lock.RUnlock()
+
+	undo, err := r.archiveQueue(queueID, false)
+	if err != nil {
+		return err
+	}
+
+	if err := save(); err != nil {
+		undo()
+		return err
+	}
+
+	r.emit(Event{Type: EventQueueStatus, QueueID: queueID, BranchID: branchID, Status: QueueArchived})
+	return nil
+}
+
+// archiveQueue archives a queue, even with customers still
+// waiting on it if force is set. The function it returns puts
+// the queue back as it was, unless it has changed since
+func (r *Rubix) archiveQueue(queueID int64, force bool) (func(), error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	waitList, ok := r.waitLists[queueID]
+	if ok && !force && !waitList.IsEmpty() {
+		return nil, ErrQueueNotEmpty
+	}
+
+	branchID, registered := r.queueBranches[queueID]
+	rate := r.serviceRates[queueID]
+	weights := map[int64]int{}
+	for counterID, queueWeights := range r.counterWeights {
+		if weight, ok := queueWeights[queueID]; ok {
+			weights[counterID] = weight
+		}
+	}
+	inactive := r.inactiveQueues[queueID]
+	status, hasStatus := r.queueStatuses[queueID]
+
+	delete(r.waitLists, queueID)
+	delete(r.queueBranches, queueID)
+	delete(r.serviceRates, queueID)
+	for _, queueWeights := range r.counterWeights {
+		delete(queueWeights, queueID)
+	}
+	delete(r.inactiveQueues, queueID)
+	r.queueStatuses[queueID] = QueueArchived
+
+	undo := func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		if r.queueStatus(queueID) != QueueArchived {
+			return
+		}
+
+		if ok {
+			r.waitLists[queueID] = waitList
+		}
+		if registered {
+			r.queueBranches[queueID] = branchID
+		}
+		if rate != nil {
+			r.serviceRates[queueID] = rate
+		}
+		for counterID, weight := range weights {
+			if queueWeights, found := r.counterWeights[counterID]; found {
+				queueWeights[queueID] = weight
+			}
+		}
+		if inactive {
+			r.inactiveQueues[queueID] = true
+		}
+		if hasStatus {
+			r.queueStatuses[queueID] = status
+		} else {
+			delete(r.queueStatuses, queueID)
+		}
+	}
+
+	return undo, nil
+}
+
+// SetQueueActive activates or deactivates a queue. Deactivated
+// queues take no new customers but keep serving the customers
+// already waiting, as paused queues do
+func (r *Rubix) SetQueueActive(queueID int64, active bool) {
+	r.setQueueActive(queueID, active)
+	r.emit(Event{Type: EventQueueActive, QueueID: queueID, Active: active})
+}
+
+func (r *Rubix) setQueueActive(queueID int64, active bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if active {
+		delete(r.inactiveQueues, queueID)
+		return
+	}
+
+	r.inactiveQueues[queueID] = true
+}
+
+// Accepting returns true if customers can join a queue, that is
+// if it is registered, open and active
+func (r *Rubix) Accepting(queueID int64) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if _, ok := r.waitLists[queueID]; !ok {
+		return false
+	}
+
+	return r.accepting(queueID)
+}
+
+// accepting returns true if a queue is open and active. It must
+// be called with r.lock held
+func (r *Rubix) accepting(queueID int64) bool {
+	return r.queueStatus(queueID) == QueueOpen && !r.inactiveQueues[queueID]
+}
+
+// QueueStatus returns the status of a queue. Queues are
+// open unless they have been given another status
+func (r *Rubix) QueueStatus(queueID int64) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.queueStatus(queueID)
+}
+
+// queueStatus returns the status of a queue. It must be called
+// with r.lock held
+func (r *Rubix) queueStatus(queueID int64) string {
+	if status, ok := r.queueStatuses[queueID]; ok {
+		return status
+	}
+
+	return QueueOpen
+}
+
+// Drained returns true if a queue is draining and its
+// last waiting customer has been called
+func (r *Rubix) Drained(queueID int64) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.queueStatus(queueID) != QueueDraining {
+		return false
+	}
+
+	waitList, ok := r.waitLists[queueID]
+	return !ok || waitList.IsEmpty()
+}
+
+// DrainedQueues returns the queues that are draining with
+// nobody left waiting on them
+func (r *Rubix) DrainedQueues() []int64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var drained []int64
+	for queueID, status := range r.queueStatuses {
+		if status != QueueDraining {
+			continue
+		}
+
+		if waitList, ok := r.waitLists[queueID]; !ok || waitList.IsEmpty() {
+			drained = append(drained, queueID)
+		}
+	}
+
+	return drained
+}
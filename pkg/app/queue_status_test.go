@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSetQueueStatus_PausedQueuesRejectJoinsButKeepServing(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+
+	if err := rubix.AddCustomerToWaitList(context.Background(), 1, 1, "+233200000001", "A001"); err != nil {
+		t.Fatalf("unexpected error joining open queue: %v", err)
+	}
+
+	if err := rubix.SetQueueStatus(1, 1, QueuePaused); err != nil {
+		t.Fatalf("unexpected error pausing queue: %v", err)
+	}
+
+	err := rubix.AddCustomerToWaitList(context.Background(), 1, 2, "+233200000002", "A002")
+	if err != ErrQueueNotAccepting {
+		t.Fatalf("expected %v joining a paused queue, got %v", ErrQueueNotAccepting, err)
+	}
+
+	customer, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 1")
+	if err != nil || customer.ID != 1 {
+		t.Fatalf("expected customer 1 to be called from a paused queue, got %v (%v)", customer, err)
+	}
+
+	if err := rubix.SetQueueStatus(1, 1, QueueOpen); err != nil {
+		t.Fatalf("unexpected error reopening queue: %v", err)
+	}
+
+	if err := rubix.AddCustomerToWaitList(context.Background(), 1, 3, "+233200000003", "A003"); err != nil {
+		t.Fatalf("unexpected error joining reopened queue: %v", err)
+	}
+}
+
+func TestSetQueueStatus_DrainingQueuesAreDrainedOnceEmpty(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+	rubix.AddCustomerToWaitList(context.Background(), 1, 1, "+233200000001", "A001")
+
+	if err := rubix.SetQueueStatus(1, 1, QueueDraining); err != nil {
+		t.Fatalf("unexpected error draining queue: %v", err)
+	}
+
+	if rubix.Drained(1) {
+		t.Fatalf("expected queue with a waiting customer not to be drained")
+	}
+
+	if err := rubix.ArchiveQueue(1); err != ErrQueueNotEmpty {
+		t.Fatalf("expected %v archiving a queue with customers, got %v", ErrQueueNotEmpty, err)
+	}
+
+	rubix.NotifyNextCustomer(context.Background(), 1, "Counter 1")
+	if !rubix.Drained(1) {
+		t.Fatalf("expected queue to be drained once its last customer is called")
+	}
+}
+
+func TestArchiveQueueWith_RestoresQueueWhenSaveFails(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+	if err := rubix.SetQueueStatus(1, 1, QueueDraining); err != nil {
+		t.Fatalf("unexpected error draining queue: %v", err)
+	}
+
+	saveErr := errors.New("database unavailable")
+	if err := rubix.ArchiveQueueWith(1, func() error { return saveErr }); err != saveErr {
+		t.Fatalf("expected the error of save, got %v", err)
+	}
+
+	if rubix.QueueStatus(1) != QueueDraining || !rubix.Drained(1) {
+		t.Fatalf("expected the queue to be left draining, got %s", rubix.QueueStatus(1))
+	}
+	if drained := rubix.DrainedQueues(); len(drained) != 1 || drained[0] != 1 {
+		t.Fatalf("expected the queue to be archived again later, got %v", drained)
+	}
+
+	if err := rubix.ArchiveQueueWith(1, func() error { return nil }); err != nil {
+		t.Fatalf("unexpected error archiving queue: %v", err)
+	}
+	if rubix.QueueStatus(1) != QueueArchived || len(rubix.DrainedQueues()) != 0 {
+		t.Errorf("expected the queue to be archived, got %s", rubix.QueueStatus(1))
+	}
+}
+
+func TestSetQueueStatus_ArchivedQueuesAreDropped(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+
+	if err := rubix.ArchiveQueue(1); err != nil {
+		t.Fatalf("unexpected error archiving queue: %v", err)
+	}
+
+	if _, ok := rubix.WaitListSizes()[1]; ok {
+		t.Fatalf("expected the wait list of an archived queue to be dropped")
+	}
+
+	if err := rubix.SetQueueStatus(1, 1, QueueOpen); err == nil {
+		t.Fatalf("expected an error reopening an archived queue")
+	}
+
+	rubix.Rehydrate(map[int64][]*CustomerInfo{1: {{ID: 1, Ticket: "A001"}}})
+	if _, ok := rubix.WaitListSizes()[1]; ok {
+		t.Fatalf("expected customers of an archived queue not to be restored")
+	}
+}
+
+func TestSetQueueActive_DeactivatedQueuesRejectJoins(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	rubix.AddQueue(1, 1)
+
+	rubix.SetQueueActive(1, false)
+	if rubix.Accepting(1) {
+		t.Fatalf("expected a deactivated queue not to accept customers")
+	}
+
+	err := rubix.AddCustomerToWaitList(context.Background(), 1, 1, "+233200000001", "A001")
+	if err != ErrQueueNotAccepting {
+		t.Fatalf("expected %v joining a deactivated queue, got %v", ErrQueueNotAccepting, err)
+	}
+
+	rubix.SetQueueActive(1, true)
+	if err := rubix.AddCustomerToWaitList(context.Background(), 1, 1, "+233200000001", "A001"); err != nil {
+		t.Fatalf("unexpected error joining a reactivated queue: %v", err)
+	}
+}
+
+func TestJoin_ShouldFailForUnregisteredQueue(t *testing.T) {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+
+	if err := rubix.AddCustomerToWaitList(context.Background(), 42, 1, "+233200000001", "A001"); err == nil {
+		t.Fatalf("expected an error joining an unregistered queue")
+	}
+
+	if _, ok := rubix.WaitListSizes()[42]; ok {
+		t.Fatalf("expected no wait list to be created for an unregistered queue")
+	}
+}
@@ -1,10 +1,14 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/hackstock/rubixcore/pkg/metrics"
 	"go.uber.org/zap"
 )
 
@@ -16,19 +20,87 @@ const (
 // 'WaitLists' is a mapping between queues defined in the db and
 // their corresponding backing waitlist.
 //
-// 'nextTicketNumber' tracks the ticket number to be issued to the
-// next customer who joins a queue
+// 'queueBranches' maps every queue to the branch it belongs to
+//
+// 'branches' tracks the ticket sequence and reset time of each
+// branch, so every branch issues its own ticket numbers
+//
+// 'serviceRates' tracks how quickly customers are called from
+// each queue, to estimate how long new customers will wait
+//
+// 'counterWeights' holds the running weights of the queues of each
+// counter served in weighted round-robin
+//
+// 'queueStatuses' holds the status of every queue that is not open
+//
+// 'inactiveQueues' holds the queues that have been deactivated
+//
+// 'rehydrated' is set once customers who were still waiting
+// when the service last stopped have been restored
+//
+// 'coordinator' and 'broadcaster' are set when several instances
+// of the service run side by side. The coordinator hands out ticket
+// numbers and settles which instance calls each customer, and the
+// broadcaster shares every change with the other instances, which
+// make it to their own state through Apply. 'instance' tells the
+// changes of this instance apart from the others', and 'events'
+// logs the changes of every instance for clients to stream
+//
+// 'lock' guards the fields above it, along with the branch states
+// and service rates they hold. Each WaitList guards its own customers,
+// but wait lists are only used while 'lock' is held, so that a reset
+// or an archive cannot interleave with a customer joining or being
+// called. SMS are published without holding 'lock'
 type Rubix struct {
-	waitLists        map[int64]*WaitList
+	waitLists      map[int64]*WaitList
+	queueBranches  map[int64]int64
+	branches       map[int64]*branchState
+	serviceRates   map[int64]*serviceRate
+	counterWeights map[int64]map[int64]int
+	queueStatuses  map[int64]string
+	inactiveQueues map[int64]bool
+	lock           sync.RWMutex
+	publisher      Publisher
+	smsWorkers     []SMSWorker
+	rehydrated     bool
+	coordinator    Coordinator
+	broadcaster    Broadcaster
+	instance       string
+	events         *EventLog
+	logger         *zap.Logger
+}
+
+// branchState tracks the ticket sequence of a branch.
+// 'nextTicketNumber' is the ticket number to be issued to the
+// next customer who joins a queue in the branch, and is reset
+// to 1 every day at 'resetTime' in the branch's location
+type branchState struct {
 	nextTicketNumber int
-	lock             sync.RWMutex
-	publisher        Publisher
-	logger           *zap.Logger
+	resetHour        int
+	resetMinute      int
+	location         *time.Location
+	lastReset        time.Time
+}
+
+// nextReset returns the first reset time of the branch after t
+func (b *branchState) nextReset(t time.Time) time.Time {
+	local := t.In(b.location)
+	reset := time.Date(local.Year(), local.Month(), local.Day(), b.resetHour, b.resetMinute, 0, 0, b.location)
+	if !reset.After(t) {
+		reset = reset.AddDate(0, 0, 1)
+	}
+
+	return reset
+}
+
+// previousReset returns the last reset time of the branch at or before t
+func (b *branchState) previousReset(t time.Time) time.Time {
+	return b.nextReset(t).AddDate(0, 0, -1)
 }
 
 // Publisher publishes messages to a queue in a message broker
 type Publisher interface {
-	Publish(sms, queueName string) error
+	Publish(ctx context.Context, sms, queueName string) error
 }
 
 // SMSWorker consumes messages from a queue in a message broker,
@@ -36,70 +108,509 @@ type Publisher interface {
 // configured SMS gateways
 type SMSWorker interface {
 	Run(queueName string)
+	Alive() bool
 }
 
 // NewRubix returns a pointer to a new State
-func NewRubix(waitLists map[int64]*WaitList, publisher Publisher, logger *zap.Logger) *Rubix {
+func NewRubix(publisher Publisher, logger *zap.Logger) *Rubix {
+	instance := newInstanceID()
+
 	return &Rubix{
-		waitLists:        waitLists,
-		nextTicketNumber: 1,
-		publisher:        publisher,
-		logger:           logger,
+		waitLists:      map[int64]*WaitList{},
+		queueBranches:  map[int64]int64{},
+		branches:       map[int64]*branchState{},
+		serviceRates:   map[int64]*serviceRate{},
+		counterWeights: map[int64]map[int64]int{},
+		queueStatuses:  map[int64]string{},
+		inactiveQueues: map[int64]bool{},
+		publisher:      publisher,
+		instance:       instance,
+		events:         NewEventLog(instance, eventLogSize),
+		logger:         logger,
 	}
 }
 
-// Reset clears all application data
-func (r *Rubix) Reset() {
-	r.waitLists = map[int64]*WaitList{}
+// AddBranch registers a branch whose tickets are reset every day
+// at resetTime, given as HH:MM in the branch's location
+func (r *Rubix) AddBranch(branchID int64, resetTime string, location *time.Location) error {
+	if err := r.addBranch(branchID, resetTime, location); err != nil {
+		return err
+	}
+
+	r.emit(Event{Type: EventBranchAdded, BranchID: branchID, ResetTime: resetTime, Timezone: location.String()})
+	return nil
+}
+
+func (r *Rubix) addBranch(branchID int64, resetTime string, location *time.Location) error {
+	reset, err := time.Parse("15:04", resetTime)
+	if err != nil {
+		return fmt.Errorf("invalid tickets reset time %q: %v", resetTime, err)
+	}
+
 	r.lock.Lock()
-	r.nextTicketNumber = 1
-	r.lock.Unlock()
-	r.logger.Info("application state reset", zap.Int("next_ticket_number", r.nextTicketNumber), zap.Any("wait_lists", r.waitLists))
+	defer r.lock.Unlock()
+
+	branch, ok := r.branches[branchID]
+	if !ok {
+		branch = &branchState{nextTicketNumber: 1}
+		r.branches[branchID] = branch
+	}
+	branch.resetHour = reset.Hour()
+	branch.resetMinute = reset.Minute()
+	branch.location = location
+
+	// a new branch counts as reset at the last reset it was due,
+	// which may have passed while no instance was running
+	if !ok {
+		branch.lastReset = branch.previousReset(time.Now())
+	}
+
+	return nil
+}
+
+// AddQueue registers a queue of a branch and creates its wait list
+func (r *Rubix) AddQueue(queueID, branchID int64) {
+	r.addQueue(queueID, branchID)
+	r.emit(Event{Type: EventQueueAdded, QueueID: queueID, BranchID: branchID})
+}
+
+func (r *Rubix) addQueue(queueID, branchID int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.queueBranches[queueID] = branchID
+	if _, ok := r.waitLists[queueID]; !ok {
+		r.waitLists[queueID] = NewWaitList()
+	}
+}
+
+// Reset clears the wait lists and ticket sequence of a branch
+func (r *Rubix) Reset(branchID int64) {
+	r.resetBranch(context.Background(), branchID, time.Now())
+}
+
+// resetBranch resets a branch for the reset due at 'at', here and on
+// the other instances, unless the branch was reset since
+func (r *Rubix) resetBranch(ctx context.Context, branchID int64, at time.Time) {
+	if !r.reset(branchID, at) {
+		return
+	}
+
+	r.lock.RLock()
+	coordinator := r.coordinator
+	r.lock.RUnlock()
+
+	if coordinator != nil {
+		if err := coordinator.ResetTickets(ctx, branchID, at); err != nil {
+			r.logger.Error("failed resetting ticket sequence", zap.Int64("branch_id", branchID), zap.Error(err))
+		}
+	}
+
+	r.emit(Event{Type: EventBranchReset, BranchID: branchID, At: at})
+}
+
+// reset clears the wait lists and ticket sequence of a branch for the
+// reset due at 'at'. It returns false, leaving the branch untouched,
+// if the branch was last reset at or after 'at'
+func (r *Rubix) reset(branchID int64, at time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	branch, ok := r.branches[branchID]
+	if ok && !at.After(branch.lastReset) {
+		return false
+	}
+
+	for queueID, queueBranchID := range r.queueBranches {
+		if queueBranchID == branchID {
+			r.waitLists[queueID] = NewWaitList()
+		}
+	}
+
+	if ok {
+		branch.nextTicketNumber = 1
+		branch.lastReset = at
+	}
+
+	r.logger.Info("branch state reset", zap.Int64("branch_id", branchID))
+	return true
+}
+
+// RunResetScheduler resets every branch once a day at its tickets
+// reset time until ctx is done
+func (r *Rubix) RunResetScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for branchID, at := range r.branchesDueForReset(now) {
+				r.resetBranch(ctx, branchID, at)
+			}
+		}
+	}
+}
+
+// branchesDueForReset returns the branches whose reset time has
+// passed since they were last reset, along with the latest time
+// each was due to be reset at
+func (r *Rubix) branchesDueForReset(now time.Time) map[int64]time.Time {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	due := map[int64]time.Time{}
+	for branchID, branch := range r.branches {
+		if at := branch.previousReset(now); at.After(branch.lastReset) {
+			due[branchID] = at
+		}
+	}
+
+	return due
 }
 
 // RegisterSMSWorker starts a worker tasks that sends SMS to customers
 func (r *Rubix) RegisterSMSWorker(worker SMSWorker) {
+	r.lock.Lock()
+	r.smsWorkers = append(r.smsWorkers, worker)
+	r.lock.Unlock()
+
 	worker.Run(smsTaskQueue)
 }
 
-// GenerateTicket returns the next ticket identifier
-func (r *Rubix) GenerateTicket() string {
-	letters := []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z"}
-	ticket := fmt.Sprintf("%s%03d", letters[rand.Intn(len(letters))], r.nextTicketNumber)
-	r.nextTicketNumber++
+// SMSWorkersAlive returns true if at least one SMS worker has been
+// registered and every registered worker is consuming messages
+func (r *Rubix) SMSWorkersAlive() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if len(r.smsWorkers) == 0 {
+		return false
+	}
+
+	for _, worker := range r.smsWorkers {
+		if !worker.Alive() {
+			return false
+		}
+	}
 
-	return ticket
+	return true
 }
 
-// AddCustomerToWaitList adds a customer info to the tail of a waitlist
-// identied by the given queueId
-func (r *Rubix) AddCustomerToWaitList(queueID int64, msisdn, ticket string) error {
-	customerInfo := &CustomerInfo{Msisdn: msisdn, Ticket: ticket}
+// Rehydrate restores customers who were waiting when the service
+// last stopped onto their wait lists, in the order given, and
+// resumes the ticket numbering of each branch after the highest
+// ticket restored. Queues must have been registered with AddQueue,
+// and customers of archived queues are not restored. Callers only
+// pass customers who joined since their branch's LastReset
+func (r *Rubix) Rehydrate(waiting map[int64][]*CustomerInfo) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	restored := 0
+	for queueID, customers := range waiting {
+		if r.queueStatus(queueID) == QueueArchived {
+			continue
+		}
+
+		waitList, ok := r.waitLists[queueID]
+		if !ok {
+			waitList = NewWaitList()
+			r.waitLists[queueID] = waitList
+		}
+
+		branch := r.branches[r.queueBranches[queueID]]
+		for _, customer := range customers {
+			waitList.Enqueue(customer)
+			if n := ticketNumber(customer.Ticket); branch != nil && n >= branch.nextTicketNumber {
+				branch.nextTicketNumber = n + 1
+			}
+			restored++
+		}
+	}
+
+	r.rehydrated = true
+	r.logger.Info("application state rehydrated", zap.Int("customers", restored))
+}
+
+// Resync brings the wait lists in line with the customers waiting
+// according to the database as read at 'at', once events of the
+// other instances may have been missed. Customers no longer waiting
+// are taken off their wait list, and those missing from it are placed
+// by the time they joined. Customers who joined after 'at' are kept,
+// as they may not have been read. Callers pass customers as they
+// would to Rehydrate
+func (r *Rubix) Resync(waiting map[int64][]*CustomerInfo, at time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 
-	_, ok := r.waitLists[queueID]
+	added, removed := 0, 0
+	for queueID, waitList := range r.waitLists {
+		if r.queueStatus(queueID) == QueueArchived {
+			continue
+		}
+
+		stillWaiting := map[int64]bool{}
+		for _, customer := range waiting[queueID] {
+			stillWaiting[customer.ID] = true
+			if waitList.Position(customer.ID) == 0 {
+				waitList.Insert(customer)
+				added++
+			}
+		}
+
+		for _, customer := range waitList.Customers() {
+			if stillWaiting[customer.ID] || !customer.JoinedAt.Before(at) {
+				continue
+			}
+			if waitList.Remove(customer.ID) {
+				removed++
+			}
+		}
+	}
+
+	r.logger.Info("application state resynced", zap.Int("added", added), zap.Int("removed", removed))
+}
+
+// LastReset returns the last time at or before now at which the
+// tickets of a branch were due to be reset, or false if the branch
+// is unknown. Customers who joined before it are no longer waiting
+func (r *Rubix) LastReset(branchID int64, now time.Time) (time.Time, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	branch, ok := r.branches[branchID]
 	if !ok {
-		r.logger.Info("creating waitlist for new queue", zap.Int64("queue_id", queueID))
-		r.waitLists[queueID] = NewWaitList()
+		return time.Time{}, false
 	}
 
+	return branch.previousReset(now), true
+}
+
+// Rehydrated returns true once Rehydrate has completed
+func (r *Rubix) Rehydrated() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.rehydrated
+}
+
+// ticketNumber returns the numeric part of a ticket such as
+// A012, or zero if the ticket is malformed
+func ticketNumber(ticket string) int {
+	if len(ticket) < 2 {
+		return 0
+	}
+
+	n, err := strconv.Atoi(ticket[1:])
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
+
+// GenerateTicket returns the next ticket identifier of a branch,
+// numbered by the coordinator if Rubix has one
+func (r *Rubix) GenerateTicket(ctx context.Context, branchID int64) (string, error) {
+	r.lock.Lock()
+	branch, ok := r.branches[branchID]
+	if !ok {
+		r.lock.Unlock()
+		return "", fmt.Errorf("unknown branch %d", branchID)
+	}
+
+	coordinator := r.coordinator
+	number := branch.nextTicketNumber
+	if coordinator == nil {
+		branch.nextTicketNumber++
+	}
+	r.lock.Unlock()
+
+	if coordinator != nil {
+		var err error
+		number, err = coordinator.NextTicket(ctx, branchID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	letters := []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z"}
+	return fmt.Sprintf("%s%03d", letters[rand.Intn(len(letters))], number), nil
+}
+
+// AddCustomerToWaitList adds a customer info to the tail of a waitlist
+// identied by the given queueId
+func (r *Rubix) AddCustomerToWaitList(ctx context.Context, queueID, customerID int64, msisdn, ticket string) error {
+	customerInfo := &CustomerInfo{ID: customerID, Msisdn: msisdn, Ticket: ticket, JoinedAt: time.Now()}
 	msg := fmt.Sprintf("Ticket number %s. Kindly wait for your turn.", ticket)
-	smsPayload := fmt.Sprintf("%s#%s", msisdn, msg)
-	err := r.publisher.Publish(smsPayload, smsTaskQueue)
+
+	return r.join(ctx, queueID, customerInfo, msg, false)
+}
+
+// AddRedirectedCustomerToWaitList adds a customer who asked to join
+// a full queue to the tail of its overflow queue, and tells them
+// which queue they have been placed on
+func (r *Rubix) AddRedirectedCustomerToWaitList(ctx context.Context, queueID, customerID int64, msisdn, ticket, fullQueue, overflowQueue string) error {
+	customerInfo := &CustomerInfo{ID: customerID, Msisdn: msisdn, Ticket: ticket, JoinedAt: time.Now()}
+	msg := fmt.Sprintf("%s is full, so you have been placed on %s. Ticket number %s. Kindly wait for your turn.", fullQueue, overflowQueue, ticket)
+
+	return r.join(ctx, queueID, customerInfo, msg, false)
+}
+
+// CheckInCustomer places a customer who booked an appointment on the
+// wait list of a queue as though they had joined at joinedAt, so they
+// are served ahead of walk-ins who arrived after their slot started
+func (r *Rubix) CheckInCustomer(ctx context.Context, queueID, customerID int64, msisdn, ticket string, joinedAt time.Time) error {
+	customerInfo := &CustomerInfo{ID: customerID, Msisdn: msisdn, Ticket: ticket, JoinedAt: joinedAt}
+	msg := fmt.Sprintf("Welcome. Your appointment ticket number is %s. You will be called shortly.", ticket)
+
+	return r.join(ctx, queueID, customerInfo, msg, true)
+}
+
+// join sends msg to a customer and places them on the wait list of
+// a queue, either at its tail or by the time they joined. Customers
+// can only join registered queues that are accepting customers
+func (r *Rubix) join(ctx context.Context, queueID int64, customerInfo *CustomerInfo, msg string, byJoinTime bool) error {
+	r.lock.RLock()
+	err := r.joinable(queueID)
+	r.lock.RUnlock()
 	if err != nil {
 		return err
 	}
 
-	r.waitLists[queueID].Enqueue(customerInfo)
+	err = r.SendSMS(ctx, customerInfo.Msisdn, msg)
+	if err != nil {
+		return err
+	}
+
+	// the queue may have been archived or closed to new
+	// customers while the SMS was being published
+	r.lock.RLock()
+	if err := r.joinable(queueID); err != nil {
+		r.lock.RUnlock()
+		return err
+	}
+
+	if byJoinTime {
+		r.waitLists[queueID].Insert(customerInfo)
+	} else {
+		r.waitLists[queueID].Enqueue(customerInfo)
+	}
+	r.lock.RUnlock()
+
+	metrics.TicketsIssued.WithLabelValues(metrics.QueueLabel(queueID)).Inc()
 	r.logger.Info("customer added to queue", zap.Any("customer_info", customerInfo), zap.Int64("queueID", queueID))
 
+	r.emit(Event{Type: EventTicketIssued, QueueID: queueID, Customer: customerInfo, ByJoinTime: byJoinTime})
+	return nil
+}
+
+// joinable returns why a customer cannot join a queue, or nil if
+// they can. It must be called with r.lock held
+func (r *Rubix) joinable(queueID int64) error {
+	if _, ok := r.waitLists[queueID]; !ok {
+		return fmt.Errorf("unknown queue %d", queueID)
+	}
+
+	if !r.accepting(queueID) {
+		return ErrQueueNotAccepting
+	}
+
+	return nil
+}
+
+// SendSMS publishes an SMS to msisdn for the SMS workers to send
+func (r *Rubix) SendSMS(ctx context.Context, msisdn, msg string) error {
+	smsPayload := fmt.Sprintf("%s#%s", msisdn, msg)
+	return r.publisher.Publish(ctx, smsPayload, smsTaskQueue)
+}
+
+// NotifyNextCustomer deques the customer at the head of a queue
+// and notifies them of their turn to be served at a counter.
+// Customers another instance called first are skipped
+func (r *Rubix) NotifyNextCustomer(ctx context.Context, queueID int64, counter string) (*CustomerInfo, error) {
+	for {
+		r.lock.RLock()
+		var customer *CustomerInfo
+		if waitList, ok := r.waitLists[queueID]; ok {
+			customer = waitList.Deque()
+		}
+		r.lock.RUnlock()
+
+		if customer == nil {
+			return nil, ErrNoWaitingCustomers
+		}
+
+		claimed, err := r.claim(ctx, queueID, customer)
+		if err != nil {
+			return nil, err
+		}
+
+		if claimed {
+			r.notify(ctx, queueID, customer, counter)
+			return customer, nil
+		}
+	}
+}
+
+// notify records a customer being called from a queue and tells
+// them which counter to go to, if they were called to one
+func (r *Rubix) notify(ctx context.Context, queueID int64, customer *CustomerInfo, counter string) {
+	now := time.Now()
+	r.recordCall(queueID, now)
+	r.emit(Event{Type: EventCustomerCalled, At: now, QueueID: queueID, Customer: customer, Counter: counter})
+
+	queueLabel := metrics.QueueLabel(queueID)
+	metrics.CustomersServed.WithLabelValues(queueLabel).Inc()
+	metrics.WaitTime.WithLabelValues(queueLabel).Observe(time.Since(customer.JoinedAt).Seconds())
+
+	msg := fmt.Sprintf("Ticket number %s. It is your turn, kindly proceed to %s.", customer.Ticket, counter)
+	if counter == "" {
+		msg = fmt.Sprintf("Ticket number %s. It is your turn.", customer.Ticket)
+	}
+	err := r.SendSMS(ctx, customer.Msisdn, msg)
+	if err != nil {
+		// the customer has left the wait list either way, and
+		// will still see their ticket called at the counter
+		r.logger.Warn("failed notifying customer of turn", zap.Int64("customer_id", customer.ID), zap.Error(err))
+	}
+
+	r.logger.Info("customer notified of turn", zap.Any("customer", customer), zap.String("counter", counter))
+}
+
+// RecallCustomer calls a customer who has already been called from
+// a queue once more, as when they did not come to the counter
+func (r *Rubix) RecallCustomer(ctx context.Context, queueID int64, customer *CustomerInfo, counter string) error {
+	msg := fmt.Sprintf("Ticket number %s. You are being called again, kindly proceed to %s.", customer.Ticket, counter)
+	err := r.SendSMS(ctx, customer.Msisdn, msg)
+	if err != nil {
+		return err
+	}
+
+	r.emit(Event{Type: EventCustomerRecalled, QueueID: queueID, Customer: customer, Counter: counter})
 	return nil
 }
 
-// NotifyNextCustomer deques a customer and notifies him of his
-// turn to be served at a specific counter and returns the
-// ID of the customer
-func (r *Rubix) NotifyNextCustomer(queueID, counterID int64) int {
-	customer := r.waitLists[queueID].Deque()
-	r.logger.Info("customer notified of turn", zap.Any("customer", customer), zap.Int64("counter", counterID))
-	return 1
+// ServeCustomer records a customer of a queue as served, taking
+// them off its wait list if they were still waiting on it
+func (r *Rubix) ServeCustomer(queueID int64, customer *CustomerInfo) {
+	r.removeFromWaitList(queueID, customer)
+	r.emit(Event{Type: EventCustomerServed, QueueID: queueID, Customer: customer})
+}
+
+// WaitListSizes returns the number of customers waiting
+// on each queue keyed by queue id
+func (r *Rubix) WaitListSizes() map[int64]int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	sizes := make(map[int64]int, len(r.waitLists))
+	for queueID, waitList := range r.waitLists {
+		sizes[queueID] = waitList.Size()
+	}
+
+	return sizes
 }
@@ -0,0 +1,410 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The stress tests drive Rubix from many goroutines at once. They
+// check that its state stays consistent, and are meant to be run
+// with the race detector: go test -race -run Stress ./pkg/app
+
+const (
+	stressWorkers   = 8
+	stressCustomers = 50
+)
+
+// calledSet records the customers called from wait lists
+type calledSet struct {
+	lock sync.Mutex
+	ids  map[int64]int
+}
+
+func newCalledSet() *calledSet {
+	return &calledSet{ids: map[int64]int{}}
+}
+
+func (s *calledSet) add(id int64) {
+	s.lock.Lock()
+	s.ids[id]++
+	s.lock.Unlock()
+}
+
+func (s *calledSet) snapshot() map[int64]int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := make(map[int64]int, len(s.ids))
+	for id, n := range s.ids {
+		ids[id] = n
+	}
+
+	return ids
+}
+
+// checkCalledOnce fails the test if a customer was called more than
+// once, or was called without having joined
+func (s *calledSet) checkCalledOnce(t *testing.T, joined map[int64]bool) {
+	t.Helper()
+
+	for id, n := range s.ids {
+		if n != 1 {
+			t.Errorf("expected customer %d to be called once, was called %d times", id, n)
+		}
+		if !joined[id] {
+			t.Errorf("expected customer %d to have joined before being called", id)
+		}
+	}
+}
+
+func newStressRubix(t *testing.T) *Rubix {
+	rubix := NewRubix(&recordingPublisher{}, zap.NewNop())
+	if err := rubix.AddBranch(1, "00:00", time.UTC); err != nil {
+		t.Fatalf("unexpected error adding branch: %v", err)
+	}
+	for _, queueID := range []int64{1, 2, 3} {
+		rubix.AddQueue(queueID, 1)
+	}
+
+	return rubix
+}
+
+// joinConcurrently has every worker join stressCustomers customers
+// to the queues in turn, and returns the customers who joined
+func joinConcurrently(t *testing.T, rubix *Rubix, queues []int64) map[int64]bool {
+	var lock sync.Mutex
+	joined := map[int64]bool{}
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressCustomers; i++ {
+				id := int64(w*stressCustomers + i + 1)
+				ticket, err := rubix.GenerateTicket(context.Background(), 1)
+				if err != nil {
+					t.Errorf("unexpected error generating ticket: %v", err)
+					return
+				}
+
+				queueID := queues[i%len(queues)]
+				if err := rubix.AddCustomerToWaitList(context.Background(), queueID, id, "+233200000000", ticket); err != nil {
+					continue
+				}
+
+				lock.Lock()
+				joined[id] = true
+				lock.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	return joined
+}
+
+func TestStress_GenerateTicket(t *testing.T) {
+	rubix := newStressRubix(t)
+	if err := rubix.AddBranch(2, "00:00", time.UTC); err != nil {
+		t.Fatalf("unexpected error adding branch: %v", err)
+	}
+
+	var lock sync.Mutex
+	issued := map[int64]map[int]bool{1: {}, 2: {}}
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(branchID int64) {
+			defer wg.Done()
+			for i := 0; i < stressCustomers; i++ {
+				ticket, err := rubix.GenerateTicket(context.Background(), branchID)
+				if err != nil {
+					t.Errorf("unexpected error generating ticket: %v", err)
+					return
+				}
+
+				lock.Lock()
+				n := ticketNumber(ticket)
+				if issued[branchID][n] {
+					t.Errorf("ticket number %d of branch %d was issued twice", n, branchID)
+				}
+				issued[branchID][n] = true
+				lock.Unlock()
+			}
+		}(int64(w%2 + 1))
+	}
+	wg.Wait()
+
+	for branchID, numbers := range issued {
+		want := stressWorkers / 2 * stressCustomers
+		for n := 1; n <= want; n++ {
+			if !numbers[n] {
+				t.Errorf("expected ticket number %d of branch %d to be issued", n, branchID)
+			}
+		}
+	}
+}
+
+func TestStress_JoinsAndCalls(t *testing.T) {
+	rubix := newStressRubix(t)
+	counter := Counter{ID: 1, Name: "Counter 1", Strategy: StrategyWeightedRoundRobin, Queues: []CounterQueue{
+		{QueueID: 1, Weight: 3}, {QueueID: 2, Weight: 2}, {QueueID: 3, Weight: 1},
+	}}
+
+	called := newCalledSet()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				var customer *CustomerInfo
+				var err error
+				if w%2 == 0 {
+					_, customer, err = rubix.NotifyNextCustomerForCounter(context.Background(), counter)
+				} else {
+					customer, err = rubix.NotifyNextCustomer(context.Background(), int64(w%3+1), "Counter 2")
+				}
+
+				if err == nil {
+					called.add(customer.ID)
+					continue
+				}
+
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Microsecond):
+				}
+			}
+		}(w)
+	}
+
+	joined := joinConcurrently(t, rubix, []int64{1, 2, 3})
+	close(done)
+	wg.Wait()
+
+	// customers may still be waiting if the callers stopped
+	// between a join and the join being seen
+	for _, queueID := range []int64{1, 2, 3} {
+		for {
+			customer, err := rubix.NotifyNextCustomer(context.Background(), queueID, "Counter 1")
+			if err != nil {
+				break
+			}
+			called.add(customer.ID)
+		}
+	}
+
+	if len(joined) != stressWorkers*stressCustomers {
+		t.Fatalf("expected %d customers to join, got %d", stressWorkers*stressCustomers, len(joined))
+	}
+
+	if len(called.ids) != len(joined) {
+		t.Errorf("expected every one of the %d customers to be called, got %d", len(joined), len(called.ids))
+	}
+	called.checkCalledOnce(t, joined)
+}
+
+func TestStress_Resets(t *testing.T) {
+	rubix := newStressRubix(t)
+	called := newCalledSet()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				rubix.Reset(1)
+				rubix.WaitListSizes()
+				rubix.CheckCapacity(1, QueueLimits{MaxLength: 10, MaxWait: time.Minute})
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if customer, err := rubix.NotifyNextCustomer(context.Background(), 2, "Counter 1"); err == nil {
+					called.add(customer.ID)
+				}
+			}
+		}
+	}()
+
+	joined := joinConcurrently(t, rubix, []int64{1, 2})
+	close(done)
+	wg.Wait()
+
+	called.checkCalledOnce(t, joined)
+
+	rubix.Reset(1)
+	for queueID, size := range rubix.WaitListSizes() {
+		if size != 0 {
+			t.Errorf("expected queue %d to be empty after a reset, got %d customers", queueID, size)
+		}
+	}
+
+	ticket, _ := rubix.GenerateTicket(context.Background(), 1)
+	if ticketNumber(ticket) != 1 {
+		t.Errorf("expected ticket numbering to restart at 1 after a reset, got %s", ticket)
+	}
+}
+
+func TestStress_DrainAndArchive(t *testing.T) {
+	rubix := newStressRubix(t)
+	called := newCalledSet()
+
+	var joins int32
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for atomic.LoadInt32(&joins) < stressCustomers {
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := rubix.SetQueueStatus(1, 1, QueueDraining); err != nil {
+			t.Errorf("unexpected error draining queue: %v", err)
+			return
+		}
+
+		for {
+			customer, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 1")
+			if err == nil {
+				called.add(customer.ID)
+				continue
+			}
+
+			if rubix.ArchiveQueue(1) == nil {
+				return
+			}
+		}
+	}()
+
+	var lock sync.Mutex
+	joined := map[int64]bool{}
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressCustomers; i++ {
+				id := int64(w*stressCustomers + i + 1)
+				err := rubix.AddCustomerToWaitList(context.Background(), 1, id, "+233200000000", "A001")
+				atomic.AddInt32(&joins, 1)
+				if err != nil {
+					continue
+				}
+
+				lock.Lock()
+				joined[id] = true
+				lock.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if _, ok := rubix.WaitListSizes()[1]; ok {
+		t.Fatalf("expected the wait list of the archived queue to be dropped")
+	}
+
+	if len(called.ids) != len(joined) {
+		t.Errorf("expected every one of the %d customers who joined to be called, got %d", len(joined), len(called.ids))
+	}
+	called.checkCalledOnce(t, joined)
+}
+
+func TestStress_Instances(t *testing.T) {
+	coordinator := newSharedCoordinator()
+	instances := newInstances(t, 2)
+	for _, rubix := range instances {
+		rubix.SetCoordinator(coordinator)
+	}
+
+	called := newCalledSet()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(rubix *Rubix) {
+			defer wg.Done()
+			for {
+				customer, err := rubix.NotifyNextCustomer(context.Background(), 1, "Counter 1")
+				if err == nil {
+					called.add(customer.ID)
+					continue
+				}
+
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Microsecond):
+				}
+			}
+		}(instances[w%2])
+	}
+
+	var lock sync.Mutex
+	joined := map[int64]bool{}
+	var joiners sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		joiners.Add(1)
+		go func(w int, rubix *Rubix) {
+			defer joiners.Done()
+			for i := 0; i < stressCustomers; i++ {
+				id := int64(w*stressCustomers + i + 1)
+				ticket, err := rubix.GenerateTicket(context.Background(), 1)
+				if err != nil {
+					t.Errorf("unexpected error generating ticket: %v", err)
+					return
+				}
+
+				if err := rubix.AddCustomerToWaitList(context.Background(), 1, id, "+233200000000", ticket); err != nil {
+					t.Errorf("unexpected error joining queue: %v", err)
+					continue
+				}
+
+				lock.Lock()
+				joined[id] = true
+				lock.Unlock()
+			}
+		}(w, instances[(w+1)%2])
+	}
+	joiners.Wait()
+
+	// let the callers empty the queue before stopping them
+	for len(called.snapshot()) < len(joined) {
+		time.Sleep(time.Millisecond)
+	}
+	close(done)
+	wg.Wait()
+
+	called.checkCalledOnce(t, joined)
+	for i, rubix := range instances {
+		if size := rubix.WaitListSizes()[1]; size != 0 {
+			t.Errorf("expected instance %d to see nobody waiting, got %d", i, size)
+		}
+	}
+
+	if n := coordinator.next[1]; n != stressWorkers*stressCustomers {
+		t.Errorf("expected %d tickets to be numbered, got %d", stressWorkers*stressCustomers, n)
+	}
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestRubix(t *testing.T) *Rubix {
+	rubix := NewRubix(nil, zap.NewNop())
+	for _, branchID := range []int64{1, 2} {
+		if err := rubix.AddBranch(branchID, "00:00", time.UTC); err != nil {
+			t.Fatalf("unexpected error adding branch: %v", err)
+		}
+	}
+	rubix.AddQueue(1, 1)
+	rubix.AddQueue(2, 1)
+	rubix.AddQueue(3, 2)
+
+	return rubix
+}
+
+func TestRehydrate(t *testing.T) {
+	rubix := newTestRubix(t)
+	if rubix.Rehydrated() {
+		t.Fatalf("expected rubix not to be rehydrated")
+	}
+
+	rubix.Rehydrate(map[int64][]*CustomerInfo{
+		1: {{Msisdn: "+233200662782", Ticket: "A007"}, {Msisdn: "+233200662783", Ticket: "B012"}},
+		2: {{Msisdn: "+233200662784", Ticket: "C009"}},
+		3: {{Msisdn: "+233200662785", Ticket: "D003"}},
+	})
+
+	if !rubix.Rehydrated() {
+		t.Fatalf("expected rubix to be rehydrated")
+	}
+
+	sizes := rubix.WaitListSizes()
+	if sizes[1] != 2 || sizes[2] != 1 || sizes[3] != 1 {
+		t.Fatalf("expected wait list sizes {1: 2, 2: 1, 3: 1}, got %v", sizes)
+	}
+
+	ticket, _ := rubix.GenerateTicket(context.Background(), 1)
+	if ticketNumber(ticket) != 13 {
+		t.Fatalf("expected ticket numbering of branch 1 to resume at 13, got %s", ticket)
+	}
+
+	ticket, _ = rubix.GenerateTicket(context.Background(), 2)
+	if ticketNumber(ticket) != 4 {
+		t.Fatalf("expected ticket numbering of branch 2 to resume at 4, got %s", ticket)
+	}
+}
+
+func TestGenerateTicket_ShouldFailForUnknownBranch(t *testing.T) {
+	rubix := newTestRubix(t)
+	if _, err := rubix.GenerateTicket(context.Background(), 99); err == nil {
+		t.Fatalf("expected an error for an unknown branch")
+	}
+}
+
+func TestReset(t *testing.T) {
+	rubix := newTestRubix(t)
+	rubix.Rehydrate(map[int64][]*CustomerInfo{
+		1: {{Msisdn: "+233200662782", Ticket: "A007"}},
+		3: {{Msisdn: "+233200662785", Ticket: "D003"}},
+	})
+
+	rubix.Reset(1)
+
+	sizes := rubix.WaitListSizes()
+	if sizes[1] != 0 || sizes[3] != 1 {
+		t.Fatalf("expected only the wait lists of branch 1 to be cleared, got %v", sizes)
+	}
+
+	ticket, _ := rubix.GenerateTicket(context.Background(), 1)
+	if ticketNumber(ticket) != 1 {
+		t.Fatalf("expected ticket numbering of branch 1 to restart at 1, got %s", ticket)
+	}
+
+	ticket, _ = rubix.GenerateTicket(context.Background(), 2)
+	if ticketNumber(ticket) != 4 {
+		t.Fatalf("expected ticket numbering of branch 2 to be untouched, got %s", ticket)
+	}
+}
+
+func TestBranchesDueForReset(t *testing.T) {
+	rubix := NewRubix(nil, zap.NewNop())
+	accra, _ := time.LoadLocation("Africa/Accra")
+	_ = rubix.AddBranch(1, "06:00", accra)
+	_ = rubix.AddBranch(2, "18:00", time.UTC)
+
+	lastReset := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	rubix.branches[1].lastReset = lastReset
+	rubix.branches[2].lastReset = lastReset
+
+	due := rubix.branchesDueForReset(time.Date(2020, 1, 1, 19, 0, 0, 0, time.UTC))
+	if at, ok := due[2]; len(due) != 1 || !ok || !at.Equal(time.Date(2020, 1, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected only branch 2 to be due for reset at 18:00, got %v", due)
+	}
+
+	due = rubix.branchesDueForReset(time.Date(2020, 1, 2, 7, 0, 0, 0, time.UTC))
+	if len(due) != 2 {
+		t.Fatalf("expected both branches to be due for reset, got %v", due)
+	}
+}
+
+func TestLastReset(t *testing.T) {
+	rubix := NewRubix(nil, zap.NewNop())
+	accra, _ := time.LoadLocation("Africa/Accra")
+	_ = rubix.AddBranch(1, "06:00", accra)
+
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{now: time.Date(2020, 1, 2, 7, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 2, 6, 0, 0, 0, time.UTC)},
+		{now: time.Date(2020, 1, 2, 5, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 1, 6, 0, 0, 0, time.UTC)},
+		{now: time.Date(2020, 1, 2, 6, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 2, 6, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got, ok := rubix.LastReset(1, tt.now)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("expected the last reset before %v to be %v, got %v", tt.now, tt.want, got)
+		}
+	}
+
+	if _, ok := rubix.LastReset(2, time.Now()); ok {
+		t.Errorf("expected no last reset for an unknown branch")
+	}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"fmt"
+	"time"
+)
+
+// scheduleLookahead is the number of days NextOpening searches
+// for the next time a queue opens
+const scheduleLookahead = 60
+
+// OpeningHours is the window of a day in which a queue admits
+// customers, in minutes after midnight. Customers may not join
+// after 'LastAdmission' when it is set, even though the queue
+// is still being served until 'Closes'
+type OpeningHours struct {
+	Opens         int
+	Closes        int
+	LastAdmission int
+}
+
+// cutoff returns the minute after which customers are turned away
+func (h OpeningHours) cutoff() int {
+	if h.LastAdmission > 0 && h.LastAdmission < h.Closes {
+		return h.LastAdmission
+	}
+
+	return h.Closes
+}
+
+// Closure is a period in which a queue is closed, from the
+// day 'From' to the day 'To' included, both as YYYY-MM-DD
+type Closure struct {
+	From   string
+	To     string
+	Reason string
+}
+
+// Schedule describes when a queue admits customers. A schedule
+// without opening hours admits customers at any time of the
+// day, except on the days it is closed
+type Schedule struct {
+	Location *time.Location
+	Hours    map[time.Weekday]OpeningHours
+	Closures []Closure
+}
+
+// ParseClock returns the number of minutes after midnight
+// of a time of day formatted as HH:MM
+func ParseClock(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", hhmm)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ClosureOn returns the closure covering the day of t, if any
+func (s *Schedule) ClosureOn(t time.Time) (Closure, bool) {
+	day := t.In(s.Location).Format("2006-01-02")
+	for _, c := range s.Closures {
+		if c.From <= day && day <= c.To {
+			return c, true
+		}
+	}
+
+	return Closure{}, false
+}
+
+// hoursOn returns the opening hours of the day of t, or false
+// if the queue does not open that day
+func (s *Schedule) hoursOn(t time.Time) (OpeningHours, bool) {
+	if _, closed := s.ClosureOn(t); closed {
+		return OpeningHours{}, false
+	}
+
+	if len(s.Hours) == 0 {
+		return OpeningHours{Opens: 0, Closes: 24 * 60}, true
+	}
+
+	h, ok := s.Hours[t.In(s.Location).Weekday()]
+	return h, ok
+}
+
+// at returns the time on the day of t, minutes after midnight
+func (s *Schedule) at(t time.Time, minutes int) time.Time {
+	local := t.In(s.Location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, minutes, 0, 0, s.Location)
+}
+
+// Admits returns true if customers may join the queue at t
+func (s *Schedule) Admits(t time.Time) bool {
+	h, ok := s.hoursOn(t)
+	if !ok {
+		return false
+	}
+
+	return !t.Before(s.at(t, h.Opens)) && t.Before(s.at(t, h.cutoff()))
+}
+
+// NextOpening returns the first time after t at which the queue
+// opens, or false if it does not open in the coming weeks
+func (s *Schedule) NextOpening(t time.Time) (time.Time, bool) {
+	local := t.In(s.Location)
+	for i := 0; i <= scheduleLookahead; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 12, 0, 0, 0, s.Location)
+		h, ok := s.hoursOn(day)
+		if !ok {
+			continue
+		}
+
+		opens := s.at(day, h.Opens)
+		if opens.After(t) {
+			return opens, true
+		}
+	}
+
+	return time.Time{}, false
+}
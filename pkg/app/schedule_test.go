@@ -0,0 +1,89 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleAdmits(t *testing.T) {
+	accra, _ := time.LoadLocation("Africa/Accra")
+	schedule := &Schedule{
+		Location: accra,
+		Hours: map[time.Weekday]OpeningHours{
+			time.Monday:   {Opens: 8 * 60, Closes: 17 * 60, LastAdmission: 16*60 + 30},
+			time.Saturday: {Opens: 9 * 60, Closes: 13 * 60},
+		},
+		Closures: []Closure{{From: "2020-01-13", To: "2020-01-14", Reason: "Public holiday"}},
+	}
+
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 1, day, hour, minute, 0, 0, accra)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{name: "before opening", t: at(6, 7, 59), want: false},
+		{name: "at opening", t: at(6, 8, 0), want: true},
+		{name: "before last admission", t: at(6, 16, 29), want: true},
+		{name: "after last admission", t: at(6, 16, 30), want: false},
+		{name: "saturday until closing", t: at(11, 12, 59), want: true},
+		{name: "saturday at closing", t: at(11, 13, 0), want: false},
+		{name: "day without hours", t: at(7, 10, 0), want: false},
+		{name: "holiday", t: at(13, 10, 0), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.Admits(tt.t); got != tt.want {
+				t.Fatalf("expected Admits(%v) to be %v, got %v", tt.t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestScheduleNextOpening(t *testing.T) {
+	schedule := &Schedule{
+		Location: time.UTC,
+		Hours: map[time.Weekday]OpeningHours{
+			time.Monday: {Opens: 8 * 60, Closes: 17 * 60},
+			time.Friday: {Opens: 10 * 60, Closes: 12 * 60},
+		},
+		Closures: []Closure{{From: "2020-01-10", To: "2020-01-13"}},
+	}
+
+	// Monday 6 January after closing reopens on Friday 17 January,
+	// as Friday 10 and Monday 13 January are closed
+	opens, ok := schedule.NextOpening(time.Date(2020, 1, 6, 18, 0, 0, 0, time.UTC))
+	if !ok {
+		t.Fatalf("expected the queue to reopen")
+	}
+
+	if want := time.Date(2020, 1, 17, 10, 0, 0, 0, time.UTC); !opens.Equal(want) {
+		t.Fatalf("expected the queue to reopen at %v, got %v", want, opens)
+	}
+
+	opens, _ = schedule.NextOpening(time.Date(2020, 1, 6, 7, 0, 0, 0, time.UTC))
+	if want := time.Date(2020, 1, 6, 8, 0, 0, 0, time.UTC); !opens.Equal(want) {
+		t.Fatalf("expected the queue to open at %v, got %v", want, opens)
+	}
+}
+
+func TestScheduleWithoutHours(t *testing.T) {
+	schedule := &Schedule{Location: time.UTC, Closures: []Closure{{From: "2020-01-01", To: "2020-01-01"}}}
+
+	if !schedule.Admits(time.Date(2020, 1, 2, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected a schedule without hours to admit customers at any time")
+	}
+
+	if schedule.Admits(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected a schedule without hours to be closed on holidays")
+	}
+
+	opens, _ := schedule.NextOpening(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC); !opens.Equal(want) {
+		t.Fatalf("expected the queue to reopen at %v, got %v", want, opens)
+	}
+}
@@ -1,6 +1,11 @@
 package app
 
-import "github.com/streadway/amqp"
+import (
+	"context"
+
+	"github.com/hackstock/rubixcore/pkg/metrics"
+	"github.com/streadway/amqp"
+)
 
 // SMSPublisher publishes SMS payloads onto
 // task queues to be consumed by SMS workers
@@ -15,9 +20,14 @@ func NewSMSPublisher(conn *amqp.Connection) SMSPublisher {
 	}
 }
 
-// Publish publishes sms onto the given queueName on
-// the message broker connection
-func (p SMSPublisher) Publish(sms, queueName string) error {
+// Publish publishes sms onto the given queueName on the message
+// broker connection. The broker client cannot be interrupted, so
+// ctx is only checked before publishing
+func (p SMSPublisher) Publish(ctx context.Context, sms, queueName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	channel, err := p.brokerConn.Channel()
 	if err != nil {
 		return err
@@ -45,6 +55,10 @@ func (p SMSPublisher) Publish(sms, queueName string) error {
 			ContentType:  "text/plain",
 			Body:         []byte(sms),
 		})
+	if err != nil {
+		return err
+	}
 
-	return err
+	metrics.SMSPublished.WithLabelValues(queue.Name).Inc()
+	return nil
 }
@@ -1,52 +1,139 @@
 package app
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // CustomerInfo stores relevant information
 // about a customer that needs to be placed on a wait list
 type CustomerInfo struct {
-	Msisdn string
-	Ticket string
+	ID       int64     `json:"id"`
+	Msisdn   string    `json:"msisdn"`
+	Ticket   string    `json:"ticket"`
+	JoinedAt time.Time `json:"joinedAt"`
 }
 
 // WaitList is a queue data structure to store customer infos
-// in a first-come first-served order
+// in a first-come first-served order. It is safe for concurrent use
 type WaitList struct {
-	Items []*CustomerInfo
+	items []*CustomerInfo
 	lock  sync.RWMutex
 }
 
 // NewWaitList returns a pointer to a new waitlist
 func NewWaitList() *WaitList {
 	return &WaitList{
-		Items: []*CustomerInfo{},
+		items: []*CustomerInfo{},
 	}
 }
 
 // Enqueue puts a customer info at the end of the waiting list
 func (wl *WaitList) Enqueue(c *CustomerInfo) {
 	wl.lock.Lock()
-	wl.Items = append(wl.Items, c)
+	wl.items = append(wl.items, c)
 	wl.lock.Unlock()
 }
 
-// Deque returns the customer info at the head of the waiting list
+// Insert puts a customer info ahead of every customer who joined
+// the waiting list after it, keeping customers who joined at the
+// same time in the order they were added
+func (wl *WaitList) Insert(c *CustomerInfo) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	i := len(wl.items)
+	for i > 0 && wl.items[i-1].JoinedAt.After(c.JoinedAt) {
+		i--
+	}
+
+	wl.items = append(wl.items, nil)
+	copy(wl.items[i+1:], wl.items[i:])
+	wl.items[i] = c
+}
+
+// Deque removes and returns the customer info at the head of the
+// waiting list, or nil if the list is empty
 func (wl *WaitList) Deque() *CustomerInfo {
 	wl.lock.Lock()
-	customerInfo := wl.Items[0]
-	wl.Items = wl.Items[1:len(wl.Items)]
-	wl.lock.Unlock()
+	defer wl.lock.Unlock()
+
+	if len(wl.items) == 0 {
+		return nil
+	}
+
+	customerInfo := wl.items[0]
+	wl.items = wl.items[1:len(wl.items)]
 
 	return customerInfo
 }
 
+// Remove takes a customer off the waiting list wherever they are
+// on it, returning false if they were not waiting on it
+func (wl *WaitList) Remove(customerID int64) bool {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	for i, c := range wl.items {
+		if c.ID == customerID {
+			wl.items = append(wl.items[:i], wl.items[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Peek returns the customer info at the head of the waiting
+// list without removing it, or nil if the list is empty
+func (wl *WaitList) Peek() *CustomerInfo {
+	wl.lock.RLock()
+	defer wl.lock.RUnlock()
+
+	if len(wl.items) == 0 {
+		return nil
+	}
+
+	return wl.items[0]
+}
+
+// Position returns the 1-based place of a customer on the waiting
+// list, or zero if the customer is not waiting on it
+func (wl *WaitList) Position(customerID int64) int {
+	wl.lock.RLock()
+	defer wl.lock.RUnlock()
+
+	for i, c := range wl.items {
+		if c.ID == customerID {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// Customers returns the customer infos on the
+// waiting list, from its head to its tail
+func (wl *WaitList) Customers() []*CustomerInfo {
+	wl.lock.RLock()
+	defer wl.lock.RUnlock()
+
+	customers := make([]*CustomerInfo, len(wl.items))
+	copy(customers, wl.items)
+
+	return customers
+}
+
 // IsEmpty returns true if the waiting list is empty
 // or false otherwise
 func (wl *WaitList) IsEmpty() bool {
-	return len(wl.Items) == 0
+	return wl.Size() == 0
 }
 
 // Size returns the number of customer info in the waiting list
 func (wl *WaitList) Size() int {
-	return len(wl.Items)
+	wl.lock.RLock()
+	defer wl.lock.RUnlock()
+
+	return len(wl.items)
 }
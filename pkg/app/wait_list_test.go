@@ -3,6 +3,7 @@ package app
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestWaitList(t *testing.T) {
@@ -39,3 +40,26 @@ func TestWaitList(t *testing.T) {
 		t.Errorf("expected %v, got %v", ciOne, got)
 	}
 }
+
+func TestWaitListInsert(t *testing.T) {
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	waitList := NewWaitList()
+	waitList.Enqueue(&CustomerInfo{Ticket: "A001", JoinedAt: start.Add(-10 * time.Minute)})
+	waitList.Enqueue(&CustomerInfo{Ticket: "A002", JoinedAt: start})
+	waitList.Enqueue(&CustomerInfo{Ticket: "A003", JoinedAt: start.Add(5 * time.Minute)})
+	waitList.Enqueue(&CustomerInfo{Ticket: "A004", JoinedAt: start.Add(12 * time.Minute)})
+
+	waitList.Insert(&CustomerInfo{Ticket: "B005", JoinedAt: start})
+	waitList.Insert(&CustomerInfo{Ticket: "B006", JoinedAt: start.Add(time.Hour)})
+
+	var got []string
+	for !waitList.IsEmpty() {
+		got = append(got, waitList.Deque().Ticket)
+	}
+
+	want := []string{"A001", "A002", "B005", "A003", "A004", "B006"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected order %v, got %v", want, got)
+	}
+}
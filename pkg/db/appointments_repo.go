@@ -0,0 +1,343 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Appointment statuses
+const (
+	AppointmentBooked    = "booked"
+	AppointmentCancelled = "cancelled"
+	AppointmentCheckedIn = "checked_in"
+)
+
+var (
+	// ErrSlotFull is returned when booking an appointment
+	// in a slot that has reached its capacity
+	ErrSlotFull = errors.New("appointment slot is fully booked")
+
+	// ErrAppointmentNotBooked is returned when cancelling, rescheduling
+	// or checking in an appointment that has already been cancelled
+	// or checked in
+	ErrAppointmentNotBooked = errors.New("appointment is no longer booked")
+)
+
+// AppointmentSlot models a recurring weekly time slot of a queue
+// in which up to 'Capacity' appointments can be booked.
+// 'Weekday' follows time.Weekday, so Sunday is 0, and
+// 'StartTime' and 'EndTime' are formatted as HH:MM in
+// the timezone of the queue's branch
+type AppointmentSlot struct {
+	ID        int64      `db:"id" json:"id"`
+	QueueID   int64      `db:"queue_id" json:"queueId"`
+	Weekday   int        `db:"weekday" json:"weekday"`
+	StartTime string     `db:"start_time" json:"startTime"`
+	EndTime   string     `db:"end_time" json:"endTime"`
+	Capacity  int        `db:"capacity" json:"capacity"`
+	CreatedAt *time.Time `db:"created_at" json:"createdAt"`
+}
+
+// Appointment models a customer's booking of a slot on a given day
+type Appointment struct {
+	ID         int64      `db:"id" json:"id"`
+	BranchID   int64      `db:"branch_id" json:"branchId"`
+	QueueID    int64      `db:"queue_id" json:"queueId"`
+	SlotID     int64      `db:"slot_id" json:"slotId"`
+	Msisdn     string     `db:"msisdn" json:"msisdn"`
+	StartsAt   time.Time  `db:"starts_at" json:"startsAt"`
+	EndsAt     time.Time  `db:"ends_at" json:"endsAt"`
+	Status     string     `db:"status" json:"status"`
+	CustomerID *int64     `db:"customer_id" json:"customerId"`
+	CreatedAt  *time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt  *time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// AppointmentsRepo defines methods for executing business rules
+// on appointment slots and appointments
+type AppointmentsRepo struct {
+	db *portableDB
+}
+
+// NewAppointmentsRepo returns a pointer to an AppointmentsRepo
+func NewAppointmentsRepo(db *sqlx.DB) *AppointmentsRepo {
+	return &AppointmentsRepo{portable(db)}
+}
+
+// CreateSlot saves an appointment slot into the database
+func (repo *AppointmentsRepo) CreateSlot(ctx context.Context, s *AppointmentSlot) (*AppointmentSlot, error) {
+	query := "INSERT INTO appointment_slots (queue_id, weekday, start_time, end_time, capacity) VALUES (?, ?, ?, ?, ?)"
+
+	id, err := repo.db.insert(ctx, query, s.QueueID, s.Weekday, s.StartTime, s.EndTime, s.Capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ID = id
+	return s, nil
+}
+
+// GetSlot fetches and returns an appointment slot by id
+func (repo *AppointmentsRepo) GetSlot(ctx context.Context, id int64) (*AppointmentSlot, error) {
+	query := "SELECT s.* FROM appointment_slots AS s WHERE s.id = ?"
+
+	s := new(AppointmentSlot)
+	err := repo.db.Get(ctx, s, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetSlots fetches and returns the slots of a queue ordered
+// by weekday and start time
+func (repo *AppointmentsRepo) GetSlots(ctx context.Context, queueID int64) ([]*AppointmentSlot, error) {
+	query := "SELECT s.* FROM appointment_slots AS s WHERE s.queue_id = ? ORDER BY s.weekday, s.start_time"
+
+	slots := []*AppointmentSlot{}
+	err := repo.db.Select(ctx, &slots, query, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// DeleteSlot deletes an appointment slot by id
+func (repo *AppointmentsRepo) DeleteSlot(ctx context.Context, id int64) error {
+	query := "DELETE FROM appointment_slots WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, id)
+	return err
+}
+
+// CountBooked returns the number of appointments that have not
+// been cancelled in a slot starting at the given time
+func (repo *AppointmentsRepo) CountBooked(ctx context.Context, slotID int64, startsAt time.Time) (int, error) {
+	query := "SELECT COUNT(*) FROM appointments WHERE slot_id = ? AND starts_at = ? AND status <> ?"
+
+	var count int
+	err := repo.db.Get(ctx, &count, query, slotID, startsAt, AppointmentCancelled)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// reserve locks a slot and returns ErrSlotFull if it has no room
+// left at the given start time. The lock is held until tx ends so
+// concurrent bookings of the same slot cannot exceed its capacity
+func reserve(ctx context.Context, tx *portableTx, slotID int64, startsAt time.Time) error {
+	var capacity int
+	err := tx.Get(ctx, &capacity, "SELECT capacity FROM appointment_slots WHERE id = ?"+forUpdate(tx.DriverName()), slotID)
+	if err != nil {
+		return err
+	}
+
+	var booked int
+	err = tx.Get(ctx, &booked, "SELECT COUNT(*) FROM appointments WHERE slot_id = ? AND starts_at = ? AND status <> ?", slotID, startsAt, AppointmentCancelled)
+	if err != nil {
+		return err
+	}
+
+	if booked >= capacity {
+		return ErrSlotFull
+	}
+
+	return nil
+}
+
+// Book saves an appointment into the database if its slot
+// has not reached capacity
+func (repo *AppointmentsRepo) Book(ctx context.Context, a *Appointment) (*Appointment, error) {
+	tx, err := repo.db.Beginx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = reserve(ctx, tx, a.SlotID, a.StartsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "INSERT INTO appointments (branch_id, queue_id, slot_id, msisdn, starts_at, ends_at, status) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	id, err := tx.insert(ctx, query, a.BranchID, a.QueueID, a.SlotID, a.Msisdn, a.StartsAt, a.EndsAt, AppointmentBooked)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	a.ID = id
+	a.Status = AppointmentBooked
+	return a, nil
+}
+
+// Reschedule moves a booked appointment to another slot or day
+// if the new slot has not reached capacity
+func (repo *AppointmentsRepo) Reschedule(ctx context.Context, a *Appointment) (*Appointment, error) {
+	tx, err := repo.db.Beginx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = reserve(ctx, tx, a.SlotID, a.StartsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "UPDATE appointments SET slot_id = ?, starts_at = ?, ends_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?"
+	res, err := tx.Exec(ctx, query, a.SlotID, a.StartsAt, a.EndsAt, a.ID, AppointmentBooked)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = expectOneRow(res); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.Get(ctx, a.ID)
+}
+
+// Cancel cancels a booked appointment, freeing its place in the slot
+func (repo *AppointmentsRepo) Cancel(ctx context.Context, id int64) error {
+	query := "UPDATE appointments SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?"
+
+	res, err := repo.db.Exec(ctx, query, AppointmentCancelled, id, AppointmentBooked)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(res)
+}
+
+// CheckIn saves the customer created for a booked appointment when
+// the customer arrives, and marks the appointment as checked in
+func (repo *AppointmentsRepo) CheckIn(ctx context.Context, id int64, c *Customer) (*Customer, error) {
+	tx, err := repo.db.Beginx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO customers (branch_id, msisdn, ticket, queue_id) VALUES (?, ?, ?, ?)"
+	customerID, err := tx.insert(ctx, query, c.BranchID, c.Msisdn, c.Ticket, c.QueueID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = "UPDATE appointments SET status = ?, customer_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?"
+	res, err := tx.Exec(ctx, query, AppointmentCheckedIn, customerID, id, AppointmentBooked)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = expectOneRow(res); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	c.ID = customerID
+	return c, nil
+}
+
+// expectOneRow returns ErrAppointmentNotBooked if a conditional
+// update of a booked appointment did not match any row
+func expectOneRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrAppointmentNotBooked
+	}
+
+	return nil
+}
+
+// Get fetches and returns an appointment by id
+func (repo *AppointmentsRepo) Get(ctx context.Context, id int64) (*Appointment, error) {
+	query := "SELECT a.* FROM appointments AS a WHERE a.id = ?"
+
+	a := new(Appointment)
+	err := repo.db.Get(ctx, a, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// AppointmentFilter restricts the appointments returned by List.
+// Zero values are ignored
+type AppointmentFilter struct {
+	BranchID int64
+	QueueID  int64
+	Status   string
+	Msisdn   string
+	From     *time.Time
+	To       *time.Time
+}
+
+// List fetches a page of appointments matching the given filter.
+// From and To apply to the start of the appointments. The returned
+// flag reports whether there are more appointments after the page
+func (repo *AppointmentsRepo) List(ctx context.Context, f AppointmentFilter, p Page) ([]*Appointment, bool, error) {
+	q := newListQuery("appointments", "a")
+	if f.BranchID != 0 {
+		q.where("a.branch_id = ?", f.BranchID)
+	}
+	if f.QueueID != 0 {
+		q.where("a.queue_id = ?", f.QueueID)
+	}
+	if f.Status != "" {
+		q.where("a.status = ?", f.Status)
+	}
+	if f.Msisdn != "" {
+		q.where("a.msisdn = ?", f.Msisdn)
+	}
+	if f.From != nil {
+		q.where("a.starts_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q.where("a.starts_at < ?", *f.To)
+	}
+
+	query, args, err := q.build(p)
+	if err != nil {
+		return nil, false, err
+	}
+
+	appointments := []*Appointment{}
+	err = repo.db.Select(ctx, &appointments, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(appointments) > p.limit() {
+		return appointments[:p.limit()], true, nil
+	}
+
+	return appointments, false, nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestBookAppointment_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	a := &Appointment{BranchID: 1, QueueID: 2, SlotID: 3, Msisdn: "+233200662782", StartsAt: start, EndsAt: start.Add(30 * time.Minute)}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT capacity FROM appointment_slots WHERE id = \? FOR UPDATE$`).
+		WithArgs(a.SlotID).
+		WillReturnRows(sqlmock.NewRows([]string{"capacity"}).AddRow(2))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM appointments WHERE slot_id = \? AND starts_at = \? AND status <> \?$`).
+		WithArgs(a.SlotID, a.StartsAt, AppointmentCancelled).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(`^INSERT INTO appointments \(branch_id, queue_id, slot_id, msisdn, starts_at, ends_at, status\) VALUES \(\?, \?, \?, \?, \?, \?, \?\)$`).
+		WithArgs(a.BranchID, a.QueueID, a.SlotID, a.Msisdn, a.StartsAt, a.EndsAt, AppointmentBooked).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectCommit()
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewAppointmentsRepo(dbMock)
+
+	booked, err := repo.Book(context.Background(), a)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if booked.ID != 9 || booked.Status != AppointmentBooked {
+		t.Fatalf("unexpected appointment %+v", booked)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestBookAppointment_ShouldFailWhenSlotIsFull(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	a := &Appointment{BranchID: 1, QueueID: 2, SlotID: 3, Msisdn: "+233200662782", StartsAt: start, EndsAt: start.Add(30 * time.Minute)}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT capacity FROM appointment_slots WHERE id = \? FOR UPDATE$`).
+		WithArgs(a.SlotID).
+		WillReturnRows(sqlmock.NewRows([]string{"capacity"}).AddRow(2))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM appointments`).
+		WithArgs(a.SlotID, a.StartsAt, AppointmentCancelled).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectRollback()
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewAppointmentsRepo(dbMock)
+
+	_, err = repo.Book(context.Background(), a)
+	if err != ErrSlotFull {
+		t.Fatalf("expected ErrSlotFull, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCancelAppointment_ShouldFailWhenNotBooked(t *testing.T) {
+	query := `^UPDATE appointments SET status = \?, updated_at = CURRENT_TIMESTAMP WHERE id = \? AND status = \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(query).
+		WithArgs(AppointmentCancelled, 4, AppointmentBooked).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewAppointmentsRepo(dbMock)
+
+	err = repo.Cancel(context.Background(), 4)
+	if err != ErrAppointmentNotBooked {
+		t.Fatalf("expected ErrAppointmentNotBooked, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCheckInAppointment_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	c := &Customer{BranchID: 1, QueueID: 2, Msisdn: "+233200662782", Ticket: "A001"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO customers \(branch_id, msisdn, ticket, queue_id\) VALUES \(\?, \?, \?, \?\)$`).
+		WithArgs(c.BranchID, c.Msisdn, c.Ticket, c.QueueID).
+		WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectExec(`^UPDATE appointments SET status = \?, customer_id = \?, updated_at = CURRENT_TIMESTAMP WHERE id = \? AND status = \?$`).
+		WithArgs(AppointmentCheckedIn, 12, 4, AppointmentBooked).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewAppointmentsRepo(dbMock)
+
+	saved, err := repo.CheckIn(context.Background(), 4, c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved.ID != 12 {
+		t.Fatalf("expected customer id 12, got %d", saved.ID)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+// AuditEvent models an entry in the append-only audit log.
+// Before and After hold JSON snapshots of the target
+type AuditEvent struct {
+	ID         int64          `db:"id" json:"id"`
+	ActorID    *int64         `db:"actor_id" json:"actorId"`
+	Actor      string         `db:"actor" json:"actor"`
+	Action     string         `db:"action" json:"action"`
+	TargetType string         `db:"target_type" json:"targetType"`
+	TargetID   string         `db:"target_id" json:"targetId"`
+	Before     types.JSONText `db:"before_state" json:"before"`
+	After      types.JSONText `db:"after_state" json:"after"`
+	IPAddress  string         `db:"ip_address" json:"ipAddress"`
+	Method     string         `db:"method" json:"method"`
+	Path       string         `db:"path" json:"path"`
+	StatusCode int            `db:"status_code" json:"statusCode"`
+	CreatedAt  *time.Time     `db:"created_at" json:"createdAt"`
+}
+
+// AuditFilter restricts the audit events returned by List.
+// Zero values are ignored
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+// AuditRepo defines methods for recording and reviewing
+// audit events. Events can only be appended, never changed
+type AuditRepo struct {
+	db *portableDB
+}
+
+// NewAuditRepo returns a pointer to an AuditRepo
+func NewAuditRepo(db *sqlx.DB) *AuditRepo {
+	return &AuditRepo{portable(db)}
+}
+
+// Create appends an audit event to the log
+func (repo *AuditRepo) Create(ctx context.Context, e *AuditEvent) (*AuditEvent, error) {
+	query := "INSERT INTO audit_events (actor_id, actor, action, target_type, target_id, before_state, after_state, ip_address, method, path, status_code) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	id, err := repo.db.insert(ctx, query, e.ActorID, e.Actor, e.Action, e.TargetType, e.TargetID, e.Before, e.After, e.IPAddress, e.Method, e.Path, e.StatusCode)
+	if err != nil {
+		return nil, err
+	}
+
+	e.ID = id
+	return e, nil
+}
+
+// List fetches a page of audit events matching the given filter.
+// The returned flag reports whether there are more events
+// after the page
+func (repo *AuditRepo) List(ctx context.Context, f AuditFilter, p Page) ([]*AuditEvent, bool, error) {
+	q := newListQuery("audit_events", "a")
+	if f.Actor != "" {
+		q.where("a.actor = ?", f.Actor)
+	}
+	if f.Action != "" {
+		q.where("a.action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		q.where("a.target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		q.where("a.target_id = ?", f.TargetID)
+	}
+	if f.From != nil {
+		q.where("a.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q.where("a.created_at < ?", *f.To)
+	}
+
+	query, args, err := q.build(p)
+	if err != nil {
+		return nil, false, err
+	}
+
+	events := []*AuditEvent{}
+	err = repo.db.Select(ctx, &events, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(events) > p.limit() {
+		return events[:p.limit()], true, nil
+	}
+
+	return events, false, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+func TestCreateAuditEvent_ShouldPass(t *testing.T) {
+	query := `^INSERT INTO audit_events \(actor_id, actor, action, target_type, target_id, before_state, after_state, ip_address, method, path, status_code\) VALUES \(\?, \?, \?, \?, \?, \?, \?, \?, \?, \?, \?\)$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	actorID := int64(1)
+	e := &AuditEvent{
+		ActorID:    &actorID,
+		Actor:      "admin",
+		Action:     "queue.delete",
+		TargetType: "queue",
+		TargetID:   "3",
+		Before:     types.JSONText(`{"id":3}`),
+		After:      types.JSONText("null"),
+		IPAddress:  "10.0.0.1",
+		Method:     "DELETE",
+		Path:       "/queues/3",
+		StatusCode: 200,
+	}
+
+	mock.ExpectExec(query).
+		WithArgs(e.ActorID, e.Actor, e.Action, e.TargetType, e.TargetID, []byte(e.Before), []byte(e.After), e.IPAddress, e.Method, e.Path, e.StatusCode).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewAuditRepo(dbMock)
+
+	saved, err := repo.Create(context.Background(), e)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved == nil || saved.ID != 1 {
+		t.Fatalf("expected audit event with id 1, got %v", saved)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateAuditEvent_ShouldFail(t *testing.T) {
+	query := `^INSERT INTO audit_events`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(query).WillReturnError(fmt.Errorf("db error"))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewAuditRepo(dbMock)
+
+	saved, err := repo.Create(context.Background(), &AuditEvent{Actor: "anonymous", Action: "post /customers/"})
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	if saved != nil {
+		t.Fatalf("expected nil, got %v", saved)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListAuditEvents_ShouldPass(t *testing.T) {
+	query := `^SELECT a.\* FROM audit_events AS a WHERE a.actor = \? AND a.target_type = \? ORDER BY a.created_at DESC, a.id DESC LIMIT \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	filter := AuditFilter{Actor: "admin", TargetType: "queue"}
+
+	mock.ExpectQuery(query).WithArgs(filter.Actor, filter.TargetType, DefaultPageLimit+1).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "actor_id", "actor", "action", "target_type", "target_id", "before_state", "after_state", "ip_address", "method", "path", "status_code", "created_at"}).
+			AddRow(2, 1, "admin", "queue.delete", "queue", "3", `{"id":3}`, nil, "10.0.0.1", "DELETE", "/queues/3", 200, time.Now()).
+			AddRow(1, 1, "admin", "queue.create", "queue", "3", nil, `{"id":3}`, "10.0.0.1", "POST", "/queues/", 200, time.Now()),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewAuditRepo(dbMock)
+
+	events, hasMore, err := repo.List(context.Background(), filter, Page{Sort: "created_at", Desc: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(events) != 2 || hasMore {
+		t.Fatalf("expected a single page of 2 events, got %d", len(events))
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Branch models a branch of the business in the db. Queues,
+// customers and user accounts all belong to a branch.
+// 'TicketTemplate' lays out the tickets printed by the
+// branch's kiosks, the default layout is used when nil
+type Branch struct {
+	ID               int64      `db:"id" json:"id"`
+	Name             string     `db:"name" json:"name" validate:"required,max=255"`
+	TicketsResetTime *string    `db:"tickets_reset_time" json:"ticketsResetTime" validate:"hhmm"`
+	Timezone         string     `db:"timezone" json:"timezone" validate:"max=64"`
+	TicketTemplate   *string    `db:"ticket_template" json:"ticketTemplate"`
+	CreatedAt        *time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt        *time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// BranchesRepo defines methods for executing business rules
+// on branches
+type BranchesRepo struct {
+	db *portableDB
+}
+
+// NewBranchesRepo returns a pointer to a BranchesRepo
+func NewBranchesRepo(db *sqlx.DB) *BranchesRepo {
+	return &BranchesRepo{portable(db)}
+}
+
+// Create saves a branch into the database
+func (repo *BranchesRepo) Create(ctx context.Context, b *Branch) (*Branch, error) {
+	query := "INSERT INTO branches (name, tickets_reset_time, timezone, ticket_template) VALUES (?, ?, ?, ?)"
+
+	id, err := repo.db.insert(ctx, query, b.Name, b.TicketsResetTime, b.Timezone, b.TicketTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	b.ID = id
+	return b, nil
+}
+
+// GetAll fetches and returns all branches from the database
+func (repo *BranchesRepo) GetAll(ctx context.Context) ([]*Branch, error) {
+	query := "SELECT b.* FROM branches AS b"
+
+	var branches []*Branch
+	err := repo.db.Select(ctx, &branches, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return branches, nil
+}
+
+// Get fetches and returns a branch by id
+func (repo *BranchesRepo) Get(ctx context.Context, id int64) (*Branch, error) {
+	query := "SELECT b.* FROM branches AS b WHERE b.id = ?"
+
+	b := new(Branch)
+	err := repo.db.Get(ctx, b, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Update updates the name, ticket reset time, timezone or ticket
+// template of a branch and returns the updated record
+func (repo *BranchesRepo) Update(ctx context.Context, b *Branch) (*Branch, error) {
+	query := "UPDATE branches SET name = ?, tickets_reset_time = ?, timezone = ?, ticket_template = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, b.Name, b.TicketsResetTime, b.Timezone, b.TicketTemplate, b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.Get(ctx, b.ID)
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestCreateBranch_ShouldPass(t *testing.T) {
+	query := `^INSERT INTO branches \(name, tickets_reset_time, timezone, ticket_template\) VALUES \(\?, \?, \?, \?\)$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	resetTime := "05:30"
+	b := &Branch{Name: "Osu Branch", TicketsResetTime: &resetTime, Timezone: "Africa/Accra"}
+
+	mock.ExpectExec(query).
+		WithArgs(b.Name, b.TicketsResetTime, b.Timezone, b.TicketTemplate).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	branchesRepo := NewBranchesRepo(dbMock)
+
+	saved, err := branchesRepo.Create(context.Background(), b)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved.ID != 2 {
+		t.Fatalf("expected branch id 2, got %d", saved.ID)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateBranch_ShouldFail(t *testing.T) {
+	query := `^INSERT INTO branches \(name, tickets_reset_time, timezone, ticket_template\) VALUES \(\?, \?, \?, \?\)$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	b := &Branch{Name: "Osu Branch", Timezone: "UTC"}
+
+	mock.ExpectExec(query).
+		WithArgs(b.Name, b.TicketsResetTime, b.Timezone, b.TicketTemplate).
+		WillReturnError(fmt.Errorf("some error"))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	branchesRepo := NewBranchesRepo(dbMock)
+
+	saved, err := branchesRepo.Create(context.Background(), b)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	if saved != nil {
+		t.Fatalf("expected nil branch, got %v", saved)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetBranch_ShouldPass(t *testing.T) {
+	query := `^SELECT b\.\* FROM branches AS b WHERE b\.id = \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "name", "tickets_reset_time", "timezone", "ticket_template", "created_at", "updated_at"}).
+		AddRow(1, "Main Branch", nil, "UTC", nil, nil, nil)
+	mock.ExpectQuery(query).WithArgs(1).WillReturnRows(rows)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	branchesRepo := NewBranchesRepo(dbMock)
+
+	branch, err := branchesRepo.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if branch.Name != "Main Branch" || branch.TicketsResetTime != nil {
+		t.Fatalf("unexpected branch %+v", branch)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Coordinator lets instances of the service sharing a database agree
+// on the ticket numbers they issue and on which of them calls each
+// waiting customer. Each branch has a row in ticket_sequences holding
+// the number its next ticket gets, created the first time it is needed
+type Coordinator struct {
+	db *portableDB
+}
+
+// NewCoordinator returns a pointer to a new Coordinator
+func NewCoordinator(db *sqlx.DB) *Coordinator {
+	return &Coordinator{
+		db: portable(db),
+	}
+}
+
+// NextTicket returns the next ticket number of a branch. The UPDATE
+// locks the row of the branch's sequence until the transaction ends,
+// so instances issuing tickets at the same time each get their own
+func (c *Coordinator) NextTicket(ctx context.Context, branchID int64) (int, error) {
+	n, err := c.nextTicket(ctx, branchID)
+	if err != sql.ErrNoRows {
+		return n, err
+	}
+
+	err = c.createSequence(ctx, branchID)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.nextTicket(ctx, branchID)
+}
+
+// nextTicket takes the next number of a branch's sequence, failing
+// with sql.ErrNoRows if the branch has no sequence yet
+func (c *Coordinator) nextTicket(ctx context.Context, branchID int64) (int, error) {
+	tx, err := c.db.Beginx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, "UPDATE ticket_sequences SET next_number = next_number + 1 WHERE branch_id = ?", branchID)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	var next int
+	err = tx.Get(ctx, &next, "SELECT next_number FROM ticket_sequences WHERE branch_id = ?", branchID)
+	if err != nil {
+		return 0, err
+	}
+
+	return next - 1, tx.Commit()
+}
+
+// createSequence starts the ticket sequence of a branch at 1. Another
+// instance creating it first is not an error
+func (c *Coordinator) createSequence(ctx context.Context, branchID int64) error {
+	_, err := c.db.Exec(ctx, "INSERT INTO ticket_sequences (branch_id, next_number) VALUES (?, 1)", branchID)
+	if IsDuplicateKey(err) {
+		return nil
+	}
+
+	return err
+}
+
+// ResumeTickets makes the ticket numbers of a branch continue from at
+// least next, so numbers already issued are not issued again
+func (c *Coordinator) ResumeTickets(ctx context.Context, branchID int64, next int) error {
+	err := c.createSequence(ctx, branchID)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE ticket_sequences SET next_number = ? WHERE branch_id = ? AND next_number < ?"
+	_, err = c.db.Exec(ctx, query, next, branchID, next)
+
+	return err
+}
+
+// ResetTickets restarts the ticket numbers of a branch at 1 for the
+// reset due at 'at'. Every instance resets its branches, and only the
+// first to do so for a given reset restarts the sequence
+func (c *Coordinator) ResetTickets(ctx context.Context, branchID int64, at time.Time) error {
+	err := c.createSequence(ctx, branchID)
+	if err != nil {
+		return err
+	}
+
+	at = at.UTC()
+	query := "UPDATE ticket_sequences SET next_number = 1, reset_at = ? WHERE branch_id = ? AND (reset_at IS NULL OR reset_at < ?)"
+	_, err = c.db.Exec(ctx, query, at, branchID, at)
+
+	return err
+}
+
+// Claim marks a customer as served, returning false if they had
+// already been served, as when another instance called them first
+func (c *Coordinator) Claim(ctx context.Context, customerID int64) (bool, error) {
+	query := "UPDATE customers SET served_at = CURRENT_TIMESTAMP WHERE id = ? AND served_at IS NULL"
+
+	res, err := c.db.Exec(ctx, query, customerID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
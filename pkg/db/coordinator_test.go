@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestNextTicket_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE ticket_sequences SET next_number = next_number \+ 1 WHERE branch_id = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectExec(`^INSERT INTO ticket_sequences \(branch_id, next_number\) VALUES \(\?, 1\)$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE ticket_sequences SET next_number = next_number \+ 1 WHERE branch_id = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT next_number FROM ticket_sequences WHERE branch_id = \?$`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"next_number"}).AddRow(2))
+	mock.ExpectCommit()
+
+	coordinator := NewCoordinator(sqlx.NewDb(db, "sqlmock"))
+
+	n, err := coordinator.NextTicket(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n != 1 {
+		t.Fatalf("expected the first ticket of a new sequence to be 1, got %d", n)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestClaim_ShouldFail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE customers SET served_at = CURRENT_TIMESTAMP WHERE id = \? AND served_at IS NULL$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	coordinator := NewCoordinator(sqlx.NewDb(db, "sqlmock"))
+
+	claimed, err := coordinator.Claim(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if claimed {
+		t.Fatalf("expected a customer already served not to be claimed")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
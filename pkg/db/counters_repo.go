@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Counter models a service point of a branch in the db.
+// 'Strategy' decides which of the counter's queues the next
+// customer is called from
+type Counter struct {
+	ID        int64           `db:"id" json:"id"`
+	BranchID  int64           `db:"branch_id" json:"branchId"`
+	Name      string          `db:"name" json:"name" validate:"required,max=255"`
+	Strategy  string          `db:"strategy" json:"strategy"`
+	IsActive  bool            `db:"is_active" json:"isActive"`
+	CreatedAt *time.Time      `db:"created_at" json:"createdAt"`
+	UpdatedAt *time.Time      `db:"updated_at" json:"updatedAt"`
+	Queues    []*CounterQueue `db:"-" json:"queues"`
+}
+
+// CounterQueue models a queue served by a counter, along with
+// its weight for weighted round-robin and its priority
+type CounterQueue struct {
+	CounterID int64 `db:"counter_id" json:"counterId"`
+	QueueID   int64 `db:"queue_id" json:"queueId"`
+	Weight    int   `db:"weight" json:"weight"`
+	Priority  int   `db:"priority" json:"priority"`
+}
+
+// CountersRepo defines methods for executing business rules
+// on counters
+type CountersRepo struct {
+	db *portableDB
+}
+
+// NewCountersRepo returns a pointer to a CountersRepo
+func NewCountersRepo(db *sqlx.DB) *CountersRepo {
+	return &CountersRepo{portable(db)}
+}
+
+// Create saves a counter into the database
+func (repo *CountersRepo) Create(ctx context.Context, c *Counter) (*Counter, error) {
+	query := "INSERT INTO counters (branch_id, name, strategy) VALUES (?, ?, ?)"
+
+	id, err := repo.db.insert(ctx, query, c.BranchID, c.Name, c.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ID = id
+	c.IsActive = true
+	return c, nil
+}
+
+// GetAll fetches and returns all counters of a branch, or
+// of every branch when branchID is zero
+func (repo *CountersRepo) GetAll(ctx context.Context, branchID int64) ([]*Counter, error) {
+	query := "SELECT c.* FROM counters AS c"
+	var args []interface{}
+	if branchID != 0 {
+		query += " WHERE c.branch_id = ?"
+		args = append(args, branchID)
+	}
+
+	counters := []*Counter{}
+	err := repo.db.Select(ctx, &counters, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// Get fetches and returns a counter by id along with its queues
+func (repo *CountersRepo) Get(ctx context.Context, id int64) (*Counter, error) {
+	query := "SELECT c.* FROM counters AS c WHERE c.id = ?"
+
+	c := new(Counter)
+	err := repo.db.Get(ctx, c, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Queues, err = repo.GetQueues(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetQueues fetches and returns the queues served by a counter
+func (repo *CountersRepo) GetQueues(ctx context.Context, counterID int64) ([]*CounterQueue, error) {
+	query := "SELECT cq.* FROM counter_queues AS cq WHERE cq.counter_id = ? ORDER BY cq.priority DESC, cq.queue_id"
+
+	queues := []*CounterQueue{}
+	err := repo.db.Select(ctx, &queues, query, counterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return queues, nil
+}
+
+// Update updates the name, strategy or activity status of a
+// counter and returns the updated record
+func (repo *CountersRepo) Update(ctx context.Context, c *Counter) (*Counter, error) {
+	query := "UPDATE counters SET name = ?, strategy = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, c.Name, c.Strategy, c.IsActive, c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.Get(ctx, c.ID)
+}
+
+// SetQueues replaces the queues served by a counter
+func (repo *CountersRepo) SetQueues(ctx context.Context, counterID int64, queues []*CounterQueue) ([]*CounterQueue, error) {
+	tx, err := repo.db.Beginx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(ctx, "DELETE FROM counter_queues WHERE counter_id = ?", counterID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "INSERT INTO counter_queues (counter_id, queue_id, weight, priority) VALUES (?, ?, ?, ?)"
+	for _, q := range queues {
+		_, err = tx.Exec(ctx, query, counterID, q.QueueID, q.Weight, q.Priority)
+		if err != nil {
+			return nil, err
+		}
+		q.CounterID = counterID
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return queues, nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestCreateCounter_ShouldPass(t *testing.T) {
+	query := `^INSERT INTO counters \(branch_id, name, strategy\) VALUES \(\?, \?, \?\)$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	c := &Counter{BranchID: 1, Name: "Counter 1", Strategy: "priority"}
+
+	mock.ExpectExec(query).
+		WithArgs(c.BranchID, c.Name, c.Strategy).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCountersRepo(dbMock)
+
+	saved, err := repo.Create(context.Background(), c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved.ID != 4 || !saved.IsActive {
+		t.Fatalf("unexpected counter %+v", saved)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetCounterQueues_ShouldFail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	queues := []*CounterQueue{{QueueID: 1, Weight: 2}, {QueueID: 2, Weight: 1, Priority: 5}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM counter_queues WHERE counter_id = \?$`).
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO counter_queues \(counter_id, queue_id, weight, priority\) VALUES \(\?, \?, \?, \?\)$`).
+		WithArgs(4, 1, 2, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO counter_queues`).
+		WithArgs(4, 2, 1, 5).
+		WillReturnError(fmt.Errorf("db error"))
+	mock.ExpectRollback()
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCountersRepo(dbMock)
+
+	saved, err := repo.SetQueues(context.Background(), 4, queues)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	if saved != nil {
+		t.Fatalf("expected nil, got %v", saved)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,42 +1,97 @@
 package db
 
 import (
+	"context"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// Customer models a customer in the database
+// Customer models a customer in the database.
+// 'RedirectedFromQueueID' is set when the customer asked to join
+// a queue that was full and was sent to its overflow queue instead
 type Customer struct {
-	ID        int64      `db:"id" json:"id"`
-	Msisdn    string     `db:"msisdn" json:"msisdn"`
-	Ticket    string     `db:"ticket" json:"ticket"`
-	QueueID   int64      `db:"queue_id" json:"queueId"`
-	CreatedAt *time.Time `db:"created_at" json:"createdAt"`
-	ServedAt  *time.Time `db:"served_at" json:"servedAt"`
+	ID                    int64      `db:"id" json:"id"`
+	BranchID              int64      `db:"branch_id" json:"branchId"`
+	Msisdn                string     `db:"msisdn" json:"msisdn"`
+	Ticket                string     `db:"ticket" json:"ticket"`
+	QueueID               int64      `db:"queue_id" json:"queueId" validate:"required"`
+	RedirectedFromQueueID *int64     `db:"redirected_from_queue_id" json:"redirectedFromQueueId"`
+	CreatedAt             *time.Time `db:"created_at" json:"createdAt"`
+	ServedAt              *time.Time `db:"served_at" json:"servedAt"`
 }
 
 // CustomersRepo defines methods for executing business rules
 // on customers in the database
 type CustomersRepo struct {
-	db *sqlx.DB
+	db *portableDB
 }
 
 // NewCustomersRepo returns a pointer to a CustomersRepo
 func NewCustomersRepo(db *sqlx.DB) *CustomersRepo {
-	return &CustomersRepo{db}
+	return &CustomersRepo{portable(db)}
+}
+
+const (
+	createCustomerQuery = "INSERT INTO customers (branch_id, msisdn, ticket, queue_id, redirected_from_queue_id) VALUES (?, ?, ?, ?, ?)"
+
+	countUnservedByMsisdnQuery = "SELECT COUNT(*) AS in_branch, COALESCE(SUM(CASE WHEN c.queue_id = ? THEN 1 ELSE 0 END), 0) AS in_queue FROM customers AS c INNER JOIN queues AS q ON q.id = c.queue_id WHERE c.served_at IS NULL AND c.msisdn = ? AND c.branch_id = ? AND c.created_at >= ? AND q.status <> 'archived'"
+)
+
+// unservedCounts holds the unserved tickets a phone number
+// holds in a branch and in one of its queues
+type unservedCounts struct {
+	InBranch int `db:"in_branch"`
+	InQueue  int `db:"in_queue"`
 }
 
 // Create saves a customer into the database
-func (repo *CustomersRepo) Create(c *Customer) (*Customer, error) {
-	query := "INSERT INTO customers (msisdn, ticket, queue_id) VALUES (?, ?, ?)"
+func (repo *CustomersRepo) Create(ctx context.Context, c *Customer) (*Customer, error) {
+	id, err := repo.db.insert(ctx, createCustomerQuery, c.BranchID, c.Msisdn, c.Ticket, c.QueueID, c.RedirectedFromQueueID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ID = id
+	return c, nil
+}
+
+// CreateWithinLimit saves a customer as Create does once allow has
+// approved the unserved tickets their phone number holds, counted as
+// CountUnservedByMsisdn counts them in queueID. Counting and saving
+// happen in one transaction holding the row of the branch, so that
+// joins at the same time are counted one after the other; the rows of
+// the number alone cannot be locked before its first ticket exists.
+// The error of allow is returned as is
+func (repo *CustomersRepo) CreateWithinLimit(ctx context.Context, c *Customer, queueID int64, since time.Time, allow func(inBranch, inQueue int) error) (*Customer, error) {
+	tx, err := repo.db.Beginx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(ctx, "UPDATE branches SET name = name WHERE id = ?", c.BranchID)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts unservedCounts
+	err = tx.Get(ctx, &counts, countUnservedByMsisdnQuery, queueID, c.Msisdn, c.BranchID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
 
-	res, err := repo.db.Exec(query, c.Msisdn, c.Ticket, c.QueueID)
+	err = allow(counts.InBranch, counts.InQueue)
 	if err != nil {
 		return nil, err
 	}
 
-	id, err := res.LastInsertId()
+	id, err := tx.insert(ctx, createCustomerQuery, c.BranchID, c.Msisdn, c.Ticket, c.QueueID, c.RedirectedFromQueueID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
@@ -46,11 +101,11 @@ func (repo *CustomersRepo) Create(c *Customer) (*Customer, error) {
 }
 
 // GetAll fetches and return all customers from the database
-func (repo *CustomersRepo) GetAll() ([]*Customer, error) {
+func (repo *CustomersRepo) GetAll(ctx context.Context) ([]*Customer, error) {
 	query := "SELECT c.* FROM customers AS c"
 
 	var customers []*Customer
-	err := repo.db.Select(&customers, query)
+	err := repo.db.Select(ctx, &customers, query)
 	if err != nil {
 		return nil, err
 	}
@@ -60,11 +115,25 @@ func (repo *CustomersRepo) GetAll() ([]*Customer, error) {
 
 // GetUnserved fetches and return all customers from the database
 // that have not been served yet
-func (repo *CustomersRepo) GetUnserved() ([]*Customer, error) {
+func (repo *CustomersRepo) GetUnserved(ctx context.Context) ([]*Customer, error) {
 	query := "SELECT c.* FROM customers AS c WHERE c.served_at IS NULL"
 
 	var customers []*Customer
-	err := repo.db.Select(&customers, query)
+	err := repo.db.Select(ctx, &customers, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return customers, nil
+}
+
+// GetUnservedInBranch fetches and return all customers of
+// a branch that have not been served yet
+func (repo *CustomersRepo) GetUnservedInBranch(ctx context.Context, branchID int64) ([]*Customer, error) {
+	query := "SELECT c.* FROM customers AS c WHERE c.served_at IS NULL AND c.branch_id = ?"
+
+	var customers []*Customer
+	err := repo.db.Select(ctx, &customers, query, branchID)
 	if err != nil {
 		return nil, err
 	}
@@ -72,11 +141,179 @@ func (repo *CustomersRepo) GetUnserved() ([]*Customer, error) {
 	return customers, nil
 }
 
+// CountUnservedByMsisdn returns how many unserved tickets a phone
+// number holds in a branch, and how many of those are in a queue.
+// Only tickets issued since 'since' on queues that are not archived
+// are counted, as the others are no longer waiting to be served
+func (repo *CustomersRepo) CountUnservedByMsisdn(ctx context.Context, msisdn string, branchID, queueID int64, since time.Time) (int, int, error) {
+	var counts unservedCounts
+	err := repo.db.Get(ctx, &counts, countUnservedByMsisdnQuery, queueID, msisdn, branchID, since.UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return counts.InBranch, counts.InQueue, nil
+}
+
 // MarkAsServed marks a customer as served in the database
-func (repo *CustomersRepo) MarkAsServed(custID int) error {
-	query := "UPDATE customers SET served_at = NOW() WHERE id = ?"
+func (repo *CustomersRepo) MarkAsServed(ctx context.Context, custID int) error {
+	query := "UPDATE customers SET served_at = CURRENT_TIMESTAMP WHERE id = ?"
 
-	_, err := repo.db.Exec(query, custID)
+	_, err := repo.db.Exec(ctx, query, custID)
 
 	return err
 }
+
+// Delete removes a customer from the database
+func (repo *CustomersRepo) Delete(ctx context.Context, id int64) error {
+	query := "DELETE FROM customers WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, id)
+	return err
+}
+
+// ServiceEvent models a single event in the lifecycle of a
+// customer's ticket, either when it was issued or when the
+// customer was served
+type ServiceEvent struct {
+	CustomerID int64      `db:"customer_id" json:"customerId"`
+	BranchID   int64      `db:"branch_id" json:"branchId"`
+	QueueID    int64      `db:"queue_id" json:"queueId"`
+	Msisdn     string     `db:"msisdn" json:"msisdn"`
+	Ticket     string     `db:"ticket" json:"ticket"`
+	Event      string     `db:"event" json:"event"`
+	OccurredAt *time.Time `db:"occurred_at" json:"occurredAt"`
+}
+
+// Export streams customers matching the given filter to fn, one
+// row at a time, in the order they joined their queues.
+// Iteration stops at the first error returned by fn
+func (repo *CustomersRepo) Export(ctx context.Context, f ExportFilter, fn func(*Customer) error) error {
+	where, args := f.where("c.branch_id", "c.queue_id", "c.created_at")
+	query := "SELECT c.* FROM customers AS c" + where + " ORDER BY c.id"
+
+	rows, err := repo.db.Queryx(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := new(Customer)
+		if err := rows.StructScan(c); err != nil {
+			return err
+		}
+
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportEvents streams the issued and served events of customers
+// matching the given filter to fn, one row at a time, in the
+// order they occurred
+func (repo *CustomersRepo) ExportEvents(ctx context.Context, f ExportFilter, fn func(*ServiceEvent) error) error {
+	issuedWhere, issuedArgs := f.where("c.branch_id", "c.queue_id", "c.created_at")
+	servedWhere, servedArgs := f.where("c.branch_id", "c.queue_id", "c.served_at")
+	if servedWhere == "" {
+		servedWhere = " WHERE c.served_at IS NOT NULL"
+	} else {
+		servedWhere += " AND c.served_at IS NOT NULL"
+	}
+
+	query := "SELECT c.id AS customer_id, c.branch_id, c.queue_id, c.msisdn, c.ticket, 'issued' AS event, c.created_at AS occurred_at FROM customers AS c" + issuedWhere +
+		" UNION ALL SELECT c.id AS customer_id, c.branch_id, c.queue_id, c.msisdn, c.ticket, 'served' AS event, c.served_at AS occurred_at FROM customers AS c" + servedWhere +
+		" ORDER BY occurred_at, customer_id"
+
+	rows, err := repo.db.Queryx(ctx, query, append(issuedArgs, servedArgs...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := new(ServiceEvent)
+		if err := rows.StructScan(e); err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// CustomerFilter restricts the customers returned by List.
+// Zero values are ignored
+type CustomerFilter struct {
+	BranchID int64
+	QueueID  int64
+	Served   *bool
+	Msisdn   string
+	From     *time.Time
+	To       *time.Time
+}
+
+// List fetches a page of customers matching the given filter.
+// The returned flag reports whether there are more customers
+// after the page
+func (repo *CustomersRepo) List(ctx context.Context, f CustomerFilter, p Page) ([]*Customer, bool, error) {
+	q := newListQuery("customers", "c")
+	if f.BranchID != 0 {
+		q.where("c.branch_id = ?", f.BranchID)
+	}
+	if f.QueueID != 0 {
+		q.where("c.queue_id = ?", f.QueueID)
+	}
+	if f.Served != nil {
+		if *f.Served {
+			q.where("c.served_at IS NOT NULL")
+		} else {
+			q.where("c.served_at IS NULL")
+		}
+	}
+	if f.Msisdn != "" {
+		q.where("c.msisdn = ?", f.Msisdn)
+	}
+	if f.From != nil {
+		q.where("c.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q.where("c.created_at < ?", *f.To)
+	}
+
+	query, args, err := q.build(p)
+	if err != nil {
+		return nil, false, err
+	}
+
+	customers := []*Customer{}
+	err = repo.db.Select(ctx, &customers, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(customers) > p.limit() {
+		return customers[:p.limit()], true, nil
+	}
+
+	return customers, false, nil
+}
+
+// Get fetches and returns a customer by id
+func (repo *CustomersRepo) Get(ctx context.Context, id int64) (*Customer, error) {
+	query := "SELECT c.* FROM customers AS c WHERE c.id = ?"
+
+	c := new(Customer)
+	err := repo.db.Get(ctx, c, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -10,7 +12,7 @@ import (
 )
 
 func TestCreateCustomer_ShouldPass(t *testing.T) {
-	query := `^INSERT INTO customers \(msisdn, ticket, queue_id\) VALUES \(\?, \?, \?\)$`
+	query := `^INSERT INTO customers \(branch_id, msisdn, ticket, queue_id, redirected_from_queue_id\) VALUES \(\?, \?, \?, \?, \?\)$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -18,20 +20,22 @@ func TestCreateCustomer_ShouldPass(t *testing.T) {
 	}
 	defer db.Close()
 
-	c := &Customer{Msisdn: "+233200662782", Ticket: "A201", QueueID: 1}
+	c := &Customer{BranchID: 1, Msisdn: "+233200662782", Ticket: "A201", QueueID: 1}
 
 	mock.ExpectExec(query).
 		WithArgs(
+			c.BranchID,
 			c.Msisdn,
 			c.Ticket,
 			c.QueueID,
+			c.RedirectedFromQueueID,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	customersRepo := NewCustomersRepo(dbMock)
 
-	saved, err := customersRepo.Create(c)
+	saved, err := customersRepo.Create(context.Background(), c)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -47,7 +51,7 @@ func TestCreateCustomer_ShouldPass(t *testing.T) {
 }
 
 func TestCreateCustomer_ShouldFail(t *testing.T) {
-	query := `^INSERT INTO customers \(msisdn, ticket, queue_id\) VALUES \(\?, \?, \?\)$`
+	query := `^INSERT INTO customers \(branch_id, msisdn, ticket, queue_id, redirected_from_queue_id\) VALUES \(\?, \?, \?, \?, \?\)$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -55,20 +59,22 @@ func TestCreateCustomer_ShouldFail(t *testing.T) {
 	}
 	defer db.Close()
 
-	c := &Customer{Msisdn: "+233200662782", Ticket: "A201", QueueID: 1}
+	c := &Customer{BranchID: 1, Msisdn: "+233200662782", Ticket: "A201", QueueID: 1}
 
 	mock.ExpectExec(query).
 		WithArgs(
+			c.BranchID,
 			c.Msisdn,
 			c.Ticket,
 			c.QueueID,
+			c.RedirectedFromQueueID,
 		).
 		WillReturnError(fmt.Errorf("db error"))
 
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	customersRepo := NewCustomersRepo(dbMock)
 
-	saved, err := customersRepo.Create(c)
+	saved, err := customersRepo.Create(context.Background(), c)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -103,7 +109,7 @@ func TestGetAllCustomer_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewCustomersRepo(dbMock)
 
-	customers, err := repo.GetAll()
+	customers, err := repo.GetAll(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -134,7 +140,7 @@ func TestGetAllCustomer_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewCustomersRepo(dbMock)
 
-	customers, err := repo.GetAll()
+	customers, err := repo.GetAll(context.Background())
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -169,7 +175,7 @@ func TestGetAllCustomerUnserved_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewCustomersRepo(dbMock)
 
-	customers, err := repo.GetUnserved()
+	customers, err := repo.GetUnserved(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -200,7 +206,7 @@ func TestGetAllCustomerUnserved_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewCustomersRepo(dbMock)
 
-	customers, err := repo.GetUnserved()
+	customers, err := repo.GetUnserved(context.Background())
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -216,7 +222,7 @@ func TestGetAllCustomerUnserved_ShouldFail(t *testing.T) {
 }
 
 func TestMarkAsServedCustomer_ShouldPass(t *testing.T) {
-	query := `^UPDATE customers SET served_at = NOW\(\) WHERE id = \?$`
+	query := `^UPDATE customers SET served_at = CURRENT_TIMESTAMP WHERE id = \?$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -235,7 +241,7 @@ func TestMarkAsServedCustomer_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	customersRepo := NewCustomersRepo(dbMock)
 
-	err = customersRepo.MarkAsServed(custID)
+	err = customersRepo.MarkAsServed(context.Background(), custID)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -247,7 +253,7 @@ func TestMarkAsServedCustomer_ShouldPass(t *testing.T) {
 }
 
 func TestMarkAsServedCustomer_ShouldFail(t *testing.T) {
-	query := `^UPDATE customers SET served_at = NOW\(\) WHERE id = \?$`
+	query := `^UPDATE customers SET served_at = CURRENT_TIMESTAMP WHERE id = \?$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -266,7 +272,7 @@ func TestMarkAsServedCustomer_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	customersRepo := NewCustomersRepo(dbMock)
 
-	err = customersRepo.MarkAsServed(custID)
+	err = customersRepo.MarkAsServed(context.Background(), custID)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -276,3 +282,330 @@ func TestMarkAsServedCustomer_ShouldFail(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestExportCustomers_ShouldPass(t *testing.T) {
+	query := `^SELECT c.\* FROM customers AS c WHERE c.queue_id = \? AND c.created_at >= \? ORDER BY c.id$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	from := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	filter := ExportFilter{QueueID: 1, From: &from}
+
+	mock.ExpectQuery(query).WithArgs(filter.QueueID, from).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "msisdn", "ticket", "queue_id", "created_at", "served_at"}).
+			AddRow(1, "+233200662782", "A101", 1, time.Now(), time.Now()).
+			AddRow(2, "+233200662783", "A102", 1, time.Now(), nil),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	var exported []*Customer
+	err = repo.Export(context.Background(), filter, func(c *Customer) error {
+		exported = append(exported, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(exported) != 2 {
+		t.Fatalf("expected 2 customers, got %d", len(exported))
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportCustomers_ShouldFail(t *testing.T) {
+	query := `^SELECT c.\* FROM customers AS c ORDER BY c.id$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "msisdn", "ticket", "queue_id", "created_at", "served_at"}).
+			AddRow(1, "+233200662782", "A101", 1, time.Now(), time.Now()).
+			AddRow(2, "+233200662783", "A102", 1, time.Now(), nil),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	calls := 0
+	err = repo.Export(context.Background(), ExportFilter{}, func(c *Customer) error {
+		calls++
+		return fmt.Errorf("write error")
+	})
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected export to stop after 1 row, got %d", calls)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportServiceEvents_ShouldPass(t *testing.T) {
+	query := `^SELECT c.id AS customer_id, c.branch_id, c.queue_id, c.msisdn, c.ticket, 'issued' AS event, c.created_at AS occurred_at FROM customers AS c WHERE c.queue_id = \? ` +
+		`UNION ALL SELECT c.id AS customer_id, c.branch_id, c.queue_id, c.msisdn, c.ticket, 'served' AS event, c.served_at AS occurred_at FROM customers AS c WHERE c.queue_id = \? AND c.served_at IS NOT NULL ` +
+		`ORDER BY occurred_at, customer_id$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	filter := ExportFilter{QueueID: 1}
+
+	mock.ExpectQuery(query).WithArgs(filter.QueueID, filter.QueueID).WillReturnRows(
+		sqlmock.NewRows([]string{"customer_id", "branch_id", "queue_id", "msisdn", "ticket", "event", "occurred_at"}).
+			AddRow(1, 1, 1, "+233200662782", "A101", "issued", time.Now()).
+			AddRow(1, 1, 1, "+233200662782", "A101", "served", time.Now()),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	var events []*ServiceEvent
+	err = repo.ExportEvents(context.Background(), filter, func(e *ServiceEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListCustomers_ShouldPass(t *testing.T) {
+	query := `^SELECT c.\* FROM customers AS c WHERE c.queue_id = \? AND c.served_at IS NULL AND c.id > \? ORDER BY c.id ASC LIMIT \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	served := false
+	filter := CustomerFilter{QueueID: 1, Served: &served}
+	page := Page{After: 4, Limit: 2}
+
+	mock.ExpectQuery(query).WithArgs(filter.QueueID, page.After, page.Limit+1).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "msisdn", "ticket", "queue_id", "created_at", "served_at"}).
+			AddRow(5, "+233200662782", "A101", 1, time.Now(), nil).
+			AddRow(6, "+233200662783", "A102", 1, time.Now(), nil).
+			AddRow(7, "+233200662784", "A103", 1, time.Now(), nil),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	customers, hasMore, err := repo.List(context.Background(), filter, page)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(customers) != 2 {
+		t.Fatalf("expected 2 customers, got %d", len(customers))
+	}
+
+	if !hasMore {
+		t.Fatalf("expected more customers after page")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListCustomers_ShouldFail(t *testing.T) {
+	query := `^SELECT c.\* FROM customers AS c WHERE c.msisdn = \? ORDER BY c.id ASC LIMIT \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	filter := CustomerFilter{Msisdn: "+233200662782"}
+
+	mock.ExpectQuery(query).
+		WithArgs(filter.Msisdn, DefaultPageLimit+1).
+		WillReturnError(fmt.Errorf("db error"))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	customers, _, err := repo.List(context.Background(), filter, Page{})
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	if customers != nil {
+		t.Fatalf("expected nil , got %v", customers)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCountUnservedByMsisdn_ShouldPass(t *testing.T) {
+	since := time.Date(2020, 1, 6, 5, 0, 0, 0, time.UTC)
+	query := `^SELECT COUNT\(\*\) AS in_branch, COALESCE\(SUM\(CASE WHEN c.queue_id = \? THEN 1 ELSE 0 END\), 0\) AS in_queue FROM customers AS c INNER JOIN queues AS q ON q.id = c.queue_id WHERE c.served_at IS NULL AND c.msisdn = \? AND c.branch_id = \? AND c.created_at >= \? AND q.status <> 'archived'$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(query).
+		WithArgs(2, "+233200662782", 1, since).
+		WillReturnRows(sqlmock.NewRows([]string{"in_branch", "in_queue"}).AddRow(3, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	inBranch, inQueue, err := repo.CountUnservedByMsisdn(context.Background(), "+233200662782", 1, 2, since)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if inBranch != 3 || inQueue != 1 {
+		t.Fatalf("expected 3 tickets in branch and 1 in queue, got %d and %d", inBranch, inQueue)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateCustomerWithinLimit_ShouldPass(t *testing.T) {
+	since := time.Date(2020, 1, 6, 5, 0, 0, 0, time.UTC)
+	count := `^SELECT COUNT\(\*\) AS in_branch, .* FROM customers AS c INNER JOIN queues AS q ON q.id = c.queue_id WHERE .*$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE branches SET name = name WHERE id = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(count).
+		WithArgs(2, "+233200662782", 1, since).
+		WillReturnRows(sqlmock.NewRows([]string{"in_branch", "in_queue"}).AddRow(1, 0))
+	mock.ExpectExec(`^INSERT INTO customers \(branch_id, msisdn, ticket, queue_id, redirected_from_queue_id\) VALUES \(\?, \?, \?, \?, \?\)$`).
+		WithArgs(1, "+233200662782", "A001", 2, nil).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectCommit()
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	c, err := repo.CreateWithinLimit(context.Background(), &Customer{BranchID: 1, QueueID: 2, Msisdn: "+233200662782", Ticket: "A001"}, 2, since, func(inBranch, inQueue int) error {
+		if inBranch != 1 || inQueue != 0 {
+			t.Errorf("expected 1 ticket in branch and none in queue, got %d and %d", inBranch, inQueue)
+		}
+		return nil
+	})
+	if err != nil || c.ID != 9 {
+		t.Fatalf("expected customer 9 to be created, got %+v (%v)", c, err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateCustomerWithinLimit_ShouldFail(t *testing.T) {
+	since := time.Date(2020, 1, 6, 5, 0, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE branches SET name = name WHERE id = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) AS in_branch`).
+		WillReturnRows(sqlmock.NewRows([]string{"in_branch", "in_queue"}).AddRow(1, 1))
+	mock.ExpectRollback()
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	refused := errors.New("limit reached")
+	_, err = repo.CreateWithinLimit(context.Background(), &Customer{BranchID: 1, QueueID: 2, Msisdn: "+233200662782", Ticket: "A001"}, 2, since, func(inBranch, inQueue int) error {
+		return refused
+	})
+	if err != refused {
+		t.Fatalf("expected the error of allow, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteCustomer_ShouldPass(t *testing.T) {
+	query := `^DELETE FROM customers WHERE id = \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(query).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewCustomersRepo(dbMock)
+
+	err = repo.Delete(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Device kinds
+const (
+	DeviceKiosk   = "kiosk"
+	DeviceDisplay = "display"
+)
+
+// Device models a kiosk or display board of a branch in the db.
+// Devices authenticate with an API key, of which only the bcrypt
+// hash is stored. 'KeyPrefix' is the public part of the key used
+// to find the device a key belongs to
+type Device struct {
+	ID         int64      `db:"id" json:"id"`
+	BranchID   int64      `db:"branch_id" json:"branchId"`
+	Name       string     `db:"name" json:"name" validate:"required,max=255"`
+	Kind       string     `db:"kind" json:"kind" validate:"oneof=kiosk display"`
+	KeyPrefix  string     `db:"key_prefix" json:"keyPrefix"`
+	KeyHash    string     `db:"key_hash" json:"-"`
+	IsRevoked  bool       `db:"is_revoked" json:"isRevoked"`
+	LastSeenAt *time.Time `db:"last_seen_at" json:"lastSeenAt"`
+	LastSeenIP *string    `db:"last_seen_ip" json:"lastSeenIp"`
+	CreatedAt  *time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt  *time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// DevicesRepo defines methods for executing business rules
+// on devices
+type DevicesRepo struct {
+	db *portableDB
+}
+
+// NewDevicesRepo returns a pointer to a DevicesRepo
+func NewDevicesRepo(db *sqlx.DB) *DevicesRepo {
+	return &DevicesRepo{portable(db)}
+}
+
+// Create saves a device into the database
+func (repo *DevicesRepo) Create(ctx context.Context, d *Device) (*Device, error) {
+	query := "INSERT INTO devices (branch_id, name, kind, key_prefix, key_hash) VALUES (?, ?, ?, ?, ?)"
+
+	id, err := repo.db.insert(ctx, query, d.BranchID, d.Name, d.Kind, d.KeyPrefix, d.KeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	d.ID = id
+	return d, nil
+}
+
+// GetAll fetches and returns all devices of a branch, or
+// of every branch when branchID is zero
+func (repo *DevicesRepo) GetAll(ctx context.Context, branchID int64) ([]*Device, error) {
+	query := "SELECT d.* FROM devices AS d"
+	var args []interface{}
+	if branchID != 0 {
+		query += " WHERE d.branch_id = ?"
+		args = append(args, branchID)
+	}
+
+	devices := []*Device{}
+	err := repo.db.Select(ctx, &devices, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// Get fetches and returns a device by id
+func (repo *DevicesRepo) Get(ctx context.Context, id int64) (*Device, error) {
+	query := "SELECT d.* FROM devices AS d WHERE d.id = ?"
+
+	d := new(Device)
+	err := repo.db.Get(ctx, d, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// GetByKeyPrefix fetches and returns the device holding
+// the API key with the given prefix
+func (repo *DevicesRepo) GetByKeyPrefix(ctx context.Context, prefix string) (*Device, error) {
+	query := "SELECT d.* FROM devices AS d WHERE d.key_prefix = ?"
+
+	d := new(Device)
+	err := repo.db.Get(ctx, d, query, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// RotateKey replaces the API key of a device, which also
+// reinstates a revoked device
+func (repo *DevicesRepo) RotateKey(ctx context.Context, id int64, prefix, hash string) error {
+	query := "UPDATE devices SET key_prefix = ?, key_hash = ?, is_revoked = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, prefix, hash, id)
+	return err
+}
+
+// Revoke stops a device from authenticating with its API key
+func (repo *DevicesRepo) Revoke(ctx context.Context, id int64) error {
+	query := "UPDATE devices SET is_revoked = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, id)
+	return err
+}
+
+// Heartbeat records that a device was seen at the given address
+func (repo *DevicesRepo) Heartbeat(ctx context.Context, id int64, ip string) error {
+	query := "UPDATE devices SET last_seen_at = CURRENT_TIMESTAMP, last_seen_ip = ? WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, ip, id)
+	return err
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestCreateDevice_ShouldPass(t *testing.T) {
+	query := `^INSERT INTO devices \(branch_id, name, kind, key_prefix, key_hash\) VALUES \(\?, \?, \?, \?, \?\)$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	d := &Device{BranchID: 1, Name: "Entrance kiosk", Kind: DeviceKiosk, KeyPrefix: "a1b2c3d4e5f6", KeyHash: "hash"}
+
+	mock.ExpectExec(query).
+		WithArgs(d.BranchID, d.Name, d.Kind, d.KeyPrefix, d.KeyHash).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewDevicesRepo(dbMock)
+
+	saved, err := repo.Create(context.Background(), d)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved.ID != 2 {
+		t.Fatalf("expected id 2, got %d", saved.ID)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRotateDeviceKey_ShouldPass(t *testing.T) {
+	query := `^UPDATE devices SET key_prefix = \?, key_hash = \?, is_revoked = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(query).
+		WithArgs("f6e5d4c3b2a1", "newhash", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewDevicesRepo(dbMock)
+
+	err = repo.RotateKey(context.Background(), 2, "f6e5d4c3b2a1", "newhash")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
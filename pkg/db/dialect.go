@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// QueryTimeout bounds each statement the repositories run, on top
+// of any deadline of the context it runs with, so that a slow query
+// cannot hold a connection indefinitely. Set it before using the
+// repositories; zero leaves statements unbounded
+var QueryTimeout = 10 * time.Second
+
+// withTimeout returns ctx bounded by QueryTimeout
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, QueryTimeout)
+}
+
+// The repositories write their SQL once, the way MySQL reads it:
+// ? placeholders, CURRENT_TIMESTAMP for the time now and ids read
+// back after an INSERT. portableDB and portableTx carry that SQL
+// to the database they run on, rebinding placeholders to $1, $2...
+// for Postgres. Only the methods below rebind; the repositories
+// must not use the other methods of sqlx.DB and sqlx.Tx
+
+// portableDB runs the statements of the repositories
+type portableDB struct {
+	*sqlx.DB
+}
+
+func portable(db *sqlx.DB) *portableDB {
+	return &portableDB{db}
+}
+
+func (db *portableDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.DB.ExecContext(ctx, db.Rebind(query), args...)
+}
+
+func (db *portableDB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.DB.GetContext(ctx, dest, db.Rebind(query), args...)
+}
+
+func (db *portableDB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.DB.SelectContext(ctx, dest, db.Rebind(query), args...)
+}
+
+// Queryx is not bounded by QueryTimeout, as its rows are
+// streamed for as long as the caller reads them
+func (db *portableDB) Queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return db.DB.QueryxContext(ctx, db.Rebind(query), args...)
+}
+
+// Beginx starts a transaction that is rolled back if ctx is done
+// before it commits. Its statements are bounded by QueryTimeout
+func (db *portableDB) Beginx(ctx context.Context) (*portableTx, error) {
+	tx, err := db.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &portableTx{tx}, nil
+}
+
+// insert runs an INSERT and returns the id of the new row
+func (db *portableDB) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return insert(ctx, db, query, args...)
+}
+
+// portableTx runs the statements of the repositories in a transaction
+type portableTx struct {
+	*sqlx.Tx
+}
+
+func (tx *portableTx) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return tx.Tx.ExecContext(ctx, tx.Rebind(query), args...)
+}
+
+func (tx *portableTx) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return tx.Tx.GetContext(ctx, dest, tx.Rebind(query), args...)
+}
+
+// insert runs an INSERT and returns the id of the new row
+func (tx *portableTx) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return insert(ctx, tx, query, args...)
+}
+
+type inserter interface {
+	DriverName() string
+	Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// insert runs an INSERT on e. Postgres drivers do not report the
+// id of the last row inserted, so the id is returned by the
+// statement instead
+func insert(ctx context.Context, e inserter, query string, args ...interface{}) (int64, error) {
+	var id int64
+	if e.DriverName() == Postgres {
+		err := e.Get(ctx, &id, query+" RETURNING id", args...)
+		return id, err
+	}
+
+	res, err := e.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestCreateQueue_Postgres(t *testing.T) {
+	query := `^INSERT INTO queues \(branch_id, name, description, status, max_length, max_wait_minutes, overflow_queue_id\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7\) RETURNING id$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	q := &Queue{BranchID: 1, Name: "testqueue", Description: "test queue description"}
+
+	mock.ExpectQuery(query).
+		WithArgs(q.BranchID, q.Name, q.Description, q.Status, q.MaxLength, q.MaxWaitMinutes, q.OverflowQueueID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	saved, err := NewQueuesRepo(sqlx.NewDb(db, Postgres)).Create(context.Background(), q)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved.ID != 7 {
+		t.Errorf("expected id 7, got %d", saved.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMarkAsServed_Postgres(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE customers SET served_at = CURRENT_TIMESTAMP WHERE id = \$1$`).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := NewCustomersRepo(sqlx.NewDb(db, Postgres)).MarkAsServed(context.Background(), 3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	defer func(timeout time.Duration) { QueryTimeout = timeout }(QueryTimeout)
+	QueryTimeout = 10 * time.Millisecond
+
+	mock.ExpectExec(`^UPDATE customers SET served_at = CURRENT_TIMESTAMP WHERE id = \?$`).
+		WithArgs(3).
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	start := time.Now()
+	err = NewCustomersRepo(sqlx.NewDb(db, "sqlmock")).MarkAsServed(context.Background(), 3)
+	if err == nil {
+		t.Fatalf("expected the statement to time out")
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected the statement to be abandoned after %v, took %v", QueryTimeout, elapsed)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = NewQueuesRepo(sqlx.NewDb(db, "sqlmock")).Get(ctx, 1)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// MySQL error numbers the API reports to clients
+const (
+	mysqlDuplicateEntry  = 1062
+	mysqlRowIsReferenced = 1451
+	mysqlNoReferencedRow = 1452
+)
+
+// Postgres error codes the API reports to clients
+const (
+	postgresUniqueViolation     = "23505"
+	postgresForeignKeyViolation = "23503"
+)
+
+// Constraints a write can break
+const (
+	uniqueConstraint = iota + 1
+	missingReferenceConstraint
+	referencedConstraint
+)
+
+// constraintCheckers tell which constraint, if any, an error
+// returned by a driver reports breaking. Drivers that need cgo
+// add theirs when built with it
+var constraintCheckers = []func(err error) []int{mysqlConstraint, postgresConstraint}
+
+func mysqlConstraint(err error) []int {
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) {
+		return nil
+	}
+
+	switch me.Number {
+	case mysqlDuplicateEntry:
+		return []int{uniqueConstraint}
+	case mysqlNoReferencedRow:
+		return []int{missingReferenceConstraint}
+	case mysqlRowIsReferenced:
+		return []int{referencedConstraint}
+	}
+
+	return nil
+}
+
+// postgresConstraint tells the sides of a broken foreign key apart
+// by its detail, as Postgres reports both with the same code
+func postgresConstraint(err error) []int {
+	var pe *pq.Error
+	if !errors.As(err, &pe) {
+		return nil
+	}
+
+	switch pe.Code {
+	case postgresUniqueViolation:
+		return []int{uniqueConstraint}
+	case postgresForeignKeyViolation:
+		if strings.Contains(pe.Detail, "is still referenced") {
+			return []int{referencedConstraint}
+		}
+		return []int{missingReferenceConstraint}
+	}
+
+	return nil
+}
+
+func breaks(err error, constraint int) bool {
+	for _, check := range constraintCheckers {
+		for _, c := range check(err) {
+			if c == constraint {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsDuplicateKey returns true if err was caused by a write
+// breaking a unique index, such as a second queue with the
+// same name in a branch
+func IsDuplicateKey(err error) bool {
+	return breaks(err, uniqueConstraint)
+}
+
+// IsMissingReference returns true if err was caused by a write
+// referring to a row that does not exist
+func IsMissingReference(err error) bool {
+	return breaks(err, missingReferenceConstraint)
+}
+
+// IsReferenced returns true if err was caused by deleting
+// a row other rows still refer to
+func IsReferenced(err error) bool {
+	return breaks(err, referencedConstraint)
+}
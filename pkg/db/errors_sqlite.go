@@ -0,0 +1,33 @@
+//go:build cgo
+// +build cgo
+
+package db
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	constraintCheckers = append(constraintCheckers, sqliteConstraint)
+}
+
+// sqliteConstraint reports broken foreign keys as both a missing
+// and a referenced row, as SQLite does not say which side of the
+// key a write broke
+func sqliteConstraint(err error) []int {
+	var se sqlite3.Error
+	if !errors.As(err, &se) {
+		return nil
+	}
+
+	switch se.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return []int{uniqueConstraint}
+	case sqlite3.ErrConstraintForeignKey:
+		return []int{missingReferenceConstraint, referencedConstraint}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsDuplicateKey(t *testing.T) {
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-Tellers' for key 'queues_branch_name_index'"}
+
+	if !IsDuplicateKey(duplicate) {
+		t.Fatalf("expected %v to be a duplicate key error", duplicate)
+	}
+
+	if !IsDuplicateKey(fmt.Errorf("failed creating queue: %w", duplicate)) {
+		t.Fatalf("expected wrapped error to be a duplicate key error")
+	}
+
+	if IsDuplicateKey(&mysql.MySQLError{Number: 1452}) || IsDuplicateKey(fmt.Errorf("db error")) {
+		t.Fatalf("expected other errors not to be duplicate key errors")
+	}
+}
+
+func TestIsMissingReference(t *testing.T) {
+	if !IsMissingReference(&mysql.MySQLError{Number: 1452}) {
+		t.Fatalf("expected 1452 to be a missing reference")
+	}
+
+	if IsMissingReference(&mysql.MySQLError{Number: 1451}) {
+		t.Fatalf("expected 1451 not to be a missing reference")
+	}
+}
+
+func TestPostgresConstraints(t *testing.T) {
+	if !IsDuplicateKey(&pq.Error{Code: "23505"}) {
+		t.Fatalf("expected 23505 to be a duplicate key error")
+	}
+
+	missing := &pq.Error{Code: "23503", Detail: `Key (queue_id)=(42) is not present in table "queues".`}
+	if !IsMissingReference(missing) || IsReferenced(missing) {
+		t.Fatalf("expected %q to be a missing reference only", missing.Detail)
+	}
+
+	referenced := &pq.Error{Code: "23503", Detail: `Key (id)=(1) is still referenced from table "customers".`}
+	if !IsReferenced(referenced) || IsMissingReference(referenced) {
+		t.Fatalf("expected %q to be a referenced row only", referenced.Detail)
+	}
+}
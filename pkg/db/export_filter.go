@@ -0,0 +1,49 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// ExportFilter restricts the rows streamed by the Export
+// methods of the repositories. Zero values are ignored
+type ExportFilter struct {
+	BranchID int64
+	QueueID  int64
+	From     *time.Time
+	To       *time.Time
+}
+
+// where builds a WHERE clause and its arguments for the filter
+// using the given branch, queue and timestamp columns. The range
+// is inclusive of From and exclusive of To
+func (f ExportFilter) where(branchColumn, queueColumn, timeColumn string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.BranchID != 0 {
+		conditions = append(conditions, branchColumn+" = ?")
+		args = append(args, f.BranchID)
+	}
+
+	if f.QueueID != 0 {
+		conditions = append(conditions, queueColumn+" = ?")
+		args = append(args, f.QueueID)
+	}
+
+	if f.From != nil {
+		conditions = append(conditions, timeColumn+" >= ?")
+		args = append(args, *f.From)
+	}
+
+	if f.To != nil {
+		conditions = append(conditions, timeColumn+" < ?")
+		args = append(args, *f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// IdempotencyRecord models an Idempotency-Key presented by a client
+// in the db. 'Scope' identifies the client so keys of different
+// clients never collide, and 'RequestHash' is a digest of the request
+// the key was first used with. The response is empty until the
+// request holding the key has completed
+type IdempotencyRecord struct {
+	ID           int64      `db:"id"`
+	Scope        string     `db:"scope"`
+	Key          string     `db:"idempotency_key"`
+	RequestHash  string     `db:"request_hash"`
+	StatusCode   *int       `db:"status_code"`
+	ContentType  *string    `db:"content_type"`
+	ResponseBody []byte     `db:"response_body"`
+	CreatedAt    *time.Time `db:"created_at"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+}
+
+// IsComplete returns true if the response to the request
+// holding the key has been stored
+func (rec *IdempotencyRecord) IsComplete() bool {
+	return rec.StatusCode != nil
+}
+
+// IdempotencyRepo defines methods for executing business rules
+// on idempotency keys
+type IdempotencyRepo struct {
+	db *portableDB
+}
+
+// NewIdempotencyRepo returns a pointer to an IdempotencyRepo
+func NewIdempotencyRepo(db *sqlx.DB) *IdempotencyRepo {
+	return &IdempotencyRepo{portable(db)}
+}
+
+// Reserve saves a key before its request is processed. Reserving a
+// key already held in the same scope fails with a duplicate key
+// error, which is what stops concurrent retries running twice
+func (repo *IdempotencyRepo) Reserve(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	query := "INSERT INTO idempotency_keys (scope, idempotency_key, request_hash, expires_at) VALUES (?, ?, ?, ?)"
+
+	id, err := repo.db.insert(ctx, query, rec.Scope, rec.Key, rec.RequestHash, rec.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.ID = id
+	return rec, nil
+}
+
+// Get fetches and returns a key held in a scope
+func (repo *IdempotencyRepo) Get(ctx context.Context, scope, key string) (*IdempotencyRecord, error) {
+	query := "SELECT k.* FROM idempotency_keys AS k WHERE k.scope = ? AND k.idempotency_key = ?"
+
+	rec := new(IdempotencyRecord)
+	err := repo.db.Get(ctx, rec, query, scope, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// Complete stores the response to the request holding a key
+func (repo *IdempotencyRepo) Complete(ctx context.Context, id int64, statusCode int, contentType string, body []byte) error {
+	query := "UPDATE idempotency_keys SET status_code = ?, content_type = ?, response_body = ? WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, statusCode, contentType, body, id)
+	return err
+}
+
+// Release deletes a key so it can be used again
+func (repo *IdempotencyRepo) Release(ctx context.Context, id int64) error {
+	query := "DELETE FROM idempotency_keys WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, id)
+	return err
+}
+
+// DeleteExpired deletes keys that expired before now and
+// returns how many were deleted
+func (repo *IdempotencyRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := "DELETE FROM idempotency_keys WHERE expires_at <= ?"
+
+	res, err := repo.db.Exec(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestReserveIdempotencyKey_ShouldPass(t *testing.T) {
+	query := `^INSERT INTO idempotency_keys \(scope, idempotency_key, request_hash, expires_at\) VALUES \(\?, \?, \?, \?\)$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rec := &IdempotencyRecord{Scope: "device:1", Key: "3f1c", RequestHash: "abc", ExpiresAt: time.Date(2020, 1, 2, 9, 0, 0, 0, time.UTC)}
+
+	mock.ExpectExec(query).
+		WithArgs(rec.Scope, rec.Key, rec.RequestHash, rec.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewIdempotencyRepo(dbMock)
+
+	saved, err := repo.Reserve(context.Background(), rec)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved.ID != 4 {
+		t.Fatalf("expected id 4, got %d", saved.ID)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteExpiredIdempotencyKeys_ShouldPass(t *testing.T) {
+	query := `^DELETE FROM idempotency_keys WHERE expires_at <= \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2020, 1, 2, 9, 0, 0, 0, time.UTC)
+	mock.ExpectExec(query).
+		WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewIdempotencyRepo(dbMock)
+
+	n, err := repo.DeleteExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n != 3 {
+		t.Fatalf("expected 3 keys deleted, got %d", n)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
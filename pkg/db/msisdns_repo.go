@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Tables holding customers' phone numbers
+const (
+	CustomersTable    = "customers"
+	AppointmentsTable = "appointments"
+)
+
+// MsisdnRecord is the phone number stored on a row of a table
+type MsisdnRecord struct {
+	ID     int64  `db:"id"`
+	Msisdn string `db:"msisdn"`
+}
+
+// MsisdnsRepo defines methods for rewriting the phone
+// numbers stored in a table
+type MsisdnsRepo struct {
+	db    *portableDB
+	table string
+}
+
+// NewMsisdnsRepo returns a pointer to a MsisdnsRepo for
+// CustomersTable or AppointmentsTable
+func NewMsisdnsRepo(db *sqlx.DB, table string) (*MsisdnsRepo, error) {
+	if table != CustomersTable && table != AppointmentsTable {
+		return nil, fmt.Errorf("table %q has no msisdn column", table)
+	}
+
+	return &MsisdnsRepo{portable(db), table}, nil
+}
+
+// Next fetches up to limit phone numbers from rows with
+// ids greater than afterID, in order of id
+func (repo *MsisdnsRepo) Next(ctx context.Context, afterID int64, limit int) ([]*MsisdnRecord, error) {
+	query := fmt.Sprintf("SELECT id, msisdn FROM %s WHERE id > ? ORDER BY id LIMIT ?", repo.table)
+
+	records := []*MsisdnRecord{}
+	err := repo.db.Select(ctx, &records, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Update replaces the phone number stored on a row
+func (repo *MsisdnsRepo) Update(ctx context.Context, id int64, msisdn string) error {
+	query := fmt.Sprintf("UPDATE %s SET msisdn = ? WHERE id = ?", repo.table)
+
+	_, err := repo.db.Exec(ctx, query, msisdn, id)
+	return err
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestNewMsisdnsRepo_ShouldFail(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	_, err = NewMsisdnsRepo(sqlx.NewDb(db, "sqlmock"), "users")
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestNextMsisdns_ShouldPass(t *testing.T) {
+	query := `^SELECT id, msisdn FROM customers WHERE id > \? ORDER BY id LIMIT \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "msisdn"}).
+		AddRow(11, "0200662782").
+		AddRow(12, "+233200662782")
+	mock.ExpectQuery(query).WithArgs(10, 2).WillReturnRows(rows)
+
+	repo, err := NewMsisdnsRepo(sqlx.NewDb(db, "sqlmock"), CustomersTable)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	records, err := repo.Next(context.Background(), 10, 2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(records) != 2 || records[0].ID != 11 || records[0].Msisdn != "0200662782" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultPageLimit is the number of rows returned when
+	// a page does not specify a limit
+	DefaultPageLimit = 50
+
+	// MaxPageLimit is the largest number of rows that can be
+	// fetched in a single page
+	MaxPageLimit = 500
+)
+
+// Page describes a window of rows to fetch using keyset pagination.
+// After is the id of the last row of the previous page and acts as
+// the cursor; a zero value starts from the first row. Sort must be a
+// column name that has been whitelisted by the repository
+type Page struct {
+	After int64
+	Limit int
+	Sort  string
+	Desc  bool
+}
+
+// limit returns the effective number of rows for the page
+func (p Page) limit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+
+	return p.Limit
+}
+
+// listQuery accumulates the conditions of a filtered and
+// paginated SELECT statement
+type listQuery struct {
+	table      string
+	alias      string
+	conditions []string
+	args       []interface{}
+}
+
+func newListQuery(table, alias string) *listQuery {
+	return &listQuery{table: table, alias: alias}
+}
+
+// where adds a condition to the query
+func (q *listQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+// build returns the SQL and arguments for fetching the given page.
+// One row more than the page limit is requested so callers can tell
+// whether there are more rows after the page
+func (q *listQuery) build(p Page) (string, []interface{}, error) {
+	sort := p.Sort
+	if sort == "" {
+		sort = "id"
+	}
+
+	for _, c := range sort {
+		if !(c == '_' || (c >= 'a' && c <= 'z')) {
+			return "", nil, fmt.Errorf("invalid sort column %q", sort)
+		}
+	}
+
+	direction, comparison := "ASC", ">"
+	if p.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := q.conditions
+	args := q.args
+	if p.After != 0 {
+		if sort == "id" {
+			conditions = append(conditions, fmt.Sprintf("%s.id %s ?", q.alias, comparison))
+		} else {
+			conditions = append(conditions, fmt.Sprintf(
+				"(%s.%s, %s.id) %s (SELECT %s, id FROM %s WHERE id = ?)",
+				q.alias, sort, q.alias, comparison, sort, q.table,
+			))
+		}
+		args = append(args, p.After)
+	}
+
+	query := fmt.Sprintf("SELECT %s.* FROM %s AS %s", q.alias, q.table, q.alias)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s.%s %s", q.alias, sort, direction)
+	if sort != "id" {
+		query += fmt.Sprintf(", %s.id %s", q.alias, direction)
+	}
+
+	query += " LIMIT ?"
+	args = append(args, p.limit()+1)
+
+	return query, args, nil
+}
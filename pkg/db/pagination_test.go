@@ -0,0 +1,68 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListQueryBuild(t *testing.T) {
+	testCases := []struct {
+		tag        string
+		conditions []string
+		args       []interface{}
+		page       Page
+		query      string
+		queryArgs  []interface{}
+	}{
+		{
+			tag:       "first page",
+			page:      Page{},
+			query:     "SELECT c.* FROM customers AS c ORDER BY c.id ASC LIMIT ?",
+			queryArgs: []interface{}{DefaultPageLimit + 1},
+		},
+		{
+			tag:        "filtered page after cursor",
+			conditions: []string{"c.queue_id = ?"},
+			args:       []interface{}{int64(2)},
+			page:       Page{After: 10, Limit: 20},
+			query:      "SELECT c.* FROM customers AS c WHERE c.queue_id = ? AND c.id > ? ORDER BY c.id ASC LIMIT ?",
+			queryArgs:  []interface{}{int64(2), int64(10), 21},
+		},
+		{
+			tag:       "descending page sorted by column",
+			page:      Page{After: 10, Limit: 1000, Sort: "created_at", Desc: true},
+			query:     "SELECT c.* FROM customers AS c WHERE (c.created_at, c.id) < (SELECT created_at, id FROM customers WHERE id = ?) ORDER BY c.created_at DESC, c.id DESC LIMIT ?",
+			queryArgs: []interface{}{int64(10), MaxPageLimit + 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			q := newListQuery("customers", "c")
+			for i, condition := range tc.conditions {
+				q.where(condition, tc.args[i])
+			}
+
+			query, args, err := q.build(tc.page)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if query != tc.query {
+				t.Errorf("expected query %q, got %q", tc.query, query)
+			}
+
+			if !reflect.DeepEqual(args, tc.queryArgs) {
+				t.Errorf("expected args %v, got %v", tc.queryArgs, args)
+			}
+		})
+	}
+}
+
+func TestListQueryBuild_ShouldFail(t *testing.T) {
+	q := newListQuery("customers", "c")
+	_, _, err := q.build(Page{Sort: "id; DROP TABLE customers"})
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+}
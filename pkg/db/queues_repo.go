@@ -1,54 +1,63 @@
 package db
 
 import (
+	"context"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// Queue models a queue in the db
+// Queue models a queue in the db.
+// 'MaxLength' and 'MaxWaitMinutes' optionally limit how many
+// customers may wait on the queue, and how long a new customer
+// may be expected to wait. Customers who would exceed a limit are
+// sent to 'OverflowQueueID' when it is set, or turned away.
+// 'Status' moves the queue through its lifecycle, from open to
+// paused or draining and finally archived at 'ArchivedAt'
 type Queue struct {
-	ID          int64      `db:"id" json:"id"`
-	Name        string     `db:"name" json:"name"`
-	Description string     `db:"description" json:"description"`
-	IsActive    bool       `db:"is_active" json:"isActive"`
-	CreatedAt   *time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt   *time.Time `db:"updated_at" json:"updatedAt"`
+	ID              int64      `db:"id" json:"id"`
+	BranchID        int64      `db:"branch_id" json:"branchId"`
+	Name            string     `db:"name" json:"name" validate:"required,max=255"`
+	Description     string     `db:"description" json:"description" validate:"max=255"`
+	IsActive        bool       `db:"is_active" json:"isActive"`
+	Status          string     `db:"status" json:"status"`
+	MaxLength       *int       `db:"max_length" json:"maxLength" validate:"min=1"`
+	MaxWaitMinutes  *int       `db:"max_wait_minutes" json:"maxWaitMinutes" validate:"min=1"`
+	OverflowQueueID *int64     `db:"overflow_queue_id" json:"overflowQueueId"`
+	CreatedAt       *time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt       *time.Time `db:"updated_at" json:"updatedAt"`
+	ArchivedAt      *time.Time `db:"archived_at" json:"archivedAt"`
 }
 
 // QueuesRepo defines methods for executing business rules
 // on queues
 type QueuesRepo struct {
-	db *sqlx.DB
+	db *portableDB
 }
 
 // NewQueuesRepo returns a pointer to a QueuesRepo
 func NewQueuesRepo(db *sqlx.DB) *QueuesRepo {
-	return &QueuesRepo{db}
+	return &QueuesRepo{portable(db)}
 }
 
 // Create saves a queue into the database
-func (repo *QueuesRepo) Create(q *Queue) (*Queue, error) {
-	query := "INSERT INTO queues (name, description) VALUES (?, ?)"
-	res, err := repo.db.Exec(query, q.Name, q.Description)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := res.LastInsertId()
+func (repo *QueuesRepo) Create(ctx context.Context, q *Queue) (*Queue, error) {
+	query := "INSERT INTO queues (branch_id, name, description, status, max_length, max_wait_minutes, overflow_queue_id) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	id, err := repo.db.insert(ctx, query, q.BranchID, q.Name, q.Description, q.Status, q.MaxLength, q.MaxWaitMinutes, q.OverflowQueueID)
 	if err != nil {
 		return nil, err
 	}
 	q.ID = id
+	q.IsActive = true
 	return q, nil
 }
 
 // GetAll fetches and returns all queues from the database
-func (repo *QueuesRepo) GetAll() ([]*Queue, error) {
+func (repo *QueuesRepo) GetAll(ctx context.Context) ([]*Queue, error) {
 	query := "SELECT q.* FROM queues AS q"
 
 	var queues []*Queue
-	err := repo.db.Select(&queues, query)
+	err := repo.db.Select(ctx, &queues, query)
 	if err != nil {
 		return nil, err
 	}
@@ -57,11 +66,25 @@ func (repo *QueuesRepo) GetAll() ([]*Queue, error) {
 }
 
 // GetActive fetches and returns all active queues from the database
-func (repo *QueuesRepo) GetActive() ([]*Queue, error) {
+func (repo *QueuesRepo) GetActive(ctx context.Context) ([]*Queue, error) {
 	query := "SELECT q.* FROM queues AS q WHERE q.is_active = TRUE"
 
 	var queues []*Queue
-	err := repo.db.Select(&queues, query)
+	err := repo.db.Select(ctx, &queues, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return queues, nil
+}
+
+// GetActiveInBranch fetches and returns all active queues
+// of a branch from the database
+func (repo *QueuesRepo) GetActiveInBranch(ctx context.Context, branchID int64) ([]*Queue, error) {
+	query := "SELECT q.* FROM queues AS q WHERE q.is_active = TRUE AND q.branch_id = ?"
+
+	var queues []*Queue
+	err := repo.db.Select(ctx, &queues, query, branchID)
 	if err != nil {
 		return nil, err
 	}
@@ -70,11 +93,11 @@ func (repo *QueuesRepo) GetActive() ([]*Queue, error) {
 }
 
 // Get fetches and returns a queue by id
-func (repo *QueuesRepo) Get(id int64) (*Queue, error) {
+func (repo *QueuesRepo) Get(ctx context.Context, id int64) (*Queue, error) {
 	query := "SELECT q.* FROM queues AS q WHERE q.id = ?"
 
 	q := new(Queue)
-	err := repo.db.QueryRowx(query, id).StructScan(q)
+	err := repo.db.Get(ctx, q, query, id)
 	if err != nil {
 		return nil, err
 	}
@@ -82,24 +105,121 @@ func (repo *QueuesRepo) Get(id int64) (*Queue, error) {
 	return q, nil
 }
 
-// Update updates the name, descrition, or activity status
+// Update updates the name, descrition, activity status or limits
 // of a queue and returns the updated record
-func (repo *QueuesRepo) Update(q *Queue) (*Queue, error) {
-	query := "UPDATE queues SET name = ?, description = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP() WHERE id = ?"
+func (repo *QueuesRepo) Update(ctx context.Context, q *Queue) (*Queue, error) {
+	query := "UPDATE queues SET name = ?, description = ?, is_active = ?, max_length = ?, max_wait_minutes = ?, overflow_queue_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
 
-	_, err := repo.db.Exec(query, q.Name, q.Description, q.IsActive, q.ID)
+	_, err := repo.db.Exec(ctx, query, q.Name, q.Description, q.IsActive, q.MaxLength, q.MaxWaitMinutes, q.OverflowQueueID, q.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	return repo.Get(q.ID)
+	return repo.Get(ctx, q.ID)
 }
 
-// Delete removes a queue from the database by id
-func (repo *QueuesRepo) Delete(id int64) error {
-	query := "DELETE FROM queues WHERE id = ?"
+// SetStatus changes the status of a queue and returns the
+// updated record. Queues are archived with Archive
+func (repo *QueuesRepo) SetStatus(ctx context.Context, id int64, status string) (*Queue, error) {
+	query := "UPDATE queues SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, status, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.Get(ctx, id)
+}
+
+// Archive closes a queue for good, deactivating it and recording
+// when it was archived, and returns the updated record. Queues are
+// never deleted, so the customers they served stay in reports
+func (repo *QueuesRepo) Archive(ctx context.Context, id int64) (*Queue, error) {
+	query := "UPDATE queues SET status = 'archived', is_active = FALSE, archived_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.Get(ctx, id)
+}
 
-	_, err := repo.db.Exec(query, id)
+// Export streams queues matching the given filter to fn, one
+// row at a time. Iteration stops at the first error returned by fn
+func (repo *QueuesRepo) Export(ctx context.Context, f ExportFilter, fn func(*Queue) error) error {
+	where, args := f.where("q.branch_id", "q.id", "q.created_at")
+	query := "SELECT q.* FROM queues AS q" + where + " ORDER BY q.id"
+
+	rows, err := repo.db.Queryx(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		q := new(Queue)
+		if err := rows.StructScan(q); err != nil {
+			return err
+		}
+
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// QueueFilter restricts the queues returned by List.
+// Zero values are ignored
+type QueueFilter struct {
+	BranchID int64
+	IsActive *bool
+	Status   string
+	Name     string
+	From     *time.Time
+	To       *time.Time
+}
+
+// List fetches a page of queues matching the given filter.
+// The returned flag reports whether there are more queues
+// after the page
+func (repo *QueuesRepo) List(ctx context.Context, f QueueFilter, p Page) ([]*Queue, bool, error) {
+	q := newListQuery("queues", "q")
+	if f.BranchID != 0 {
+		q.where("q.branch_id = ?", f.BranchID)
+	}
+	if f.IsActive != nil {
+		q.where("q.is_active = ?", *f.IsActive)
+	}
+	if f.Status != "" {
+		q.where("q.status = ?", f.Status)
+	}
+	if f.Name != "" {
+		q.where("q.name LIKE ?", "%"+f.Name+"%")
+	}
+	if f.From != nil {
+		q.where("q.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q.where("q.created_at < ?", *f.To)
+	}
+
+	query, args, err := q.build(p)
+	if err != nil {
+		return nil, false, err
+	}
+
+	queues := []*Queue{}
+	err = repo.db.Select(ctx, &queues, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(queues) > p.limit() {
+		return queues[:p.limit()], true, nil
+	}
 
-	return err
+	return queues, false, nil
 }
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -10,7 +11,7 @@ import (
 )
 
 func TestCreateQueue_ShouldPass(t *testing.T) {
-	query := `^INSERT INTO queues \(name, description\) VALUES \(\?, \?\)$`
+	query := `^INSERT INTO queues \(branch_id, name, description, status, max_length, max_wait_minutes, overflow_queue_id\) VALUES \(\?, \?, \?, \?, \?, \?, \?\)$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -18,19 +19,24 @@ func TestCreateQueue_ShouldPass(t *testing.T) {
 	}
 	defer db.Close()
 
-	q := &Queue{Name: "testqueue", Description: "test queue description"}
+	q := &Queue{BranchID: 1, Name: "testqueue", Description: "test queue description"}
 
 	mock.ExpectExec(query).
 		WithArgs(
+			q.BranchID,
 			q.Name,
 			q.Description,
+			q.Status,
+			q.MaxLength,
+			q.MaxWaitMinutes,
+			q.OverflowQueueID,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	saved, err := queuesRepo.Create(q)
+	saved, err := queuesRepo.Create(context.Background(), q)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -46,7 +52,7 @@ func TestCreateQueue_ShouldPass(t *testing.T) {
 }
 
 func TestCreateQueue_ShouldFail(t *testing.T) {
-	query := `^INSERT INTO queues \(name, description\) VALUES \(\?, \?\)$`
+	query := `^INSERT INTO queues \(branch_id, name, description, status, max_length, max_wait_minutes, overflow_queue_id\) VALUES \(\?, \?, \?, \?, \?, \?, \?\)$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -54,19 +60,24 @@ func TestCreateQueue_ShouldFail(t *testing.T) {
 	}
 	defer db.Close()
 
-	q := &Queue{Name: "testqueue", Description: "test queue description"}
+	q := &Queue{BranchID: 1, Name: "testqueue", Description: "test queue description"}
 
 	mock.ExpectExec(query).
 		WithArgs(
+			q.BranchID,
 			q.Name,
 			q.Description,
+			q.Status,
+			q.MaxLength,
+			q.MaxWaitMinutes,
+			q.OverflowQueueID,
 		).
 		WillReturnError(fmt.Errorf("db error"))
 
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	saved, err := queuesRepo.Create(q)
+	saved, err := queuesRepo.Create(context.Background(), q)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -101,7 +112,7 @@ func TestGetAllQueue_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewQueuesRepo(dbMock)
 
-	_, err = repo.GetAll()
+	_, err = repo.GetAll(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -128,7 +139,7 @@ func TestGetAllQueue_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	queues, err := queuesRepo.GetAll()
+	queues, err := queuesRepo.GetAll(context.Background())
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -163,7 +174,7 @@ func TestGetAllActiveQueues_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewQueuesRepo(dbMock)
 
-	_, err = repo.GetActive()
+	_, err = repo.GetActive(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -190,7 +201,7 @@ func TestGetAllActiveQueues_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	queues, err := queuesRepo.GetActive()
+	queues, err := queuesRepo.GetActive(context.Background())
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -223,7 +234,7 @@ func TestGetQueue_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewQueuesRepo(dbMock)
 
-	_, err = repo.Get(id)
+	_, err = repo.Get(context.Background(), id)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -252,7 +263,7 @@ func TestGetQueue_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	queue, err := queuesRepo.Get(id)
+	queue, err := queuesRepo.Get(context.Background(), id)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -267,8 +278,8 @@ func TestGetQueue_ShouldFail(t *testing.T) {
 	}
 }
 
-func TestDeleteQueue_ShouldPass(t *testing.T) {
-	query := `^DELETE FROM queues WHERE id = \?$`
+func TestSetQueueStatus_ShouldPass(t *testing.T) {
+	query := `^UPDATE queues SET status = \?, updated_at = CURRENT_TIMESTAMP WHERE id = \?$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -280,26 +291,77 @@ func TestDeleteQueue_ShouldPass(t *testing.T) {
 
 	mock.ExpectExec(query).
 		WithArgs(
+			"paused",
 			id,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
+	mock.ExpectQuery(`^SELECT q.\* FROM queues AS q WHERE q.id = \?$`).WithArgs(id).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name", "status"}).
+			AddRow(id, "test queue", "paused"),
+	)
+
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	err = queuesRepo.Delete(id)
+	q, err := queuesRepo.SetStatus(context.Background(), id, "paused")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
+	if q.Status != "paused" {
+		t.Errorf("expected status paused, got %s", q.Status)
+	}
+
 	err = mock.ExpectationsWereMet()
 	if err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
 
-func TestDeleteQueue_ShouldFail(t *testing.T) {
-	query := `^DELETE FROM queues WHERE id = \?$`
+func TestArchiveQueue_ShouldPass(t *testing.T) {
+	query := `^UPDATE queues SET status = 'archived', is_active = FALSE, archived_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	id := int64(1)
+	archivedAt := time.Now()
+
+	mock.ExpectExec(query).
+		WithArgs(
+			id,
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectQuery(`^SELECT q.\* FROM queues AS q WHERE q.id = \?$`).WithArgs(id).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name", "is_active", "status", "archived_at"}).
+			AddRow(id, "test queue", false, "archived", archivedAt),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	queuesRepo := NewQueuesRepo(dbMock)
+
+	q, err := queuesRepo.Archive(context.Background(), id)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if q.IsActive || q.ArchivedAt == nil {
+		t.Errorf("expected an inactive queue with an archive time, got %+v", q)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestArchiveQueue_ShouldFail(t *testing.T) {
+	query := `^UPDATE queues SET status = 'archived'`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -318,7 +380,7 @@ func TestDeleteQueue_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	err = queuesRepo.Delete(id)
+	_, err = queuesRepo.Archive(context.Background(), id)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -330,7 +392,7 @@ func TestDeleteQueue_ShouldFail(t *testing.T) {
 }
 
 func TestUpdateQueue_ShouldPass(t *testing.T) {
-	query := `^UPDATE queues SET name = \?, description = \?, is_active = \?, updated_at = CURRENT_TIMESTAMP\(\) WHERE id = \?$`
+	query := `^UPDATE queues SET name = \?, description = \?, is_active = \?, max_length = \?, max_wait_minutes = \?, overflow_queue_id = \?, updated_at = CURRENT_TIMESTAMP WHERE id = \?$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -345,6 +407,9 @@ func TestUpdateQueue_ShouldPass(t *testing.T) {
 			q.Name,
 			q.Description,
 			q.IsActive,
+			q.MaxLength,
+			q.MaxWaitMinutes,
+			q.OverflowQueueID,
 			q.ID,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -357,7 +422,7 @@ func TestUpdateQueue_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	updatedQueue, err := queuesRepo.Update(q)
+	updatedQueue, err := queuesRepo.Update(context.Background(), q)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -373,7 +438,7 @@ func TestUpdateQueue_ShouldPass(t *testing.T) {
 }
 
 func TestUpdateQueue_ShouldFail(t *testing.T) {
-	query := `^UPDATE queues SET name = \?, description = \?, is_active = \?, updated_at = CURRENT_TIMESTAMP\(\) WHERE id = \?$`
+	query := `^UPDATE queues SET name = \?, description = \?, is_active = \?, max_length = \?, max_wait_minutes = \?, overflow_queue_id = \?, updated_at = CURRENT_TIMESTAMP WHERE id = \?$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -388,6 +453,9 @@ func TestUpdateQueue_ShouldFail(t *testing.T) {
 			q.Name,
 			q.Description,
 			q.IsActive,
+			q.MaxLength,
+			q.MaxWaitMinutes,
+			q.OverflowQueueID,
 			q.ID,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -398,7 +466,7 @@ func TestUpdateQueue_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	queuesRepo := NewQueuesRepo(dbMock)
 
-	updatedQueue, err := queuesRepo.Update(q)
+	updatedQueue, err := queuesRepo.Update(context.Background(), q)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -412,3 +480,103 @@ func TestUpdateQueue_ShouldFail(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestExportQueues_ShouldPass(t *testing.T) {
+	query := `^SELECT q.\* FROM queues AS q ORDER BY q.id$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name", "description", "is_active", "created_at"}).
+			AddRow(1, "Queue name", "Queue descrition", true, time.Now()).
+			AddRow(2, "Queue name", "Queue descrition", false, time.Now()),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewQueuesRepo(dbMock)
+
+	count := 0
+	err = repo.Export(context.Background(), ExportFilter{}, func(q *Queue) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("expected 2 queues, got %d", count)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportQueues_ShouldFail(t *testing.T) {
+	query := `^SELECT q.\* FROM queues AS q ORDER BY q.id$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(query).WillReturnError(fmt.Errorf("db error"))
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewQueuesRepo(dbMock)
+
+	err = repo.Export(context.Background(), ExportFilter{}, func(q *Queue) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListQueues_ShouldPass(t *testing.T) {
+	query := `^SELECT q.\* FROM queues AS q WHERE q.is_active = \? ORDER BY q.name DESC, q.id DESC LIMIT \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	active := true
+	page := Page{Sort: "name", Desc: true}
+
+	mock.ExpectQuery(query).WithArgs(active, DefaultPageLimit+1).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name", "description", "is_active", "created_at"}).
+			AddRow(2, "Queue name", "Queue descrition", true, time.Now()).
+			AddRow(1, "Another queue", "Queue descrition", true, time.Now()),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewQueuesRepo(dbMock)
+
+	queues, hasMore, err := repo.List(context.Background(), QueueFilter{IsActive: &active}, page)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(queues) != 2 || hasMore {
+		t.Fatalf("expected a single page of 2 queues, got %d", len(queues))
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
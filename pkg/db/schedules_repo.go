@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// QueueHours models the opening hours of a queue on a weekday.
+// 'Weekday' follows time.Weekday, so Sunday is 0. Times are
+// formatted as HH:MM in the timezone of the queue's branch, and
+// customers may not join after 'LastAdmission' when it is set
+type QueueHours struct {
+	ID            int64   `db:"id" json:"id"`
+	QueueID       int64   `db:"queue_id" json:"queueId"`
+	Weekday       int     `db:"weekday" json:"weekday"`
+	OpensAt       string  `db:"opens_at" json:"opensAt"`
+	ClosesAt      string  `db:"closes_at" json:"closesAt"`
+	LastAdmission *string `db:"last_admission" json:"lastAdmission"`
+}
+
+// QueueClosure models a holiday or other closure of a queue
+// from 'StartsOn' to 'EndsOn', both days included
+type QueueClosure struct {
+	ID        int64      `db:"id" json:"id"`
+	QueueID   int64      `db:"queue_id" json:"queueId"`
+	StartsOn  time.Time  `db:"starts_on" json:"startsOn"`
+	EndsOn    time.Time  `db:"ends_on" json:"endsOn"`
+	Reason    string     `db:"reason" json:"reason"`
+	CreatedAt *time.Time `db:"created_at" json:"createdAt"`
+}
+
+// SchedulesRepo defines methods for executing business rules
+// on the opening hours and closures of queues
+type SchedulesRepo struct {
+	db *portableDB
+}
+
+// NewSchedulesRepo returns a pointer to a SchedulesRepo
+func NewSchedulesRepo(db *sqlx.DB) *SchedulesRepo {
+	return &SchedulesRepo{portable(db)}
+}
+
+// GetHours fetches and returns the opening hours of a queue
+func (repo *SchedulesRepo) GetHours(ctx context.Context, queueID int64) ([]*QueueHours, error) {
+	query := "SELECT h.* FROM queue_hours AS h WHERE h.queue_id = ? ORDER BY h.weekday"
+
+	hours := []*QueueHours{}
+	err := repo.db.Select(ctx, &hours, query, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return hours, nil
+}
+
+// SetHours replaces the opening hours of a queue. A queue
+// without opening hours is open at all times
+func (repo *SchedulesRepo) SetHours(ctx context.Context, queueID int64, hours []*QueueHours) ([]*QueueHours, error) {
+	tx, err := repo.db.Beginx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(ctx, "DELETE FROM queue_hours WHERE queue_id = ?", queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "INSERT INTO queue_hours (queue_id, weekday, opens_at, closes_at, last_admission) VALUES (?, ?, ?, ?, ?)"
+	for _, h := range hours {
+		h.ID, err = tx.insert(ctx, query, queueID, h.Weekday, h.OpensAt, h.ClosesAt, h.LastAdmission)
+		if err != nil {
+			return nil, err
+		}
+		h.QueueID = queueID
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return hours, nil
+}
+
+// GetClosures fetches and returns the closures of a queue
+// that have not ended before the given day
+func (repo *SchedulesRepo) GetClosures(ctx context.Context, queueID int64, since time.Time) ([]*QueueClosure, error) {
+	query := "SELECT c.* FROM queue_closures AS c WHERE c.queue_id = ? AND c.ends_on >= ? ORDER BY c.starts_on"
+
+	closures := []*QueueClosure{}
+	err := repo.db.Select(ctx, &closures, query, queueID, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+
+	return closures, nil
+}
+
+// GetClosure fetches and returns a closure by id
+func (repo *SchedulesRepo) GetClosure(ctx context.Context, id int64) (*QueueClosure, error) {
+	query := "SELECT c.* FROM queue_closures AS c WHERE c.id = ?"
+
+	c := new(QueueClosure)
+	err := repo.db.Get(ctx, c, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// CreateClosure saves a closure into the database
+func (repo *SchedulesRepo) CreateClosure(ctx context.Context, c *QueueClosure) (*QueueClosure, error) {
+	query := "INSERT INTO queue_closures (queue_id, starts_on, ends_on, reason) VALUES (?, ?, ?, ?)"
+
+	id, err := repo.db.insert(ctx, query, c.QueueID, c.StartsOn.Format("2006-01-02"), c.EndsOn.Format("2006-01-02"), c.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ID = id
+	return c, nil
+}
+
+// DeleteClosure deletes a closure by id
+func (repo *SchedulesRepo) DeleteClosure(ctx context.Context, id int64) error {
+	query := "DELETE FROM queue_closures WHERE id = ?"
+
+	_, err := repo.db.Exec(ctx, query, id)
+	return err
+}
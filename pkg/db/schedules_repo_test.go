@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestSetQueueHours_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	lastAdmission := "16:30"
+	hours := []*QueueHours{
+		{Weekday: 1, OpensAt: "08:00", ClosesAt: "17:00", LastAdmission: &lastAdmission},
+		{Weekday: 6, OpensAt: "09:00", ClosesAt: "13:00"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM queue_hours WHERE queue_id = \?$`).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	for i, h := range hours {
+		mock.ExpectExec(`^INSERT INTO queue_hours \(queue_id, weekday, opens_at, closes_at, last_admission\) VALUES \(\?, \?, \?, \?, \?\)$`).
+			WithArgs(3, h.Weekday, h.OpensAt, h.ClosesAt, h.LastAdmission).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectCommit()
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewSchedulesRepo(dbMock)
+
+	saved, err := repo.SetHours(context.Background(), 3, hours)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if saved[1].ID != 2 || saved[1].QueueID != 3 {
+		t.Fatalf("unexpected queue hours %+v", saved[1])
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,315 @@
+//go:build cgo
+// +build cgo
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hackstock/rubixcore/migrations"
+	"github.com/hackstock/rubixcore/pkg/migrate"
+	"github.com/jmoiron/sqlx"
+)
+
+// openSQLite returns a migrated SQLite database living
+// in a temporary directory for the duration of a test
+func openSQLite(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dbConn, err := Open("sqlite:" + filepath.Join(t.TempDir(), "rubix.db"))
+	if err != nil {
+		t.Fatalf("expected no error opening database, got %v", err)
+	}
+	t.Cleanup(func() { dbConn.Close() })
+
+	files, err := migrations.For(dbConn.DriverName())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	all, err := migrate.Load(files)
+	if err != nil {
+		t.Fatalf("expected no error loading migrations, got %v", err)
+	}
+
+	_, err = migrate.NewMigrator(dbConn.DB, dbConn.DriverName(), all, time.Second).Up(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error migrating, got %v", err)
+	}
+
+	return dbConn
+}
+
+func TestSQLite_Queues(t *testing.T) {
+	stores := NewStores(openSQLite(t))
+
+	tellers, err := stores.Queues.Create(context.Background(), &Queue{BranchID: 1, Name: "Tellers", Description: "Cash and cheques", Status: "open"})
+	if err != nil {
+		t.Fatalf("expected no error creating queue, got %v", err)
+	}
+
+	_, err = stores.Queues.Create(context.Background(), &Queue{BranchID: 1, Name: "Tellers"})
+	if !IsDuplicateKey(err) {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+
+	_, err = stores.Queues.Create(context.Background(), &Queue{BranchID: 42, Name: "Loans"})
+	if !IsMissingReference(err) {
+		t.Fatalf("expected a missing reference error, got %v", err)
+	}
+
+	tellers.Description = "Cash only"
+	tellers.IsActive = false
+	if _, err := stores.Queues.Update(context.Background(), tellers); err != nil {
+		t.Fatalf("expected no error updating queue, got %v", err)
+	}
+
+	got, err := stores.Queues.Get(context.Background(), tellers.ID)
+	if err != nil {
+		t.Fatalf("expected no error fetching queue, got %v", err)
+	}
+	if got.Description != "Cash only" || got.IsActive || got.CreatedAt == nil || got.UpdatedAt == nil {
+		t.Errorf("unexpected queue %+v", got)
+	}
+
+	paused, err := stores.Queues.SetStatus(context.Background(), tellers.ID, "paused")
+	if err != nil || paused.Status != "paused" {
+		t.Errorf("expected queue to be paused, got %+v (%v)", paused, err)
+	}
+
+	active, err := stores.Queues.GetActive(context.Background())
+	if err != nil || len(active) != 0 {
+		t.Errorf("expected no active queues, got %d (%v)", len(active), err)
+	}
+}
+
+func TestSQLite_Customers(t *testing.T) {
+	stores := NewStores(openSQLite(t))
+
+	queue, err := stores.Queues.Create(context.Background(), &Queue{BranchID: 1, Name: "Tellers", Status: "open"})
+	if err != nil {
+		t.Fatalf("expected no error creating queue, got %v", err)
+	}
+
+	for i, msisdn := range []string{"+233240000001", "+233240000001", "+233240000002"} {
+		_, err := stores.Customers.Create(context.Background(), &Customer{BranchID: 1, QueueID: queue.ID, Msisdn: msisdn, Ticket: fmt.Sprintf("A%03d", i+1)})
+		if err != nil {
+			t.Fatalf("expected no error creating customer, got %v", err)
+		}
+	}
+
+	if err := stores.Customers.MarkAsServed(context.Background(), 1); err != nil {
+		t.Fatalf("expected no error serving customer, got %v", err)
+	}
+
+	served, err := stores.Customers.Get(context.Background(), 1)
+	if err != nil || served.ServedAt == nil {
+		t.Fatalf("expected customer 1 to be served, got %+v (%v)", served, err)
+	}
+
+	since := time.Now().Add(-time.Hour)
+	inBranch, inQueue, err := stores.Customers.CountUnservedByMsisdn(context.Background(), "+233240000001", 1, queue.ID, since)
+	if err != nil || inBranch != 1 || inQueue != 1 {
+		t.Errorf("expected 1 ticket in branch and queue, got %d and %d (%v)", inBranch, inQueue, err)
+	}
+
+	inBranch, _, err = stores.Customers.CountUnservedByMsisdn(context.Background(), "+233240000001", 1, queue.ID, time.Now().Add(time.Hour))
+	if err != nil || inBranch != 0 {
+		t.Errorf("expected tickets issued before the last reset not to count, got %d (%v)", inBranch, err)
+	}
+
+	loans, err := stores.Queues.Create(context.Background(), &Queue{BranchID: 1, Name: "Loans", Status: "open"})
+	if err != nil {
+		t.Fatalf("expected no error creating queue, got %v", err)
+	}
+	held, err := stores.Customers.Create(context.Background(), &Customer{BranchID: 1, QueueID: loans.ID, Msisdn: "+233240000001", Ticket: "B001"})
+	if err != nil {
+		t.Fatalf("expected no error creating customer, got %v", err)
+	}
+	if _, err := stores.Queues.Archive(context.Background(), loans.ID); err != nil {
+		t.Fatalf("expected no error archiving queue, got %v", err)
+	}
+
+	inBranch, _, err = stores.Customers.CountUnservedByMsisdn(context.Background(), "+233240000001", 1, queue.ID, since)
+	if err != nil || inBranch != 1 {
+		t.Errorf("expected tickets on archived queues not to count, got %d (%v)", inBranch, err)
+	}
+
+	if err := stores.Customers.Delete(context.Background(), held.ID); err != nil {
+		t.Fatalf("expected no error deleting customer, got %v", err)
+	}
+	if _, err := stores.Customers.Get(context.Background(), held.ID); err != sql.ErrNoRows {
+		t.Errorf("expected deleted customer to be gone, got %v", err)
+	}
+
+	unserved, err := stores.Customers.GetUnservedInBranch(context.Background(), 1)
+	if err != nil || len(unserved) != 2 {
+		t.Errorf("expected 2 unserved customers, got %d (%v)", len(unserved), err)
+	}
+
+	page, hasMore, err := stores.Customers.List(context.Background(), CustomerFilter{QueueID: queue.ID}, Page{Limit: 2})
+	if err != nil {
+		t.Fatalf("expected no error listing customers, got %v", err)
+	}
+	if len(page) != 2 || !hasMore || page[0].ID != 1 {
+		t.Fatalf("expected the first 2 of 3 customers, got %d (hasMore %v)", len(page), hasMore)
+	}
+
+	page, hasMore, err = stores.Customers.List(context.Background(), CustomerFilter{QueueID: queue.ID}, Page{After: page[1].ID, Limit: 2})
+	if err != nil || len(page) != 1 || hasMore || page[0].ID != 3 {
+		t.Errorf("expected the last customer, got %d (hasMore %v, %v)", len(page), hasMore, err)
+	}
+
+	archived, err := stores.Queues.Archive(context.Background(), queue.ID)
+	if err != nil || archived.Status != "archived" || archived.IsActive || archived.ArchivedAt == nil {
+		t.Fatalf("expected queue with customers to be archived, got %+v (%v)", archived, err)
+	}
+
+	listed, _, err := stores.Customers.List(context.Background(), CustomerFilter{QueueID: queue.ID}, Page{Limit: 10})
+	if err != nil || len(listed) != 3 {
+		t.Errorf("expected the customers of an archived queue to be kept, got %d (%v)", len(listed), err)
+	}
+}
+
+func TestSQLite_CreateWithinLimit(t *testing.T) {
+	stores := NewStores(openSQLite(t))
+
+	queue, err := stores.Queues.Create(context.Background(), &Queue{BranchID: 1, Name: "Tellers", Status: "open"})
+	if err != nil {
+		t.Fatalf("expected no error creating queue, got %v", err)
+	}
+
+	// the same number joins ten times at once with room for one ticket
+	errLimit := errors.New("ticket limit reached")
+	since := time.Now().Add(-time.Hour)
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			_, err := stores.Customers.CreateWithinLimit(context.Background(), &Customer{BranchID: 1, QueueID: queue.ID, Msisdn: "+233240000001", Ticket: fmt.Sprintf("A%03d", i+1)}, queue.ID, since, func(inBranch, inQueue int) error {
+				if inQueue >= 1 {
+					return errLimit
+				}
+				return nil
+			})
+			errs <- err
+		}(i)
+	}
+
+	created := 0
+	for i := 0; i < 10; i++ {
+		err := <-errs
+		if err == nil {
+			created++
+			continue
+		}
+		if err != errLimit {
+			t.Fatalf("expected joins over the limit to be refused, got %v", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("expected exactly 1 ticket to be issued, got %d", created)
+	}
+
+	_, inQueue, err := stores.Customers.CountUnservedByMsisdn(context.Background(), "+233240000001", 1, queue.ID, since)
+	if err != nil || inQueue != 1 {
+		t.Errorf("expected 1 ticket held, got %d (%v)", inQueue, err)
+	}
+}
+
+func TestSQLite_Users(t *testing.T) {
+	stores := NewStores(openSQLite(t))
+
+	u, err := stores.Users.Create(context.Background(), &UserAccount{Username: "ama", Password: "hash", IsAdmin: true})
+	if err != nil {
+		t.Fatalf("expected no error creating user, got %v", err)
+	}
+
+	if _, err := stores.Users.Create(context.Background(), &UserAccount{Username: "ama", Password: "hash"}); !IsDuplicateKey(err) {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+
+	if err := stores.Users.UpdateLastLogin(context.Background(), u.ID); err != nil {
+		t.Fatalf("expected no error updating last login, got %v", err)
+	}
+
+	got, err := stores.Users.GetByUsername(context.Background(), "ama")
+	if err != nil || got.LastLoginAt == nil {
+		t.Fatalf("expected last login to be set, got %+v (%v)", got, err)
+	}
+
+	count, err := stores.Users.Count(context.Background())
+	if err != nil || count != 1 {
+		t.Errorf("expected 1 user, got %d (%v)", count, err)
+	}
+}
+
+func TestSQLite_Coordinator(t *testing.T) {
+	dbConn := openSQLite(t)
+	stores := NewStores(dbConn)
+	coordinator := NewCoordinator(dbConn)
+
+	// two instances sharing the database issue tickets at once
+	numbers := make(chan int, 20)
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		go func() {
+			n, err := coordinator.NextTicket(context.Background(), 1)
+			numbers <- n
+			errs <- err
+		}()
+	}
+
+	issued := map[int]bool{}
+	for i := 0; i < 20; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("expected no error issuing ticket, got %v", err)
+		}
+		issued[<-numbers] = true
+	}
+	if len(issued) != 20 || !issued[1] || !issued[20] {
+		t.Fatalf("expected ticket numbers 1 to 20 to be issued once each, got %v", issued)
+	}
+
+	if err := coordinator.ResumeTickets(context.Background(), 1, 7); err != nil {
+		t.Fatalf("expected no error resuming tickets, got %v", err)
+	}
+	if n, _ := coordinator.NextTicket(context.Background(), 1); n != 21 {
+		t.Errorf("expected resuming below the sequence to leave it alone, got %d", n)
+	}
+
+	reset := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := coordinator.ResetTickets(context.Background(), 1, reset); err != nil {
+			t.Fatalf("expected no error resetting tickets, got %v", err)
+		}
+		if n, _ := coordinator.NextTicket(context.Background(), 1); n != i+1 {
+			t.Errorf("expected a reset to take effect once, got ticket %d after %d resets", n, i+1)
+		}
+	}
+
+	queue, err := stores.Queues.Create(context.Background(), &Queue{BranchID: 1, Name: "Tellers", Status: "open"})
+	if err != nil {
+		t.Fatalf("expected no error creating queue, got %v", err)
+	}
+
+	customer, err := stores.Customers.Create(context.Background(), &Customer{BranchID: 1, QueueID: queue.ID, Msisdn: "+233240000001", Ticket: "A001"})
+	if err != nil {
+		t.Fatalf("expected no error creating customer, got %v", err)
+	}
+
+	claimed, err := coordinator.Claim(context.Background(), customer.ID)
+	if err != nil || !claimed {
+		t.Fatalf("expected the first claim to succeed, got %v (%v)", claimed, err)
+	}
+
+	claimed, err = coordinator.Claim(context.Background(), customer.ID)
+	if err != nil || claimed {
+		t.Errorf("expected a second claim to fail, got %v (%v)", claimed, err)
+	}
+}
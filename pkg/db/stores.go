@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// QueueStore reads and writes queues
+type QueueStore interface {
+	Create(ctx context.Context, q *Queue) (*Queue, error)
+	GetAll(ctx context.Context) ([]*Queue, error)
+	GetActive(ctx context.Context) ([]*Queue, error)
+	GetActiveInBranch(ctx context.Context, branchID int64) ([]*Queue, error)
+	Get(ctx context.Context, id int64) (*Queue, error)
+	Update(ctx context.Context, q *Queue) (*Queue, error)
+	SetStatus(ctx context.Context, id int64, status string) (*Queue, error)
+	Archive(ctx context.Context, id int64) (*Queue, error)
+	Export(ctx context.Context, f ExportFilter, fn func(*Queue) error) error
+	List(ctx context.Context, f QueueFilter, p Page) ([]*Queue, bool, error)
+}
+
+// CustomerStore reads and writes customers
+type CustomerStore interface {
+	Create(ctx context.Context, c *Customer) (*Customer, error)
+	CreateWithinLimit(ctx context.Context, c *Customer, queueID int64, since time.Time, allow func(inBranch, inQueue int) error) (*Customer, error)
+	GetAll(ctx context.Context) ([]*Customer, error)
+	GetUnserved(ctx context.Context) ([]*Customer, error)
+	GetUnservedInBranch(ctx context.Context, branchID int64) ([]*Customer, error)
+	CountUnservedByMsisdn(ctx context.Context, msisdn string, branchID, queueID int64, since time.Time) (int, int, error)
+	MarkAsServed(ctx context.Context, custID int) error
+	Delete(ctx context.Context, id int64) error
+	Export(ctx context.Context, f ExportFilter, fn func(*Customer) error) error
+	ExportEvents(ctx context.Context, f ExportFilter, fn func(*ServiceEvent) error) error
+	List(ctx context.Context, f CustomerFilter, p Page) ([]*Customer, bool, error)
+	Get(ctx context.Context, id int64) (*Customer, error)
+}
+
+// UserStore reads and writes user accounts
+type UserStore interface {
+	GetByUsername(ctx context.Context, username string) (*UserAccount, error)
+	UpdateLastLogin(ctx context.Context, id int64) error
+	Create(ctx context.Context, u *UserAccount) (*UserAccount, error)
+	Count(ctx context.Context) (int, error)
+	GetAll(ctx context.Context) ([]*UserAccount, error)
+	List(ctx context.Context, f UserFilter, p Page) ([]*UserAccount, bool, error)
+}
+
+var (
+	_ QueueStore    = (*QueuesRepo)(nil)
+	_ CustomerStore = (*CustomersRepo)(nil)
+	_ UserStore     = (*UsersRepo)(nil)
+)
+
+// Stores gathers the stores the API works with
+type Stores struct {
+	Queues    QueueStore
+	Customers CustomerStore
+	Users     UserStore
+}
+
+// NewStores returns the stores backed by a database opened with
+// Open. The repositories run their statements through portableDB,
+// which rebinds placeholders and reads back inserted ids the way
+// the database it was opened on expects
+func NewStores(db *sqlx.DB) *Stores {
+	return &Stores{
+		Queues:    NewQueuesRepo(db),
+		Customers: NewCustomersRepo(db),
+		Users:     NewUsersRepo(db),
+	}
+}
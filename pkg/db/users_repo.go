@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -9,6 +10,7 @@ import (
 // UserAccount models a user in the db
 type UserAccount struct {
 	ID          int64      `db:"id" json:"id"`
+	BranchID    *int64     `db:"branch_id" json:"branchId"`
 	Username    string     `db:"username" json:"username"`
 	Password    string     `db:"password" json:"-"`
 	IsAdmin     bool       `db:"is_admin" json:"isAdmin"`
@@ -19,20 +21,20 @@ type UserAccount struct {
 
 // UsersRepo defines methods for running business rules on user accounts
 type UsersRepo struct {
-	db *sqlx.DB
+	db *portableDB
 }
 
 // NewUsersRepo returns a pointer to a UsersRepo
 func NewUsersRepo(db *sqlx.DB) *UsersRepo {
-	return &UsersRepo{db}
+	return &UsersRepo{portable(db)}
 }
 
 // GetByUsername returns a user with the specified username
-func (repo *UsersRepo) GetByUsername(username string) (*UserAccount, error) {
+func (repo *UsersRepo) GetByUsername(ctx context.Context, username string) (*UserAccount, error) {
 	query := "SELECT * FROM user_accounts AS u WHERE u.username = ?"
 
 	u := new(UserAccount)
-	err := repo.db.QueryRowx(query, username).StructScan(u)
+	err := repo.db.Get(ctx, u, query, username)
 	if err != nil {
 		return nil, err
 	}
@@ -41,41 +43,98 @@ func (repo *UsersRepo) GetByUsername(username string) (*UserAccount, error) {
 }
 
 // UpdateLastLogin updates the last login date for the specified user
-func (repo *UsersRepo) UpdateLastLogin(id int64) error {
-	query := "UPDATE user_accounts SET last_login_at = CURRENT_TIMESTAMP() WHERE id = ?"
+func (repo *UsersRepo) UpdateLastLogin(ctx context.Context, id int64) error {
+	query := "UPDATE user_accounts SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?"
 
-	_, err := repo.db.Exec(query, id)
+	_, err := repo.db.Exec(ctx, query, id)
 
 	return err
 }
 
 // Create saves a UserAccount into the database
-func (repo *UsersRepo) Create(u *UserAccount) (*UserAccount, error) {
-	query := "INSERT INTO user_accounts (username, password, is_admin) VALUES (?, ?, ?)"
+func (repo *UsersRepo) Create(ctx context.Context, u *UserAccount) (*UserAccount, error) {
+	query := "INSERT INTO user_accounts (branch_id, username, password, is_admin) VALUES (?, ?, ?, ?)"
 
-	res, err := repo.db.Exec(query, u.Username, u.Password, u.IsAdmin)
+	id, err := repo.db.insert(ctx, query, u.BranchID, u.Username, u.Password, u.IsAdmin)
 	if err != nil {
 		return nil, err
 	}
 
-	id, err := res.LastInsertId()
+	u.ID = id
+	return u, nil
+}
+
+// Count returns the number of user accounts in the database
+func (repo *UsersRepo) Count(ctx context.Context) (int, error) {
+	query := "SELECT COUNT(*) FROM user_accounts"
+
+	var count int
+	err := repo.db.Get(ctx, &count, query)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	u.ID = id
-	return u, nil
+	return count, nil
 }
 
 // GetAll fetches and returns all user accounts in the database
-func (repo *UsersRepo) GetAll() ([]*UserAccount, error) {
+func (repo *UsersRepo) GetAll(ctx context.Context) ([]*UserAccount, error) {
 	var accounts []*UserAccount
 	query := "SELECT * FROM user_accounts"
 
-	err := repo.db.Select(&accounts, query)
+	err := repo.db.Select(ctx, &accounts, query)
 	if err != nil {
 		return nil, err
 	}
 
 	return accounts, nil
 }
+
+// UserFilter restricts the user accounts returned by List.
+// Zero values are ignored
+type UserFilter struct {
+	BranchID int64
+	IsAdmin  *bool
+	Username string
+	From     *time.Time
+	To       *time.Time
+}
+
+// List fetches a page of user accounts matching the given filter.
+// The returned flag reports whether there are more accounts
+// after the page
+func (repo *UsersRepo) List(ctx context.Context, f UserFilter, p Page) ([]*UserAccount, bool, error) {
+	q := newListQuery("user_accounts", "u")
+	if f.BranchID != 0 {
+		q.where("u.branch_id = ?", f.BranchID)
+	}
+	if f.IsAdmin != nil {
+		q.where("u.is_admin = ?", *f.IsAdmin)
+	}
+	if f.Username != "" {
+		q.where("u.username LIKE ?", "%"+f.Username+"%")
+	}
+	if f.From != nil {
+		q.where("u.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q.where("u.created_at < ?", *f.To)
+	}
+
+	query, args, err := q.build(p)
+	if err != nil {
+		return nil, false, err
+	}
+
+	accounts := []*UserAccount{}
+	err = repo.db.Select(ctx, &accounts, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(accounts) > p.limit() {
+		return accounts[:p.limit()], true, nil
+	}
+
+	return accounts, false, nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -10,7 +11,7 @@ import (
 )
 
 func TestCreateUserAccount_ShouldPass(t *testing.T) {
-	query := `^INSERT INTO user_accounts \(username, password, is_admin\) VALUES \(\?, \?, \?\)$`
+	query := `^INSERT INTO user_accounts \(branch_id, username, password, is_admin\) VALUES \(\?, \?, \?, \?\)$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -18,10 +19,12 @@ func TestCreateUserAccount_ShouldPass(t *testing.T) {
 	}
 	defer db.Close()
 
-	u := &UserAccount{Username: "someuser", Password: "somepassword", IsAdmin: false}
+	branchID := int64(1)
+	u := &UserAccount{BranchID: &branchID, Username: "someuser", Password: "somepassword", IsAdmin: false}
 
 	mock.ExpectExec(query).
 		WithArgs(
+			u.BranchID,
 			u.Username,
 			u.Password,
 			u.IsAdmin,
@@ -31,7 +34,7 @@ func TestCreateUserAccount_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	saved, err := repo.Create(u)
+	saved, err := repo.Create(context.Background(), u)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -47,7 +50,7 @@ func TestCreateUserAccount_ShouldPass(t *testing.T) {
 }
 
 func TestCreateUserAccount_ShouldFail(t *testing.T) {
-	query := `^INSERT INTO user_accounts \(username, password, is_admin\) VALUES \(\?, \?, \?\)$`
+	query := `^INSERT INTO user_accounts \(branch_id, username, password, is_admin\) VALUES \(\?, \?, \?, \?\)$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -55,10 +58,12 @@ func TestCreateUserAccount_ShouldFail(t *testing.T) {
 	}
 	defer db.Close()
 
-	u := &UserAccount{Username: "someuser", Password: "somepassword", IsAdmin: false}
+	branchID := int64(1)
+	u := &UserAccount{BranchID: &branchID, Username: "someuser", Password: "somepassword", IsAdmin: false}
 
 	mock.ExpectExec(query).
 		WithArgs(
+			u.BranchID,
 			u.Username,
 			u.Password,
 			u.IsAdmin,
@@ -68,7 +73,7 @@ func TestCreateUserAccount_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	saved, err := repo.Create(u)
+	saved, err := repo.Create(context.Background(), u)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -103,7 +108,7 @@ func TestGetAllUserAccount_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	_, err = repo.GetAll()
+	_, err = repo.GetAll(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -130,7 +135,7 @@ func TestGetAllUserAccount_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	_, err = repo.GetAll()
+	_, err = repo.GetAll(context.Background())
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -162,7 +167,7 @@ func TestAuthenticateUserAccount_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	_, err = repo.GetByUsername(username)
+	_, err = repo.GetByUsername(context.Background(), username)
 	if err != nil {
 		t.Fatalf("expected not error, got %v", err)
 	}
@@ -192,7 +197,7 @@ func TestAuthenticateUserAccount_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	user, err := repo.GetByUsername(username)
+	user, err := repo.GetByUsername(context.Background(), username)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -208,7 +213,7 @@ func TestAuthenticateUserAccount_ShouldFail(t *testing.T) {
 }
 
 func TestUpdateLastLoginUserAccount_ShouldPass(t *testing.T) {
-	query := `^UPDATE user_accounts SET last_login_at = CURRENT_TIMESTAMP\(\) WHERE id = \?$`
+	query := `^UPDATE user_accounts SET last_login_at = CURRENT_TIMESTAMP WHERE id = \?$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -226,7 +231,7 @@ func TestUpdateLastLoginUserAccount_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	err = repo.UpdateLastLogin(id)
+	err = repo.UpdateLastLogin(context.Background(), id)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -238,7 +243,7 @@ func TestUpdateLastLoginUserAccount_ShouldPass(t *testing.T) {
 }
 
 func TestUpdateLastLoginUserAccount_ShouldFail(t *testing.T) {
-	query := `^UPDATE user_accounts SET last_login_at = CURRENT_TIMESTAMP\(\) WHERE id = \?$`
+	query := `^UPDATE user_accounts SET last_login_at = CURRENT_TIMESTAMP WHERE id = \?$`
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -256,7 +261,7 @@ func TestUpdateLastLoginUserAccount_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 	repo := NewUsersRepo(dbMock)
 
-	err = repo.UpdateLastLogin(id)
+	err = repo.UpdateLastLogin(context.Background(), id)
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
@@ -266,3 +271,37 @@ func TestUpdateLastLoginUserAccount_ShouldFail(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestListUserAccounts_ShouldPass(t *testing.T) {
+	query := `^SELECT u.\* FROM user_accounts AS u WHERE u.is_admin = \? ORDER BY u.id ASC LIMIT \?$`
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	isAdmin := false
+
+	mock.ExpectQuery(query).WithArgs(isAdmin, 11).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "username", "password", "is_admin", "created_at"}).
+			AddRow(1, "someuser", "somepassword", false, time.Now()),
+	)
+
+	dbMock := sqlx.NewDb(db, "sqlmock")
+	repo := NewUsersRepo(dbMock)
+
+	accounts, hasMore, err := repo.List(context.Background(), UserFilter{IsAdmin: &isAdmin}, Page{Limit: 10})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(accounts) != 1 || hasMore {
+		t.Fatalf("expected a single page of 1 account, got %d", len(accounts))
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rubix"
+
+var (
+	// TicketsIssued counts tickets issued to customers per queue
+	TicketsIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tickets_issued_total",
+		Help:      "Number of tickets issued to customers.",
+	}, []string{"queue_id"})
+
+	// CustomersServed counts customers called to a counter per queue
+	CustomersServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "customers_served_total",
+		Help:      "Number of customers called to be served.",
+	}, []string{"queue_id"})
+
+	// WaitTime observes how long customers waited on a queue
+	// before being called
+	WaitTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "wait_time_seconds",
+		Help:      "Time customers spent on a wait list before being called.",
+		Buckets:   []float64{60, 120, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200},
+	}, []string{"queue_id"})
+
+	// SMSPublished counts SMS payloads published onto the broker
+	SMSPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sms_published_total",
+		Help:      "Number of SMS payloads published onto the message broker.",
+	}, []string{"queue"})
+
+	// SMSSent counts SMS successfully handed to a gateway
+	SMSSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sms_sent_total",
+		Help:      "Number of SMS accepted by an SMS gateway.",
+	}, []string{"provider"})
+
+	// SMSFailed counts SMS that could not be sent through a gateway
+	SMSFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sms_failed_total",
+		Help:      "Number of SMS that failed to be sent through an SMS gateway.",
+	}, []string{"provider"})
+
+	// AMQPReconnects counts the times a consumer re-subscribed
+	// to the message broker after losing its channel
+	AMQPReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "amqp_reconnects_total",
+		Help:      "Number of times a consumer re-subscribed to the message broker.",
+	})
+
+	// HTTPRequestDuration observes request latencies by route pattern
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+)
+
+// QueueLabel formats a queue id for use as a label value
+func QueueLabel(queueID int64) string {
+	return strconv.FormatInt(queueID, 10)
+}
+
+// WaitListSizer reports the number of customers on
+// each wait list keyed by queue id
+type WaitListSizer interface {
+	WaitListSizes() map[int64]int
+}
+
+type waitListCollector struct {
+	sizer WaitListSizer
+	desc  *prometheus.Desc
+}
+
+// NewWaitListCollector returns a collector reporting the length
+// of every wait list at scrape time
+func NewWaitListCollector(sizer WaitListSizer) prometheus.Collector {
+	return &waitListCollector{
+		sizer: sizer,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "wait_list_length"),
+			"Number of customers currently waiting on a queue.",
+			[]string{"queue_id"}, nil,
+		),
+	}
+}
+
+func (c *waitListCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *waitListCollector) Collect(ch chan<- prometheus.Metric) {
+	for queueID, size := range c.sizer.WaitListSizes() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(size), QueueLabel(queueID))
+	}
+}
+
+type dbStatsCollector struct {
+	db                *sql.DB
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+// NewDBStatsCollector returns a collector reporting the
+// connection pool statistics of db at scrape time
+func NewDBStatsCollector(db *sql.DB) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, nil)
+	}
+
+	return &dbStatsCollector{
+		db:                db,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:              desc("open_connections", "Number of established connections to the database."),
+		inUse:             desc("in_use_connections", "Number of connections currently in use."),
+		idle:              desc("idle_connections", "Number of idle connections."),
+		waitCount:         desc("wait_count_total", "Total number of connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "Total time blocked waiting for a new connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime."),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
+
+// Register registers the application metrics along with
+// collectors for the wait lists and database pool
+func Register(sizer WaitListSizer, db *sql.DB) error {
+	collectors := []prometheus.Collector{
+		TicketsIssued,
+		CustomersServed,
+		WaitTime,
+		SMSPublished,
+		SMSSent,
+		SMSFailed,
+		AMQPReconnects,
+		HTTPRequestDuration,
+		NewWaitListCollector(sizer),
+		NewDBStatsCollector(db),
+	}
+
+	for _, c := range collectors {
+		if err := prometheus.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler returns the http.Handler serving metrics in
+// the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeSizer map[int64]int
+
+func (f fakeSizer) WaitListSizes() map[int64]int {
+	return f
+}
+
+func TestWaitListCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewWaitListCollector(fakeSizer{1: 3, 2: 0}))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("expected no error gathering metrics, got %v", err)
+	}
+
+	if len(families) != 1 {
+		t.Fatalf("expected 1 metric family, got %d", len(families))
+	}
+
+	got := map[string]float64{}
+	for _, m := range families[0].GetMetric() {
+		got[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+	}
+
+	if got["1"] != 3 || got["2"] != 0 || len(got) != 2 {
+		t.Fatalf("expected wait list lengths {1: 3, 2: 0}, got %v", got)
+	}
+}
@@ -0,0 +1,432 @@
+// Package migrate applies and rolls back the SQL migrations of the
+// database schema, recording applied versions in schema_migrations
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockName is the name of the MySQL user lock, or the key of the
+// Postgres advisory lock, held while migrating so that instances
+// starting together take turns
+const lockName = "rubixcore.schema_migrations"
+
+// lockPollInterval is how often to try for the Postgres lock,
+// which cannot be waited for with a timeout
+const lockPollInterval = 500 * time.Millisecond
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)_(up|down)\.sql$`)
+
+// ErrLocked is returned when the migration lock could not be
+// taken before the lock timeout
+var ErrLocked = errors.New("timed out waiting for the migration lock")
+
+// Statement is a named statement of a migration
+type Statement struct {
+	Name string
+	SQL  string
+}
+
+// Migration is a versioned change to the schema, along
+// with the statements that undo it
+type Migration struct {
+	Version int
+	Name    string
+	Up      []Statement
+	Down    []Statement
+}
+
+// Status tells whether a migration has been applied, and when
+type Status struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations in the root of fsys in version order.
+// Every migration needs an up file; down files are optional
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	hasUp := map[int]bool{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%s: version %d is already used by %s", entry.Name(), version, m.Name)
+		}
+
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		statements, err := parseStatements(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+
+		if match[3] == "up" {
+			m.Up = statements
+			hasUp[version] = true
+		} else {
+			m.Down = statements
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for version, m := range byVersion {
+		if !hasUp[version] {
+			return nil, fmt.Errorf("migration %d (%s) has no up file", version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// parseStatements splits a migration file into the statements
+// introduced by '-- name:' comments. Other comments are dropped
+func parseStatements(text string) ([]Statement, error) {
+	var statements []Statement
+	var current *Statement
+	var body strings.Builder
+
+	flush := func() {
+		if current != nil {
+			current.SQL = strings.TrimSuffix(strings.TrimSpace(body.String()), ";")
+			statements = append(statements, *current)
+		}
+		body.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "-- name:") {
+			flush()
+			current = &Statement{Name: strings.TrimSpace(strings.TrimPrefix(trimmed, "-- name:"))}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		if current == nil {
+			if trimmed != "" {
+				return nil, errors.New("statement without a '-- name:' comment")
+			}
+			continue
+		}
+
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range statements {
+		if s.SQL == "" {
+			return nil, fmt.Errorf("statement %s is empty", s.Name)
+		}
+	}
+
+	return statements, nil
+}
+
+// Migrator applies migrations to a MySQL, Postgres or SQLite database
+type Migrator struct {
+	db          *sql.DB
+	driver      string
+	migrations  []*Migration
+	lockTimeout time.Duration
+}
+
+// NewMigrator returns a pointer to a Migrator for a database opened
+// with the given driver. lockTimeout bounds how long to wait for
+// another instance that is migrating
+func NewMigrator(db *sql.DB, driver string, migrations []*Migration, lockTimeout time.Duration) *Migrator {
+	return &Migrator{db: db, driver: driver, migrations: migrations, lockTimeout: lockTimeout}
+}
+
+// lock takes the migration lock on conn and returns the function
+// releasing it. SQLite databases are files served by a single
+// instance, so they are not locked
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	switch m.driver {
+	case "sqlite3":
+		return func() {}, nil
+	case "postgres":
+		return m.lockPostgres(ctx, conn)
+	}
+
+	var got sql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(m.lockTimeout.Seconds())).Scan(&got)
+	if err != nil {
+		return nil, err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return nil, ErrLocked
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	}, nil
+}
+
+// lockPostgres tries for the advisory lock until the lock timeout
+func (m *Migrator) lockPostgres(ctx context.Context, conn *sql.Conn) (func(), error) {
+	deadline := time.Now().Add(m.lockTimeout)
+	for {
+		var got bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", lockName).Scan(&got)
+		if err != nil {
+			return nil, err
+		}
+		if got {
+			return func() {
+				conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", lockName)
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// rebind rewrites the ? placeholders of query for the driver
+func (m *Migrator) rebind(query string) string {
+	return sqlx.Rebind(sqlx.BindType(m.driver), query)
+}
+
+// withLock runs fn on a connection holding the migration lock.
+// MySQL locks belong to a session, so everything fn does must
+// go through conn
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	timestamp := "DATETIME"
+	if m.driver == "postgres" {
+		timestamp = "TIMESTAMP"
+	}
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INT NOT NULL, name VARCHAR(255) NOT NULL, applied_at "+timestamp+" DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY(version))")
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// applied returns when each applied version was applied
+func applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+func run(ctx context.Context, conn *sql.Conn, m *Migration, statements []Statement) error {
+	for _, s := range statements {
+		if _, err := conn.ExecContext(ctx, s.SQL); err != nil {
+			return fmt.Errorf("migration %d (%s), statement %s: %v", m.Version, m.Name, s.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Up applies every migration that has not been applied yet, in
+// version order, and returns those it applied. Statements run
+// outside of a transaction, as MySQL commits schema changes as they
+// run, so a migration failing half way leaves the statements before
+// the failing one in place
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var done []*Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			if err := run(ctx, conn, migration, migration.Up); err != nil {
+				return err
+			}
+
+			_, err = conn.ExecContext(ctx, m.rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations, newest
+// first, and returns those it rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var done []*Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+
+			if len(migration.Down) == 0 {
+				return fmt.Errorf("migration %d (%s) cannot be rolled back", migration.Version, migration.Name)
+			}
+
+			if err := run(ctx, conn, migration, migration.Down); err != nil {
+				return err
+			}
+
+			_, err = conn.ExecContext(ctx, m.rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Baseline records every migration up to version as applied
+// without running it, for databases migrated by hand before
+// versions were tracked
+func (m *Migrator) Baseline(ctx context.Context, version int) ([]*Migration, error) {
+	var done []*Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			_, err = conn.ExecContext(ctx, m.rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status returns every migration along with when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	var statuses []*Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := &Status{Migration: migration}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
@@ -0,0 +1,216 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hackstock/rubixcore/migrations"
+)
+
+var testFiles = fstest.MapFS{
+	"00_create_users_up.sql": {Data: []byte(`-- SQL in this section is executed when migration is applied.
+
+-- name: create-users
+CREATE TABLE users
+(
+    id INT NOT NULL
+);
+
+-- name: create-users-index
+CREATE INDEX users_index ON users(id);
+`)},
+	"00_create_users_down.sql": {Data: []byte("-- name: remove-users\nDROP TABLE users;")},
+	"01_add_names_up.sql":      {Data: []byte("-- name: add-names\nALTER TABLE users ADD COLUMN name TEXT;")},
+	"01_add_names_down.sql":    {Data: []byte("-- name: remove-names\nALTER TABLE users DROP COLUMN name;")},
+	"README.md":                {Data: []byte("not a migration")},
+}
+
+func TestLoad(t *testing.T) {
+	all, err := Load(testFiles)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(all) != 2 || all[0].Version != 0 || all[1].Version != 1 {
+		t.Fatalf("expected migrations 0 and 1 in order, got %+v", all)
+	}
+
+	up := all[0].Up
+	if len(up) != 2 {
+		t.Fatalf("expected 2 up statements, got %d", len(up))
+	}
+
+	if up[0].Name != "create-users" || up[0].SQL != "CREATE TABLE users\n(\n    id INT NOT NULL\n)" {
+		t.Errorf("unexpected first statement %+v", up[0])
+	}
+
+	if up[1].SQL != "CREATE INDEX users_index ON users(id)" {
+		t.Errorf("unexpected second statement %q", up[1].SQL)
+	}
+}
+
+func TestLoad_ShouldFail(t *testing.T) {
+	testCases := []struct {
+		tag   string
+		files fstest.MapFS
+	}{
+		{tag: "missing up", files: fstest.MapFS{"00_users_down.sql": {Data: []byte("-- name: a\nDROP TABLE users;")}}},
+		{tag: "unnamed statement", files: fstest.MapFS{"00_users_up.sql": {Data: []byte("CREATE TABLE users (id INT);")}}},
+		{tag: "empty statement", files: fstest.MapFS{"00_users_up.sql": {Data: []byte("-- name: a\n-- name: b\nDROP TABLE users;")}}},
+		{tag: "version reused", files: fstest.MapFS{
+			"00_users_up.sql":  {Data: []byte("-- name: a\nCREATE TABLE users (id INT);")},
+			"00_queues_up.sql": {Data: []byte("-- name: a\nCREATE TABLE queues (id INT);")},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			if _, err := Load(tc.files); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_EmbeddedMigrations(t *testing.T) {
+	all, err := Load(migrations.Files)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i, m := range all {
+		if m.Version != i {
+			t.Errorf("expected migration %d, got %d (%s)", i, m.Version, m.Name)
+		}
+		if len(m.Down) == 0 {
+			t.Errorf("expected migration %d (%s) to have down statements", m.Version, m.Name)
+		}
+	}
+
+	files, err := migrations.For("postgres")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	postgres, err := Load(files)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(postgres) != len(all) {
+		t.Fatalf("expected %d postgres migrations, got %d", len(all), len(postgres))
+	}
+
+	for i, m := range postgres {
+		if m.Version != all[i].Version || m.Name != all[i].Name || len(m.Down) == 0 {
+			t.Errorf("expected postgres migration %d to mirror %02d_%s, got %02d_%s", i, all[i].Version, all[i].Name, m.Version, m.Name)
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer conn.Close()
+
+	all, err := Load(testFiles)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mock.ExpectQuery(`^SELECT GET_LOCK\(\?, \?\)$`).
+		WithArgs(lockName, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`^SELECT version, applied_at FROM schema_migrations$`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(0, time.Now()))
+	mock.ExpectExec(`^ALTER TABLE users ADD COLUMN name TEXT$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO schema_migrations \(version, name\) VALUES \(\?, \?\)$`).
+		WithArgs(1, "add_names").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^SELECT RELEASE_LOCK\(\?\)$`).
+		WithArgs(lockName).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	done, err := NewMigrator(conn, "mysql", all, 5*time.Second).Up(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(done) != 1 || done[0].Version != 1 {
+		t.Fatalf("expected only migration 1 to be applied, got %+v", done)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUp_Locked(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer conn.Close()
+
+	mock.ExpectQuery(`^SELECT GET_LOCK\(\?, \?\)$`).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+
+	_, err = NewMigrator(conn, "mysql", nil, time.Second).Up(context.Background())
+	if err != ErrLocked {
+		t.Fatalf("expected %v, got %v", ErrLocked, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUp_Postgres(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer conn.Close()
+
+	all, err := Load(testFiles)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mock.ExpectQuery(`^SELECT pg_try_advisory_lock\(hashtext\(\$1\)\)$`).
+		WithArgs(lockName).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(true))
+	mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS schema_migrations \(.* applied_at TIMESTAMP `).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`^SELECT version, applied_at FROM schema_migrations$`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(0, time.Now()))
+	mock.ExpectExec(`^ALTER TABLE users ADD COLUMN name TEXT$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO schema_migrations \(version, name\) VALUES \(\$1, \$2\)$`).
+		WithArgs(1, "add_names").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^SELECT pg_advisory_unlock\(hashtext\(\$1\)\)$`).
+		WithArgs(lockName).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	done, err := NewMigrator(conn, "postgres", all, 5*time.Second).Up(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(done) != 1 || done[0].Version != 1 {
+		t.Fatalf("expected only migration 1 to be applied, got %+v", done)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,51 @@
+// Package phone validates customers' phone numbers and
+// normalises them to E.164
+package phone
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// ErrInvalid is returned for input that is not a valid phone number
+var ErrInvalid = errors.New("not a valid phone number")
+
+// ValidRegion returns true if region is a two letter country
+// code numbers can be dialled from, such as GH
+func ValidRegion(region string) bool {
+	return phonenumbers.GetCountryCodeForRegion(strings.ToUpper(region)) != 0
+}
+
+// Normalize validates a phone number and returns it in E.164
+// format, such as +233200662782. Numbers without a country code
+// are read as numbers of defaultRegion, and spaces, dashes and
+// brackets are ignored, so 0200662782, 233 20 066 2782 and
+// +233200662782 are all the same number in Ghana
+func Normalize(raw, defaultRegion string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrInvalid
+	}
+
+	region := strings.ToUpper(defaultRegion)
+	num, err := phonenumbers.Parse(raw, region)
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	// numbers written with their country code but without a
+	// leading + are parsed as national numbers of the region
+	if !phonenumbers.IsValidNumber(num) && !strings.HasPrefix(raw, "+") {
+		if alt, err := phonenumbers.Parse("+"+raw, region); err == nil && phonenumbers.IsValidNumber(alt) {
+			num = alt
+		}
+	}
+
+	if !phonenumbers.IsValidNumber(num) {
+		return "", ErrInvalid
+	}
+
+	return phonenumbers.Format(num, phonenumbers.E164), nil
+}
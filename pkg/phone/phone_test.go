@@ -0,0 +1,52 @@
+package phone
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		tag     string
+		raw     string
+		region  string
+		want    string
+		wantErr bool
+	}{
+		{tag: "national format", raw: "0200662782", region: "GH", want: "+233200662782"},
+		{tag: "e164", raw: "+233200662782", region: "GH", want: "+233200662782"},
+		{tag: "country code without plus", raw: "233 20 066 2782", region: "GH", want: "+233200662782"},
+		{tag: "dashes and brackets", raw: "(020) 066-2782", region: "gh", want: "+233200662782"},
+		{tag: "foreign number", raw: "+44 7911 123456", region: "GH", want: "+447911123456"},
+		{tag: "too short", raw: "02006", region: "GH", wantErr: true},
+		{tag: "letters", raw: "call me", region: "GH", wantErr: true},
+		{tag: "empty", raw: " ", region: "GH", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			got, err := Normalize(tc.raw, tc.region)
+			if tc.wantErr {
+				if err != ErrInvalid {
+					t.Fatalf("expected %v, got %q, %v", ErrInvalid, got, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestValidRegion(t *testing.T) {
+	if !ValidRegion("GH") || !ValidRegion("ng") {
+		t.Fatalf("expected GH and NG to be valid regions")
+	}
+
+	if ValidRegion("XX") || ValidRegion("") {
+		t.Fatalf("expected XX and an empty region to be invalid")
+	}
+}
@@ -0,0 +1,88 @@
+package ticket
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ESC/POS commands understood by common receipt printers
+var (
+	escInit        = []byte{0x1b, 0x40}
+	escAlignLeft   = []byte{0x1b, 0x61, 0x00}
+	escAlignCenter = []byte{0x1b, 0x61, 0x01}
+	escBoldOn      = []byte{0x1b, 0x45, 0x01}
+	escBoldOff     = []byte{0x1b, 0x45, 0x00}
+	escSizeNormal  = []byte{0x1d, 0x21, 0x00}
+	escSizeLarge   = []byte{0x1d, 0x21, 0x11}
+	escFeedAndCut  = []byte{0x1b, 0x64, 0x03, 0x1d, 0x56, 0x42, 0x00}
+)
+
+// qrModuleSize is the width in dots of a QR code module
+const qrModuleSize = 6
+
+// EscPos encodes the lines of a ticket as ESC/POS commands for a
+// printer with the given number of columns. QR codes are drawn by
+// the printer itself, and the paper is cut after the ticket
+func EscPos(lines []Line, width int) []byte {
+	var buf bytes.Buffer
+	buf.Write(escInit)
+
+	for _, line := range lines {
+		if line.Centered {
+			buf.Write(escAlignCenter)
+		} else {
+			buf.Write(escAlignLeft)
+		}
+
+		switch line.Kind {
+		case Rule:
+			buf.WriteString(strings.Repeat("-", width))
+		case QRCode:
+			writeQRCode(&buf, line.Text)
+		default:
+			if line.Large {
+				buf.Write(escSizeLarge)
+				buf.Write(escBoldOn)
+			}
+			buf.WriteString(ascii(line.Text))
+			if line.Large {
+				buf.Write(escBoldOff)
+				buf.Write(escSizeNormal)
+			}
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	buf.Write(escFeedAndCut)
+	return buf.Bytes()
+}
+
+// writeQRCode writes the GS ( k commands that store data in the
+// printer's QR code symbol and print it
+func writeQRCode(buf *bytes.Buffer, data string) {
+	qr := func(fn byte, params ...byte) {
+		n := len(params) + 2
+		buf.Write([]byte{0x1d, 0x28, 0x6b, byte(n), byte(n >> 8), 0x31, fn})
+		buf.Write(params)
+	}
+
+	// model 2
+	qr(0x41, 0x32, 0x00)
+	qr(0x43, qrModuleSize)
+	// error correction level M
+	qr(0x45, 0x31)
+	qr(0x50, append([]byte{0x30}, ascii(data)...)...)
+	qr(0x51, 0x30)
+}
+
+// ascii replaces characters most printer code pages cannot
+// print with a question mark
+func ascii(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '?'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,41 @@
+package ticket
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEscPos(t *testing.T) {
+	lines := []Line{
+		{Kind: Text, Text: "Osu Branch", Centered: true},
+		{Kind: Text, Text: "A012", Centered: true, Large: true},
+		{Kind: QRCode, Text: "https://q.example.com/tickets/12", Centered: true},
+		{Kind: Text, Text: "Café"},
+	}
+
+	out := EscPos(lines, 32)
+
+	if !bytes.HasPrefix(out, escInit) {
+		t.Fatalf("expected ticket to start by initialising the printer")
+	}
+
+	if !bytes.HasSuffix(out, escFeedAndCut) {
+		t.Fatalf("expected ticket to end by cutting the paper")
+	}
+
+	large := append(append([]byte{}, escSizeLarge...), escBoldOn...)
+	if !bytes.Contains(out, append(large, "A012"...)) {
+		t.Fatalf("expected ticket number to be printed large")
+	}
+
+	data := "https://q.example.com/tickets/12"
+	n := len(data) + 3
+	store := append([]byte{0x1d, 0x28, 0x6b, byte(n), 0x00, 0x31, 0x50, 0x30}, data...)
+	if !bytes.Contains(out, store) {
+		t.Fatalf("expected QR code data to be stored in the printer")
+	}
+
+	if !bytes.Contains(out, []byte("Caf?\n")) {
+		t.Fatalf("expected characters outside ASCII to be replaced")
+	}
+}
@@ -0,0 +1,166 @@
+// Package ticket renders the tickets printed by kiosks for
+// customers joining a queue
+package ticket
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TimeLayout is how the time a ticket was issued is printed
+const TimeLayout = "02 Jan 2006 15:04"
+
+// DefaultTemplate is used for branches without a template of their own.
+//
+// Templates are Go text templates executed with a Ticket. Each line
+// of the result is printed as one line of the ticket, with markup:
+//
+//	# text    prints text large and centered
+//	= text    prints text centered
+//	---       prints a horizontal rule
+//	[qr]      prints a QR code linking to the ticket status page
+//
+// Any other line is printed as is, aligned left. Blank lines are kept
+const DefaultTemplate = `= {{.Branch}}
+= {{.Queue}}
+---
+# {{.Number}}
+---
+{{if .ETA}}= Estimated wait: {{.ETA}}
+{{end}}= Issued {{.IssuedAt}}
+[qr]
+{{if .StatusURL}}= Scan to follow your ticket
+{{end}}`
+
+// Ticket holds what is printed on a customer's ticket
+type Ticket struct {
+	Branch    string
+	Queue     string
+	Number    string
+	ETA       string
+	IssuedAt  string
+	StatusURL string
+}
+
+// New returns a ticket with its ETA and issue time formatted for
+// printing. A zero wait means the wait could not be estimated
+func New(branch, queue, number string, wait time.Duration, issuedAt time.Time, statusURL string) *Ticket {
+	return &Ticket{
+		Branch:    branch,
+		Queue:     queue,
+		Number:    number,
+		ETA:       FormatWait(wait),
+		IssuedAt:  issuedAt.Format(TimeLayout),
+		StatusURL: statusURL,
+	}
+}
+
+// FormatWait returns an estimated wait rounded to whole minutes,
+// or an empty string for a zero wait
+func FormatWait(wait time.Duration) string {
+	if wait <= 0 {
+		return ""
+	}
+
+	minutes := int((wait + time.Minute/2) / time.Minute)
+	switch {
+	case minutes < 1:
+		return "less than a minute"
+	case minutes == 1:
+		return "about 1 minute"
+	case minutes < 60:
+		return fmt.Sprintf("about %d minutes", minutes)
+	default:
+		return fmt.Sprintf("about %dh %02dm", minutes/60, minutes%60)
+	}
+}
+
+// Kinds of line on a ticket
+const (
+	Text = iota
+	Rule
+	QRCode
+)
+
+// Line is one line of a rendered ticket. For QR code lines,
+// 'Text' holds the data to encode
+type Line struct {
+	Kind     int
+	Text     string
+	Centered bool
+	Large    bool
+}
+
+// Template lays out the lines of a ticket
+type Template struct {
+	tmpl *template.Template
+}
+
+// Parse parses a ticket template
+func Parse(text string) (*Template, error) {
+	tmpl, err := template.New("ticket").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{tmpl}, nil
+}
+
+// Default is the parsed DefaultTemplate
+var Default = mustParse(DefaultTemplate)
+
+func mustParse(text string) *Template {
+	t, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// Validate checks a template parses and can be executed with a
+// ticket, so that mistakes show up when the template is saved
+// rather than when a customer's ticket is printed
+func Validate(text string) error {
+	t, err := Parse(text)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.Lines(New("Branch", "Queue", "A001", time.Minute, time.Now(), "https://example.com"))
+	return err
+}
+
+// Lines executes the template with a ticket and returns the lines
+// to print. QR codes are left out of tickets without a status URL
+func (t *Template) Lines(tk *Ticket) ([]Line, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, tk); err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimRight(buf.String(), "\n")
+	var lines []Line
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimRight(raw, " \r")
+		switch {
+		case raw == "---":
+			lines = append(lines, Line{Kind: Rule})
+		case raw == "[qr]":
+			if tk.StatusURL != "" {
+				lines = append(lines, Line{Kind: QRCode, Text: tk.StatusURL, Centered: true})
+			}
+		case strings.HasPrefix(raw, "# "):
+			lines = append(lines, Line{Kind: Text, Text: strings.TrimPrefix(raw, "# "), Centered: true, Large: true})
+		case strings.HasPrefix(raw, "= "):
+			lines = append(lines, Line{Kind: Text, Text: strings.TrimPrefix(raw, "= "), Centered: true})
+		default:
+			lines = append(lines, Line{Kind: Text, Text: raw})
+		}
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,94 @@
+package ticket
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultTemplate(t *testing.T) {
+	issuedAt := time.Date(2020, 1, 6, 9, 5, 0, 0, time.UTC)
+	tk := New("Osu Branch", "Deposits", "A012", 14*time.Minute+20*time.Second, issuedAt, "https://q.example.com/tickets/12")
+
+	lines, err := Default.Lines(tk)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []Line{
+		{Kind: Text, Text: "Osu Branch", Centered: true},
+		{Kind: Text, Text: "Deposits", Centered: true},
+		{Kind: Rule},
+		{Kind: Text, Text: "A012", Centered: true, Large: true},
+		{Kind: Rule},
+		{Kind: Text, Text: "Estimated wait: about 14 minutes", Centered: true},
+		{Kind: Text, Text: "Issued 06 Jan 2020 09:05", Centered: true},
+		{Kind: QRCode, Text: "https://q.example.com/tickets/12", Centered: true},
+		{Kind: Text, Text: "Scan to follow your ticket", Centered: true},
+	}
+
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %d: %+v", len(want), len(lines), lines)
+	}
+
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: expected %+v, got %+v", i, want[i], lines[i])
+		}
+	}
+}
+
+func TestDefaultTemplate_WithoutETAOrStatusURL(t *testing.T) {
+	tk := New("Osu Branch", "Deposits", "A012", 0, time.Now(), "")
+
+	lines, err := Default.Lines(tk)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, line := range lines {
+		if line.Kind == QRCode || strings.Contains(line.Text, "wait") || strings.Contains(line.Text, "Scan") {
+			t.Fatalf("unexpected line %+v", line)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		tag     string
+		text    string
+		wantErr bool
+	}{
+		{tag: "valid", text: "# {{.Number}}\n[qr]", wantErr: false},
+		{tag: "unclosed action", text: "# {{.Number", wantErr: true},
+		{tag: "unknown field", text: "# {{.Counter}}", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			err := Validate(tc.text)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFormatWait(t *testing.T) {
+	testCases := []struct {
+		wait time.Duration
+		want string
+	}{
+		{wait: 0, want: ""},
+		{wait: 20 * time.Second, want: "less than a minute"},
+		{wait: 70 * time.Second, want: "about 1 minute"},
+		{wait: 25 * time.Minute, want: "about 25 minutes"},
+		{wait: 95 * time.Minute, want: "about 1h 35m"},
+	}
+
+	for _, tc := range testCases {
+		if got := FormatWait(tc.wait); got != tc.want {
+			t.Errorf("FormatWait(%v): expected %q, got %q", tc.wait, tc.want, got)
+		}
+	}
+}
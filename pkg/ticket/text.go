@@ -0,0 +1,88 @@
+package ticket
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// PlainText renders the lines of a ticket as plain text, the given
+// number of columns wide, for screens and printers without ESC/POS.
+// Large text is letter-spaced and QR codes are drawn with block
+// characters, two rows of modules per line
+func PlainText(lines []Line, width int) (string, error) {
+	var out []string
+	for _, line := range lines {
+		switch line.Kind {
+		case Rule:
+			out = append(out, strings.Repeat("-", width))
+		case QRCode:
+			rows, err := qrRows(line.Text)
+			if err != nil {
+				return "", err
+			}
+			for _, row := range rows {
+				out = append(out, center(row, width))
+			}
+		default:
+			text := line.Text
+			if line.Large {
+				text = strings.Join(strings.Split(text, ""), " ")
+			}
+			if line.Centered {
+				text = center(text, width)
+			}
+			out = append(out, text)
+		}
+	}
+
+	return strings.Join(out, "\n") + "\n", nil
+}
+
+// qrRows draws a QR code of data with a one module quiet zone
+func qrRows(data string) ([]string, error) {
+	code, err := qrcode.New(data, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	size := len(bitmap) + 2
+	dark := func(row, col int) bool {
+		row, col = row-1, col-1
+		return row >= 0 && col >= 0 && row < len(bitmap) && col < len(bitmap) && bitmap[row][col]
+	}
+
+	var rows []string
+	for row := 0; row < size; row += 2 {
+		var b strings.Builder
+		for col := 0; col < size; col++ {
+			top, bottom := dark(row, col), dark(row+1, col)
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteRune(' ')
+			}
+		}
+		rows = append(rows, b.String())
+	}
+
+	return rows, nil
+}
+
+// center pads text on the left to center it in width columns
+func center(text string, width int) string {
+	n := utf8.RuneCountInString(text)
+	if n >= width {
+		return text
+	}
+
+	return strings.Repeat(" ", (width-n)/2) + text
+}
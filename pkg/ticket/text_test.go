@@ -0,0 +1,29 @@
+package ticket
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlainText(t *testing.T) {
+	lines := []Line{
+		{Kind: Text, Text: "Osu", Centered: true},
+		{Kind: Rule},
+		{Kind: Text, Text: "A012", Centered: true, Large: true},
+		{Kind: QRCode, Text: "https://q.example.com/tickets/12", Centered: true},
+	}
+
+	out, err := PlainText(lines, 11)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	rows := strings.Split(out, "\n")
+	if rows[0] != "    Osu" || rows[1] != "-----------" || rows[2] != "  A 0 1 2" {
+		t.Fatalf("unexpected ticket:\n%s", out)
+	}
+
+	if !strings.ContainsRune(out, '█') {
+		t.Fatalf("expected QR code to be drawn with block characters")
+	}
+}